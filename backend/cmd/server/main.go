@@ -3,13 +3,17 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/xizko39/nodeloom/internal/api/handlers"
 	"github.com/xizko39/nodeloom/internal/api/routes"
 	"github.com/xizko39/nodeloom/internal/config"
 	"github.com/xizko39/nodeloom/internal/database"
+	"github.com/xizko39/nodeloom/internal/engine"
+	"github.com/xizko39/nodeloom/internal/llm"
 	"github.com/xizko39/nodeloom/internal/workspace"
 
 	"github.com/gin-gonic/gin"
@@ -46,6 +50,31 @@ func main() {
 	// Initialize Handlers with Workspace Service
 	handlers.InitWorkspaceHandlers(workspaceService)
 
+	// Initialize the LLM providers listed in the config
+	providers, err := llm.FromConfig(cfg.LLM)
+	if err != nil {
+		sugar.Fatalf("Failed to configure LLM providers: %v", err)
+	}
+	handlers.InitModelHandlers(providers)
+
+	// Initialize the execution engine with a Supabase-backed run store and output cache
+	runStore := engine.NewSupabaseRunStore(supabaseClient)
+	runEngine := engine.New(runStore, workspaceService)
+	runEngine.UseCache(engine.NewSupabaseCache(supabaseClient))
+	runEngine.UseProviders(providers)
+	handlers.InitRunHandlers(runEngine, runStore)
+
+	// Approval nodes wait on requests stored in Supabase; overdue ones are expired every minute
+	approvalStore := engine.NewSupabaseApprovalStore(supabaseClient)
+	runEngine.UseApprovals(approvalStore, engine.LogNotifier{})
+	handlers.InitApprovalHandlers(approvalStore)
+	go runEngine.WatchApprovals(context.Background(), time.Minute)
+
+	// Memory nodes keep chat histories in Supabase across runs
+	sessionStore := engine.NewSupabaseSessionStore(supabaseClient)
+	runEngine.UseSessions(sessionStore)
+	handlers.InitSessionHandlers(sessionStore)
+
 	// Initialize SupabaseClient for User Handlers
 	handlers.InitSupabaseClient(supabaseClient)
 
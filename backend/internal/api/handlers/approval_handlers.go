@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/xizko39/nodeloom/internal/engine"
+)
+
+var approvalStore engine.ApprovalStore
+
+// InitApprovalHandlers sets the store the approval handlers read from
+func InitApprovalHandlers(store engine.ApprovalStore) {
+	approvalStore = store
+}
+
+// GetApprovals handles listing approvals. By default it returns the pending
+// approvals assigned to the current user; ?status= and ?assignee= override
+// the filter, and ?assignee=any lists every user's approvals.
+func GetApprovals(c *gin.Context) {
+	// Settle anything overdue so it does not show up as pending
+	if _, err := runEngine.ExpireApprovals(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to expire approvals"})
+		return
+	}
+
+	filter := engine.ApprovalFilter{
+		Status:   engine.ApprovalStatus(c.DefaultQuery("status", string(engine.ApprovalPending))),
+		Assignee: c.DefaultQuery("assignee", c.GetString("username")),
+	}
+	if filter.Status == "any" {
+		filter.Status = ""
+	}
+	if filter.Assignee == "any" {
+		filter.Assignee = ""
+	}
+
+	approvals, err := approvalStore.ListApprovals(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch approvals"})
+		return
+	}
+
+	c.JSON(http.StatusOK, approvals)
+}
+
+// GetApproval handles fetching a single approval
+func GetApproval(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid approval ID"})
+		return
+	}
+
+	approval, err := approvalStore.GetApproval(id)
+	if err != nil {
+		if errors.Is(err, engine.ErrApprovalNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Approval not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch approval"})
+		return
+	}
+
+	c.JSON(http.StatusOK, approval)
+}
+
+// ApprovalAction dispatches custom methods of the form POST /approvals/:id:<method>
+func ApprovalAction(c *gin.Context) {
+	rawID, method := splitCustomMethod(c.Param("id"))
+	id, err := uuid.Parse(rawID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid approval ID"})
+		return
+	}
+
+	switch method {
+	case "approve", "reject":
+		DecideApproval(c, id, method == "approve")
+	default:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown approval action"})
+	}
+}
+
+// DecideApproval handles approving or rejecting a pending approval. An
+// approval may carry an edited "payload" that replaces the one sent
+// downstream.
+func DecideApproval(c *gin.Context, id uuid.UUID, approve bool) {
+	var req struct {
+		Payload json.RawMessage `json:"payload"`
+		Comment string          `json:"comment"`
+	}
+
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	username := c.GetString("username")
+
+	var approval *engine.Approval
+	var err error
+	if approve {
+		var payload interface{}
+		edited := len(req.Payload) > 0
+		if edited {
+			if err := json.Unmarshal(req.Payload, &payload); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
+				return
+			}
+		}
+		approval, err = runEngine.Approve(id, username, payload, edited, req.Comment)
+	} else {
+		approval, err = runEngine.Reject(id, username, req.Comment)
+	}
+
+	if err != nil {
+		switch {
+		case errors.Is(err, engine.ErrApprovalNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Approval not found"})
+		case errors.Is(err, engine.ErrNotAnAssignee):
+			c.JSON(http.StatusForbidden, gin.H{"error": "You are not assigned to this approval"})
+		case errors.Is(err, engine.ErrApprovalDecided):
+			c.JSON(http.StatusConflict, gin.H{"error": "Approval has already been decided"})
+		case approval != nil:
+			// The decision is recorded but the run could not pick it up
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "approval": approval})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record decision"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, approval)
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/xizko39/nodeloom/internal/workspace"
+)
+
+// ExportWorkspace handles downloading a workspace as a portable JSON or YAML
+// document, or as a Graphviz DOT or Mermaid rendering of its graph
+func ExportWorkspace(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid workspace ID"})
+		return
+	}
+
+	format := c.DefaultQuery("format", workspace.ExportFormatJSON)
+
+	ws, err := workspaceService.GetWorkspace(id)
+	if err != nil {
+		if errors.Is(err, workspace.ErrWorkspaceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export workspace"})
+		return
+	}
+
+	var data []byte
+	var contentType, extension string
+
+	switch format {
+	case workspace.ExportFormatDOT:
+		data, contentType, extension = []byte(workspace.ToDOT(ws)), "text/vnd.graphviz", "dot"
+	case workspace.ExportFormatMermaid:
+		data, contentType, extension = []byte(workspace.ToMermaid(ws)), "text/plain", "mmd"
+	default:
+		data, err = workspace.EncodeExportDocument(workspace.NewExportDocument(ws), format)
+		if err != nil {
+			if errors.Is(err, workspace.ErrUnsupportedFormat) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported export format: " + format})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode workspace"})
+			return
+		}
+		contentType, extension = "application/json", "json"
+		if format == workspace.ExportFormatYAML {
+			contentType, extension = "application/yaml", "yaml"
+		}
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", id.String()+"."+extension))
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// ImportWorkspace handles creating a workspace from an uploaded export document
+func ImportWorkspace(c *gin.Context) {
+	format := c.Query("format")
+	if format == "" {
+		format = workspace.ExportFormatJSON
+		if strings.Contains(c.ContentType(), "yaml") {
+			format = workspace.ExportFormatYAML
+		}
+	}
+
+	data, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+
+	doc, err := workspace.DecodeExportDocument(data, format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := workspaceService.ImportWorkspace(doc)
+	if err != nil {
+		if workspace.IsImportError(err) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import workspace"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, result)
+}
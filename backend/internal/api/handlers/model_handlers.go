@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xizko39/nodeloom/internal/llm"
+)
+
+var providers *llm.Registry
+
+// InitModelHandlers sets the LLM providers the model handlers query
+func InitModelHandlers(registry *llm.Registry) {
+	providers = registry
+}
+
+// GetModels handles listing the models of every configured LLM provider.
+// Providers that cannot be reached are listed under "errors" rather than
+// failing the request.
+func GetModels(c *gin.Context) {
+	models, failures := providers.Models(c.Request.Context())
+
+	errs := make(map[string]string, len(failures))
+	for name, err := range failures {
+		errs[name] = err.Error()
+	}
+
+	status := http.StatusOK
+	if len(models) == 0 && len(errs) > 0 {
+		status = http.StatusBadGateway
+	}
+
+	c.JSON(status, gin.H{
+		"models":    models,
+		"providers": providers.Names(),
+		"errors":    errs,
+	})
+}
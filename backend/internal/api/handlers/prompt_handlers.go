@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/xizko39/nodeloom/internal/engine"
+	"github.com/xizko39/nodeloom/internal/expr"
+	"github.com/xizko39/nodeloom/internal/workspace"
+)
+
+// partialNamePattern restricts partial names to what {{> name }} can refer to
+var partialNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// PutPartial handles creating or replacing a named partial of a workspace
+func PutPartial(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid workspace ID"})
+		return
+	}
+
+	name := c.Param("name")
+	if !partialNamePattern.MatchString(name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid partial name"})
+		return
+	}
+
+	var req struct {
+		Content string `json:"content"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ws, err := workspaceService.GetWorkspace(id)
+	if err != nil {
+		if errors.Is(err, workspace.ErrWorkspaceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get workspace"})
+		return
+	}
+
+	// Check the partial as it would be saved, so include cycles are caught
+	candidate := *ws
+	candidate.Partials = workspace.Partials{name: req.Content}
+	for k, v := range ws.Partials {
+		if k != name {
+			candidate.Partials[k] = v
+		}
+	}
+	candidate.Nodes = nil
+	candidate.Edges = nil
+	if problems := workspace.Validate(&candidate); len(problems) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid partial", "problems": problems})
+		return
+	}
+
+	updated, err := workspaceService.SetPartial(id, name, req.Content)
+	if err != nil {
+		if errors.Is(err, workspace.ErrWorkspaceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save partial"})
+		return
+	}
+
+	c.JSON(http.StatusOK, updated.Partials)
+}
+
+// DeletePartial handles removing a named partial from a workspace
+func DeletePartial(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid workspace ID"})
+		return
+	}
+
+	_, err = workspaceService.DeletePartial(id, c.Param("name"))
+	if err != nil {
+		switch {
+		case errors.Is(err, workspace.ErrWorkspaceNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+		case errors.Is(err, workspace.ErrPartialNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Partial not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete partial"})
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RenderNode handles previewing a prompt node with sample inputs. No model
+// is called and nothing is recorded.
+func RenderNode(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid workspace ID"})
+		return
+	}
+
+	nodeID, err := uuid.Parse(c.Param("nodeId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid node ID"})
+		return
+	}
+
+	var req struct {
+		Inputs map[string]interface{} `json:"inputs"`
+	}
+
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	ws, err := workspaceService.GetWorkspace(id)
+	if err != nil {
+		if errors.Is(err, workspace.ErrWorkspaceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get workspace"})
+		return
+	}
+
+	var node *workspace.Node
+	for i := range ws.Nodes {
+		if ws.Nodes[i].ID == nodeID {
+			node = &ws.Nodes[i]
+			break
+		}
+	}
+	if node == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+		return
+	}
+	if node.Type != workspace.PromptNode {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only prompt nodes can be rendered"})
+		return
+	}
+
+	messages, err := engine.RenderPrompt(ws, node, req.Inputs)
+	if err != nil {
+		resp := gin.H{"error": err.Error()}
+		var exprErr *expr.Error
+		if errors.As(err, &exprErr) {
+			resp["line"] = exprErr.Line
+			resp["column"] = exprErr.Column
+		}
+		c.JSON(http.StatusUnprocessableEntity, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"messages": messages})
+}
@@ -0,0 +1,396 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/xizko39/nodeloom/internal/engine"
+	"github.com/xizko39/nodeloom/internal/workspace"
+)
+
+var (
+	runEngine *engine.Engine
+	runStore  engine.RunStore
+)
+
+// InitRunHandlers sets the engine and run store used by the run handlers
+func InitRunHandlers(e *engine.Engine, store engine.RunStore) {
+	runEngine = e
+	runStore = store
+}
+
+// StartRun handles executing a workspace. The run proceeds in the background
+// unless "wait" is set, in which case the finished run is returned. With
+// "from_run" and "start_from" or "only" (also accepted as "fromRun" and
+// "startFrom"), the selected nodes and everything downstream of them are
+// executed again and every other node reuses its result from the earlier run. A
+// "timeout" in seconds bounds the whole run. "breakpoints" and "step" pause
+// the run before the given nodes or before the first node. A "budget" in US
+// dollars limits what the run may spend on LLM calls. With "stream" the
+// response is a server-sent event stream of the run's output as it is
+// produced, see StreamRun.
+func StartRun(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid workspace ID"})
+		return
+	}
+
+	var req struct {
+		Inputs      map[string]interface{} `json:"inputs"`
+		Wait        bool                   `json:"wait"`
+		FromRun     *uuid.UUID             `json:"from_run"`
+		StartFrom   []uuid.UUID            `json:"start_from"`
+		Only        []uuid.UUID            `json:"only"`
+		FromRunID   *uuid.UUID             `json:"fromRun"`   // Alias of from_run
+		StartFromID []uuid.UUID            `json:"startFrom"` // Alias of start_from
+		Timeout     float64                `json:"timeout"`   // Seconds
+		Budget      float64                `json:"budget"`    // US dollars
+		Breakpoints []uuid.UUID            `json:"breakpoints"`
+		Step        bool                   `json:"step"`   // Pause before the first node
+		Stream      bool                   `json:"stream"` // Respond with server-sent events
+	}
+
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	ws, err := workspaceService.GetWorkspace(id)
+	if err != nil {
+		if errors.Is(err, workspace.ErrWorkspaceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load workspace"})
+		return
+	}
+
+	if req.Timeout < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Timeout must not be negative"})
+		return
+	}
+	if req.Budget < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Budget must not be negative"})
+		return
+	}
+
+	if req.FromRunID != nil {
+		if req.FromRun != nil && *req.FromRun != *req.FromRunID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from_run and fromRun name different runs"})
+			return
+		}
+		req.FromRun = req.FromRunID
+	}
+	req.StartFrom = append(req.StartFrom, req.StartFromID...)
+
+	partial := len(req.StartFrom) > 0 || len(req.Only) > 0
+	if partial && req.FromRun == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from_run is required with start_from or only"})
+		return
+	}
+
+	run := engine.NewRun(ws.ID, req.Inputs)
+	if req.FromRun != nil {
+		previous, err := runStore.GetRun(*req.FromRun)
+		if err != nil {
+			if errors.Is(err, engine.ErrRunNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Run not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch run"})
+			return
+		}
+
+		opts := engine.RerunOptions{StartFrom: req.StartFrom, Only: req.Only}
+		run, err = engine.NewRerun(ws, previous, req.Inputs, opts)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	run.Timeout = req.Timeout
+	run.Budget = req.Budget
+	run.CreatedBy = c.GetString("username")
+	run.Breakpoints = req.Breakpoints
+	run.Stepping = req.Step
+
+	run, done, err := runEngine.Start(ws, run)
+	if err != nil {
+		if errors.Is(err, engine.ErrBudgetExceeded) {
+			c.JSON(http.StatusPaymentRequired, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start run"})
+		return
+	}
+
+	if req.Stream || c.Query("stream") == "true" {
+		streamRunEvents(c, run.ID)
+		return
+	}
+
+	if req.Wait || c.Query("wait") == "true" {
+		select {
+		case run = <-done:
+			c.JSON(http.StatusOK, run)
+		case <-c.Request.Context().Done():
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, run)
+}
+
+// GetRuns handles listing the runs of a workspace
+func GetRuns(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid workspace ID"})
+		return
+	}
+
+	runs, err := runStore.ListRuns(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch runs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, runs)
+}
+
+// GetRun handles fetching a single run record
+func GetRun(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("runId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid run ID"})
+		return
+	}
+
+	run, err := runStore.GetRun(id)
+	if err != nil {
+		if errors.Is(err, engine.ErrRunNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Run not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch run"})
+		return
+	}
+
+	c.JSON(http.StatusOK, run)
+}
+
+// StreamRun handles following a run as server-sent events. "chunk" events
+// carry text streamed into OUTPUT nodes as it arrives; a final "done" event
+// carries the run once it has finished, paused or started waiting. Earlier
+// events of the run are replayed first. A run that is not in progress gets
+// just the "done" event.
+func StreamRun(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("runId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid run ID"})
+		return
+	}
+
+	streamRunEvents(c, id)
+}
+
+// streamRunEvents writes the events of a run to the response until the run stops
+func streamRunEvents(c *gin.Context, id uuid.UUID) {
+	events, ok := runEngine.Subscribe(c.Request.Context(), id)
+	if !ok {
+		run, err := runStore.GetRun(id)
+		if err != nil {
+			if errors.Is(err, engine.ErrRunNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Run not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch run"})
+			return
+		}
+		c.SSEvent(engine.EventDone, engine.RunEvent{Type: engine.EventDone, Run: run})
+		return
+	}
+
+	c.Stream(func(w io.Writer) bool {
+		event, ok := <-events
+		if !ok {
+			return false
+		}
+		c.SSEvent(event.Type, event)
+		return event.Type != engine.EventDone
+	})
+}
+
+// RunAction dispatches custom methods of the form POST /runs/:runId:<method>
+func RunAction(c *gin.Context) {
+	rawID, method := splitCustomMethod(c.Param("runId"))
+	id, err := uuid.Parse(rawID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid run ID"})
+		return
+	}
+
+	switch method {
+	case "cancel":
+		CancelRun(c, id)
+	default:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown run action"})
+	}
+}
+
+// CancelRun handles stopping a run in progress
+func CancelRun(c *gin.Context, id uuid.UUID) {
+	err := runEngine.Cancel(id)
+	if err == nil {
+		c.JSON(http.StatusAccepted, gin.H{"id": id, "status": "cancelling"})
+		return
+	}
+
+	if errors.Is(err, engine.ErrRunNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Run not found"})
+		return
+	}
+	if !errors.Is(err, engine.ErrRunNotActive) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel run"})
+		return
+	}
+
+	// Not running here: report whether it exists and has already finished
+	run, err := runStore.GetRun(id)
+	if err != nil {
+		if errors.Is(err, engine.ErrRunNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Run not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch run"})
+		return
+	}
+
+	c.JSON(http.StatusConflict, gin.H{"error": "Run is not in progress", "status": run.Status})
+}
+
+// GetPausedRun handles fetching the node a paused run is waiting at and the
+// inputs it will receive
+func GetPausedRun(c *gin.Context) {
+	run, ok := loadPausedRun(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, run.Paused)
+}
+
+// ResumeRun handles continuing a paused run until it finishes or reaches
+// another breakpoint
+func ResumeRun(c *gin.Context) {
+	continueRun(c, false)
+}
+
+// StepRun handles executing the node a run is paused at, pausing again
+// before the next one
+func StepRun(c *gin.Context) {
+	continueRun(c, true)
+}
+
+// continueRun resumes a paused run, optionally with edited inputs for the
+// paused node
+func continueRun(c *gin.Context, step bool) {
+	var req struct {
+		Inputs map[string]interface{} `json:"inputs"`
+		Wait   bool                   `json:"wait"`
+	}
+
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	run, ok := loadPausedRun(c)
+	if !ok {
+		return
+	}
+
+	ws, err := workspaceService.GetWorkspace(run.WorkspaceID)
+	if err != nil {
+		if errors.Is(err, workspace.ErrWorkspaceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load workspace"})
+		return
+	}
+
+	nodeID := run.Paused.NodeID
+	done, err := runEngine.Resume(ws, run, req.Inputs, step)
+	if err != nil {
+		if errors.Is(err, engine.ErrRunNotPaused) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Run is not paused"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resume run"})
+		return
+	}
+
+	if req.Wait || c.Query("wait") == "true" {
+		select {
+		case run = <-done:
+			c.JSON(http.StatusOK, run)
+		case <-c.Request.Context().Done():
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"id": run.ID, "status": engine.StatusRunning, "resumed": nodeID})
+}
+
+// loadPausedRun fetches the run named in the URL, writing an error response
+// unless it is paused
+func loadPausedRun(c *gin.Context) (*engine.Run, bool) {
+	id, err := uuid.Parse(c.Param("runId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid run ID"})
+		return nil, false
+	}
+
+	run, err := runStore.GetRun(id)
+	if err != nil {
+		if errors.Is(err, engine.ErrRunNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Run not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch run"})
+		return nil, false
+	}
+
+	if run.Status != engine.StatusPaused || run.Paused == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Run is not paused", "status": run.Status})
+		return nil, false
+	}
+
+	return run, true
+}
+
+// PurgeCache handles removing every cached node output of a workspace
+func PurgeCache(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid workspace ID"})
+		return
+	}
+
+	purged, err := runEngine.PurgeCache(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to purge cache"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"purged": purged})
+}
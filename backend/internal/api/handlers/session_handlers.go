@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/xizko39/nodeloom/internal/engine"
+)
+
+var sessionStore engine.SessionStore
+
+// InitSessionHandlers sets the store the session handlers read from
+func InitSessionHandlers(store engine.SessionStore) {
+	sessionStore = store
+}
+
+// GetSession handles fetching the chat history memory nodes of a workspace
+// keep for a session
+func GetSession(c *gin.Context) {
+	workspaceID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid workspace ID"})
+		return
+	}
+
+	session, err := sessionStore.GetSession(workspaceID, c.Param("sessionId"))
+	if err != nil {
+		if errors.Is(err, engine.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
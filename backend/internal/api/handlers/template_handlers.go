@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/xizko39/nodeloom/internal/workspace"
+)
+
+// GetTemplates handles listing the template gallery
+func GetTemplates(c *gin.Context) {
+	templates, err := workspaceService.ListTemplates()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch templates"})
+		return
+	}
+
+	c.JSON(http.StatusOK, templates)
+}
+
+// TemplateAction dispatches custom methods of the form POST /templates/:id:<method>
+func TemplateAction(c *gin.Context) {
+	rawID, method := splitCustomMethod(c.Param("id"))
+	id, err := uuid.Parse(rawID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template ID"})
+		return
+	}
+
+	switch method {
+	case "instantiate":
+		InstantiateTemplate(c, id)
+	default:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown template action"})
+	}
+}
+
+// InstantiateTemplate handles creating a new workspace from a template
+func InstantiateTemplate(c *gin.Context, id uuid.UUID) {
+	var req struct {
+		Name       string                 `json:"name"`
+		OwnerID    *uuid.UUID             `json:"owner_id"`
+		OrgID      *uuid.UUID             `json:"org_id"`
+		Parameters map[string]interface{} `json:"parameters"`
+	}
+
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	ws, err := workspaceService.InstantiateTemplate(id, req.Parameters, workspace.CloneOptions{
+		Name:    req.Name,
+		OwnerID: req.OwnerID,
+		OrgID:   req.OrgID,
+	})
+	if err != nil {
+		var missing *workspace.MissingParametersError
+		switch {
+		case errors.As(err, &missing):
+			// Tell the client which parameters to prompt the user for
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error":      missing.Error(),
+				"parameters": missing.Parameters,
+			})
+		case errors.Is(err, workspace.ErrWorkspaceNotFound), errors.Is(err, workspace.ErrNotATemplate):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to instantiate template"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, ws)
+}
+
+// PublishTemplate handles flagging a workspace as a template
+func PublishTemplate(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid workspace ID"})
+		return
+	}
+
+	var info workspace.TemplateInfo
+	if err := c.ShouldBindJSON(&info); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if info.Title == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Template title is required"})
+		return
+	}
+
+	ws, err := workspaceService.PublishTemplate(id, info)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ws)
+}
+
+// UnpublishTemplate handles removing a workspace from the template gallery
+func UnpublishTemplate(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid workspace ID"})
+		return
+	}
+
+	ws, err := workspaceService.UnpublishTemplate(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ws)
+}
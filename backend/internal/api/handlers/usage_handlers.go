@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/xizko39/nodeloom/internal/engine"
+	"github.com/xizko39/nodeloom/internal/workspace"
+)
+
+// GetUsage handles reporting the tokens and cost of LLM calls made by runs,
+// in total, per workspace and per user. ?workspace_id=, ?user=, ?since= and
+// ?until= (RFC 3339 times) narrow the runs covered; ?user=me selects the
+// current user.
+func GetUsage(c *gin.Context) {
+	var filter engine.UsageFilter
+
+	if raw := c.Query("workspace_id"); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid workspace ID"})
+			return
+		}
+		filter.WorkspaceID = &id
+	}
+
+	filter.User = c.Query("user")
+	if filter.User == "me" {
+		filter.User = c.GetString("username")
+	}
+
+	for param, dst := range map[string]**time.Time{"since": &filter.Since, "until": &filter.Until} {
+		raw := c.Query(param)
+		if raw == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param + " time; expected RFC 3339"})
+			return
+		}
+		*dst = &t
+	}
+
+	report, err := runEngine.Usage(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch usage"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// PutBudget handles setting what a workspace's runs may spend on LLM calls
+// in total, in US dollars. A budget of zero removes the limit.
+func PutBudget(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid workspace ID"})
+		return
+	}
+
+	var req struct {
+		Budget *float64 `json:"budget" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if *req.Budget < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Budget must not be negative"})
+		return
+	}
+
+	ws, err := workspaceService.SetBudget(id, *req.Budget)
+	if err != nil {
+		if errors.Is(err, workspace.ErrWorkspaceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update budget"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ws)
+}
@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -106,6 +108,100 @@ func DeleteWorkspace(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
+// splitCustomMethod splits a path parameter such as "<id>:clone" into the
+// resource ID and the custom method name
+func splitCustomMethod(param string) (string, string) {
+	if i := strings.LastIndex(param, ":"); i >= 0 {
+		return param[:i], param[i+1:]
+	}
+	return param, ""
+}
+
+// WorkspaceAction dispatches custom methods of the form POST /workspaces/:id:<method>
+func WorkspaceAction(c *gin.Context) {
+	rawID, method := splitCustomMethod(c.Param("id"))
+	id, err := uuid.Parse(rawID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid workspace ID"})
+		return
+	}
+
+	switch method {
+	case "clone":
+		CloneWorkspace(c, id)
+	case "publish":
+		PublishRevision(c, id)
+	default:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown workspace action"})
+	}
+}
+
+// CloneWorkspace handles deep-copying a workspace into a new one
+func CloneWorkspace(c *gin.Context, id uuid.UUID) {
+	var req struct {
+		Name    string     `json:"name"`
+		OwnerID *uuid.UUID `json:"owner_id"`
+		OrgID   *uuid.UUID `json:"org_id"`
+	}
+
+	// The body is optional; an empty request clones under the same owner
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	clone, err := workspaceService.CloneWorkspace(id, workspace.CloneOptions{
+		Name:    req.Name,
+		OwnerID: req.OwnerID,
+		OrgID:   req.OrgID,
+	})
+	if err != nil {
+		if errors.Is(err, workspace.ErrWorkspaceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clone workspace"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, clone)
+}
+
+// PublishRevision handles snapshotting a workspace as its next revision,
+// which subflow nodes can pin
+func PublishRevision(c *gin.Context, id uuid.UUID) {
+	revision, err := workspaceService.PublishRevision(id, c.GetString("username"))
+	if err != nil {
+		if errors.Is(err, workspace.ErrWorkspaceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to publish revision"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, revision)
+}
+
+// GetRevisions handles listing the published revisions of a workspace
+func GetRevisions(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid workspace ID"})
+		return
+	}
+
+	revisions, err := workspaceService.ListRevisions(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch revisions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, revisions)
+}
+
 // AddNode handles adding a new node to a workspace
 func AddNode(c *gin.Context) {
 	workspaceID, err := uuid.Parse(c.Param("id"))
@@ -115,9 +211,10 @@ func AddNode(c *gin.Context) {
 	}
 
 	var req struct {
-		Type     workspace.NodeType `json:"type" binding:"required"`
-		Label    string             `json:"label" binding:"required"`
-		Position workspace.Position `json:"position" binding:"required"`
+		Type     workspace.NodeType     `json:"type" binding:"required"`
+		Label    string                 `json:"label" binding:"required"`
+		Position workspace.Position     `json:"position" binding:"required"`
+		Data     map[string]interface{} `json:"data"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -125,7 +222,29 @@ func AddNode(c *gin.Context) {
 		return
 	}
 
-	node, err := workspaceService.AddNode(workspaceID, req.Type, req.Label, req.Position)
+	// Templates and expressions are checked before the node is saved, which
+	// needs the workspace's partials
+	var partials workspace.Partials
+	if len(req.Data) > 0 {
+		ws, err := workspaceService.GetWorkspace(workspaceID)
+		if err != nil {
+			if errors.Is(err, workspace.ErrWorkspaceNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get workspace"})
+			return
+		}
+		partials = ws.Partials
+	}
+
+	candidate := workspace.Node{Type: req.Type, Label: req.Label, Data: req.Data}
+	if problems := workspace.ValidateNode(&candidate, partials); len(problems) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid node", "problems": problems})
+		return
+	}
+
+	node, err := workspaceService.AddNode(workspaceID, req.Type, req.Label, req.Position, req.Data)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add node"})
 		return
@@ -134,6 +253,70 @@ func AddNode(c *gin.Context) {
 	c.JSON(http.StatusCreated, node)
 }
 
+// UpdateNode handles changing a node's label, data or position
+func UpdateNode(c *gin.Context) {
+	workspaceID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid workspace ID"})
+		return
+	}
+
+	nodeID, err := uuid.Parse(c.Param("nodeId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid node ID"})
+		return
+	}
+
+	var req workspace.NodeUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ws, err := workspaceService.GetWorkspace(workspaceID)
+	if err != nil {
+		if errors.Is(err, workspace.ErrWorkspaceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get workspace"})
+		return
+	}
+
+	var current *workspace.Node
+	for i := range ws.Nodes {
+		if ws.Nodes[i].ID == nodeID {
+			current = &ws.Nodes[i]
+			break
+		}
+	}
+	if current == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+		return
+	}
+
+	if req.Data != nil {
+		candidate := *current
+		candidate.Data = req.Data
+		if problems := workspace.ValidateNode(&candidate, ws.Partials); len(problems) > 0 {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid node", "problems": problems})
+			return
+		}
+	}
+
+	node, err := workspaceService.UpdateNode(workspaceID, nodeID, req)
+	if err != nil {
+		if errors.Is(err, workspace.ErrNodeNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update node"})
+		return
+	}
+
+	c.JSON(http.StatusOK, node)
+}
+
 // RemoveNode handles removing a specific node from a workspace
 func RemoveNode(c *gin.Context) {
 	workspaceID, err := uuid.Parse(c.Param("id"))
@@ -166,8 +349,10 @@ func AddEdge(c *gin.Context) {
 	}
 
 	var req struct {
-		Source uuid.UUID `json:"source" binding:"required"`
-		Target uuid.UUID `json:"target" binding:"required"`
+		Source       uuid.UUID `json:"source" binding:"required"`
+		Target       uuid.UUID `json:"target" binding:"required"`
+		SourceHandle string    `json:"source_handle"`
+		TargetHandle string    `json:"target_handle"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -175,7 +360,7 @@ func AddEdge(c *gin.Context) {
 		return
 	}
 
-	edge, err := workspaceService.AddEdge(workspaceID, req.Source, req.Target)
+	edge, err := workspaceService.AddEdge(workspaceID, req.Source, req.Target, req.SourceHandle, req.TargetHandle)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add edge"})
 		return
@@ -206,3 +391,72 @@ func RemoveEdge(c *gin.Context) {
 
 	c.Status(http.StatusNoContent)
 }
+
+// LayoutWorkspace handles automatically positioning the nodes of a workspace
+func LayoutWorkspace(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid workspace ID"})
+		return
+	}
+
+	var req struct {
+		workspace.LayoutOptions
+		DryRun bool `json:"dry_run"`
+	}
+
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if req.Direction != "" && req.Direction != workspace.LayoutLeftToRight && req.Direction != workspace.LayoutTopToBottom {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Direction must be LR or TB"})
+		return
+	}
+
+	dryRun := req.DryRun || c.Query("dry_run") == "true"
+
+	positions, err := workspaceService.LayoutWorkspace(id, req.LayoutOptions, dryRun)
+	if err != nil {
+		if errors.Is(err, workspace.ErrWorkspaceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to lay out workspace"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"dry_run":   dryRun,
+		"positions": positions,
+	})
+}
+
+// ValidateWorkspace handles checking every node and edge of a workspace,
+// reporting template and expression errors with their positions
+func ValidateWorkspace(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid workspace ID"})
+		return
+	}
+
+	ws, err := workspaceService.GetWorkspace(id)
+	if err != nil {
+		if errors.Is(err, workspace.ErrWorkspaceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get workspace"})
+		return
+	}
+
+	problems := workspace.Validate(ws)
+	c.JSON(http.StatusOK, gin.H{
+		"valid":    len(problems) == 0,
+		"problems": problems,
+	})
+}
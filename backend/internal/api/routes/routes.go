@@ -36,9 +36,70 @@ func SetupRoutes(router *gin.Engine) {
 		workspaces.PUT("/:id", handlers.UpdateWorkspace)
 		workspaces.DELETE("/:id", handlers.DeleteWorkspace)
 
+		// Custom methods such as POST /workspaces/:id:clone and :publish
+		workspaces.POST("/:id", handlers.WorkspaceAction)
+
+		// Published revisions, pinned by subflow nodes
+		workspaces.GET("/:id/revisions", handlers.GetRevisions)
+
+		// Automatic layout
+		workspaces.POST("/:id/layout", handlers.LayoutWorkspace)
+
+		// Template and expression checks
+		workspaces.POST("/:id/validate", handlers.ValidateWorkspace)
+
+		// Portable export and import
+		workspaces.GET("/:id/export", handlers.ExportWorkspace)
+		protected.POST("/workspaces:import", handlers.ImportWorkspace)
+
+		// Execution
+		workspaces.POST("/:id/runs", handlers.StartRun)
+		workspaces.GET("/:id/runs", handlers.GetRuns)
+		workspaces.DELETE("/:id/cache", handlers.PurgeCache)
+
+		runs := protected.Group("/runs")
+		runs.GET("/:runId", handlers.GetRun)
+		runs.POST("/:runId", handlers.RunAction)
+		runs.GET("/:runId/events", handlers.StreamRun)
+
+		// Breakpoint debugging
+		runs.GET("/:runId/paused", handlers.GetPausedRun)
+		runs.POST("/:runId/resume", handlers.ResumeRun)
+		runs.POST("/:runId/step", handlers.StepRun)
+
+		// Language models available to LLM nodes
+		protected.GET("/models", handlers.GetModels)
+
+		// Token and cost accounting
+		protected.GET("/usage", handlers.GetUsage)
+		workspaces.PUT("/:id/budget", handlers.PutBudget)
+
+		// Human-in-the-loop approvals
+		approvals := protected.Group("/approvals")
+		approvals.GET("", handlers.GetApprovals)
+		approvals.GET("/:id", handlers.GetApproval)
+		approvals.POST("/:id", handlers.ApprovalAction)
+
+		// Chat history kept by memory nodes
+		workspaces.GET("/:id/sessions/:sessionId", handlers.GetSession)
+
+		// Template gallery
+		workspaces.PUT("/:id/template", handlers.PublishTemplate)
+		workspaces.DELETE("/:id/template", handlers.UnpublishTemplate)
+
+		templates := protected.Group("/templates")
+		templates.GET("", handlers.GetTemplates)
+		templates.POST("/:id", handlers.TemplateAction)
+
 		// Node operations
 		workspaces.POST("/:id/nodes", handlers.AddNode)
+		workspaces.PUT("/:id/nodes/:nodeId", handlers.UpdateNode)
 		workspaces.DELETE("/:id/nodes/:nodeId", handlers.RemoveNode)
+		workspaces.POST("/:id/nodes/:nodeId/render", handlers.RenderNode)
+
+		// Prompt partials
+		workspaces.PUT("/:id/partials/:name", handlers.PutPartial)
+		workspaces.DELETE("/:id/partials/:name", handlers.DeletePartial)
 
 		// Edge operations
 		workspaces.POST("/:id/edges", handlers.AddEdge)
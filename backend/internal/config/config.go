@@ -7,6 +7,7 @@ import (
 type Config struct {
 	Server   ServerConfig
 	Supabase SupabaseConfig
+	LLM      LLMConfig
 }
 
 type ServerConfig struct {
@@ -19,6 +20,51 @@ type SupabaseConfig struct {
 	Key string
 }
 
+// LLMConfig lists the LLM providers flows may use, keyed by the name nodes
+// refer to them by, and the prices of their models
+type LLMConfig struct {
+	DefaultProvider  string `mapstructure:"default_provider"`
+	OverrideProvider string `mapstructure:"override_provider"` // Serves every request, whatever provider a node names
+	Providers        map[string]ProviderConfig
+	Prices           []PriceConfig
+}
+
+// ProviderConfig configures one provider. The limits are shared by every
+// run using the provider; zero means no limit.
+type ProviderConfig struct {
+	Type    string // Provider family: "ollama", "anthropic" or "mock"
+	BaseURL string `mapstructure:"base_url"`
+	APIKey  string `mapstructure:"api_key"`
+	Timeout int    // Seconds; zero means no limit
+
+	// Mock providers only
+	Fixture string // Script and recordings file, YAML or JSON
+	Record  string // Provider whose replies are recorded to the fixture
+	Latency int    // Milliseconds added to every reply
+
+	RequestsPerMinute int             `mapstructure:"requests_per_minute"`
+	TokensPerMinute   int             `mapstructure:"tokens_per_minute"`
+	MaxConcurrent     int             `mapstructure:"max_concurrent"`
+	Fallback          *FallbackConfig // Where requests go when this provider fails
+}
+
+// FallbackConfig names the provider, and optionally the model, requests
+// fail over to
+type FallbackConfig struct {
+	Provider string
+	Model    string
+}
+
+// PriceConfig is the price of a model in US dollars per million tokens. A
+// model ending in "*" prices every model with that prefix; an empty provider
+// applies to every provider.
+type PriceConfig struct {
+	Provider   string
+	Model      string
+	Prompt     float64
+	Completion float64
+}
+
 func LoadConfig() (*Config, error) {
 	viper.SetConfigName("config")
 	viper.SetConfigType("yaml")
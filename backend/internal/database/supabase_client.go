@@ -35,6 +35,16 @@ func NewSupabaseClient(url, key string) *SupabaseClient {
 
 // Request performs a generic HTTP request to Supabase
 func (c *SupabaseClient) Request(method, endpoint string, body interface{}) ([]byte, int, error) {
+	return c.do(method, endpoint, body, "return=representation")
+}
+
+// Upsert inserts rows into a table, replacing those whose primary key is
+// already present in a single statement
+func (c *SupabaseClient) Upsert(table string, body interface{}) ([]byte, int, error) {
+	return c.do("POST", table, body, "resolution=merge-duplicates,return=representation")
+}
+
+func (c *SupabaseClient) do(method, endpoint string, body interface{}, prefer string) ([]byte, int, error) {
 	if c.URL == "" {
 		return nil, 0, fmt.Errorf("supabase URL is empty")
 	}
@@ -60,7 +70,7 @@ func (c *SupabaseClient) Request(method, endpoint string, body interface{}) ([]b
 	req.Header.Set("apikey", c.Key)
 	req.Header.Set("Authorization", "Bearer "+c.Key)
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Prefer", "return=representation")
+	req.Header.Set("Prefer", prefer)
 
 	resp, err := c.HTTP.Do(req)
 	if err != nil {
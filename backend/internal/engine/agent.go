@@ -0,0 +1,128 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/xizko39/nodeloom/internal/llm"
+)
+
+// DefaultMaxSteps limits how many times an agent node asks the model to
+// continue after calling tools
+const DefaultMaxSteps = 10
+
+// agentExecutor lets a model call tools until it answers. Node data:
+//
+//	provider, model, system, prompt, temperature, max_tokens, stop: as for LLM nodes
+//	tools:     [{"type": "http_fetch" | "calculator" | "retriever" | "workspace", ...}]
+//	max_steps: model calls allowed before the node fails (default DefaultMaxSteps)
+//
+// Each tool accepts an optional "name" and "description" besides its own
+// settings. Tools run one at a time in the order the model asked for them; a
+// tool that fails reports its error to the model rather than failing the
+// node. Every call is recorded in the node's run record.
+//
+// The final reply text is emitted on the output port, the whole chat on
+// "messages" and token counts summed over all steps on "usage".
+type agentExecutor struct{}
+
+func (a *agentExecutor) Execute(ctx context.Context, nc *NodeContext) (map[string]interface{}, error) {
+	provider, err := nc.Engine.provider(nc.Node)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := chatRequest(nc.Node, nc.Inputs)
+	if err != nil {
+		return nil, err
+	}
+
+	tools, err := buildTools(nc)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]agentTool, len(tools))
+	for _, tool := range tools {
+		spec := tool.spec()
+		req.Tools = append(req.Tools, spec)
+		byName[spec.Name] = tool
+	}
+
+	var usage llm.Usage
+	maxSteps := dataInt(nc.Node, "max_steps", DefaultMaxSteps)
+	for step := 0; step < maxSteps; step++ {
+		resp, err := nc.Engine.chat(ctx, nc, provider, req, nil)
+		if err != nil {
+			return nil, err
+		}
+		usage.PromptTokens += resp.Usage.PromptTokens
+		usage.CompletionTokens += resp.Usage.CompletionTokens
+		req.Messages = append(req.Messages, resp.Message)
+
+		if len(resp.Message.ToolCalls) == 0 {
+			messages, err := toValue(req.Messages)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{
+				DefaultPort: resp.Message.Content,
+				"messages":  messages,
+				"usage": map[string]interface{}{
+					"prompt_tokens":     usage.PromptTokens,
+					"completion_tokens": usage.CompletionTokens,
+				},
+			}, nil
+		}
+
+		for _, call := range resp.Message.ToolCalls {
+			content, err := callTool(ctx, nc, byName[call.Name], call)
+			if err != nil {
+				return nil, err
+			}
+			req.Messages = append(req.Messages, llm.Message{Role: llm.RoleTool, ToolCallID: call.ID, Content: content})
+		}
+	}
+
+	return nil, fmt.Errorf("agent did not answer within %d steps", maxSteps)
+}
+
+// callTool runs one tool call, records it and returns the text sent back to
+// the model. Only cancellation of the run is returned as an error.
+func callTool(ctx context.Context, nc *NodeContext, tool agentTool, call llm.ToolCall) (string, error) {
+	invocation := ToolInvocation{
+		ID:        call.ID,
+		Tool:      call.Name,
+		Arguments: call.Arguments,
+		StartedAt: now(),
+	}
+
+	var result interface{}
+	var err error
+	if tool == nil {
+		err = fmt.Errorf("unknown tool %q", call.Name)
+	} else {
+		result, invocation.Run, err = tool.call(ctx, nc, call.Arguments)
+	}
+	invocation.FinishedAt = now()
+
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	if err != nil {
+		invocation.Error = err.Error()
+		nc.RecordToolCall(invocation)
+		return "error: " + err.Error(), nil
+	}
+	invocation.Result = result
+	nc.RecordToolCall(invocation)
+
+	if text, ok := result.(string); ok {
+		return text, nil
+	}
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
@@ -0,0 +1,453 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/xizko39/nodeloom/internal/database"
+)
+
+var (
+	ErrApprovalNotFound  = fmt.Errorf("approval not found")
+	ErrApprovalDecided   = fmt.Errorf("approval has already been decided")
+	ErrNotAnAssignee     = fmt.Errorf("user is not assigned to the approval")
+	ErrApprovalsDisabled = fmt.Errorf("approvals are not configured")
+)
+
+// ApprovalStatus is the state of an approval request
+type ApprovalStatus string
+
+const (
+	ApprovalPending   ApprovalStatus = "pending"
+	ApprovalApproved  ApprovalStatus = "approved"
+	ApprovalRejected  ApprovalStatus = "rejected"
+	ApprovalExpired   ApprovalStatus = "expired"
+	ApprovalCancelled ApprovalStatus = "cancelled" // The run waiting on it was cancelled
+)
+
+// Approval is a request for a person to approve, edit or reject the payload
+// an approval node received
+type Approval struct {
+	ID          uuid.UUID      `json:"id"`
+	RunID       uuid.UUID      `json:"run_id"`
+	WorkspaceID uuid.UUID      `json:"workspace_id"`
+	NodeID      uuid.UUID      `json:"node_id"`
+	Title       string         `json:"title"`
+	Message     string         `json:"message,omitempty"`
+	Assignees   []string       `json:"assignees"`
+	Payload     interface{}    `json:"payload"`
+	Result      interface{}    `json:"result,omitempty"` // Payload passed downstream, possibly edited
+	Status      ApprovalStatus `json:"status"`
+	OnExpiry    ApprovalStatus `json:"on_expiry"` // Decision applied when the approval expires
+	DecidedBy   string         `json:"decided_by,omitempty"`
+	Comment     string         `json:"comment,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
+	ExpiresAt   *time.Time     `json:"expires_at,omitempty"`
+	DecidedAt   *time.Time     `json:"decided_at,omitempty"`
+}
+
+// AssignedTo reports whether a user may decide the approval. Approvals
+// without assignees can be decided by anyone.
+func (a *Approval) AssignedTo(username string) bool {
+	if len(a.Assignees) == 0 {
+		return true
+	}
+	for _, assignee := range a.Assignees {
+		if assignee == username {
+			return true
+		}
+	}
+	return false
+}
+
+// ApprovalFilter narrows a listing of approvals. Empty fields match
+// everything. Assignee matches the approvals the user may decide, including
+// those without assignees.
+type ApprovalFilter struct {
+	Status   ApprovalStatus
+	Assignee string
+}
+
+// ApprovalStore persists approval requests. UpdateApproval records a
+// decision and must only succeed while the stored approval is still pending,
+// returning ErrApprovalDecided otherwise, so that of two concurrent decisions
+// only one is recorded and continues the run.
+type ApprovalStore interface {
+	CreateApproval(a *Approval) error
+	UpdateApproval(a *Approval) error
+	GetApproval(id uuid.UUID) (*Approval, error)
+	ListApprovals(filter ApprovalFilter) ([]Approval, error)
+}
+
+// Notifier tells assignees that an approval is waiting for them
+type Notifier interface {
+	NotifyApproval(a *Approval) error
+}
+
+// LogNotifier writes approval notifications to the server log
+type LogNotifier struct{}
+
+// NotifyApproval logs the approval request
+func (LogNotifier) NotifyApproval(a *Approval) error {
+	log.Printf("Approval %s (%q) is waiting for %v", a.ID, a.Title, a.Assignees)
+	return nil
+}
+
+// UseApprovals enables approval nodes, storing their requests in store and
+// announcing them through notifier
+func (e *Engine) UseApprovals(store ApprovalStore, notifier Notifier) {
+	e.approvals = store
+	e.notifier = notifier
+}
+
+// approvalExecutor suspends the run until a person decides on its input.
+// Node data:
+//
+//	title:      short description shown in the approvals list (defaults to the label)
+//	message:    instructions for the approver
+//	assignees:  usernames allowed to decide; anyone may decide when empty
+//	expires_in: seconds until the approval expires (optional)
+//	on_expiry:  "rejected" (default) or "approved"
+//
+// Approving emits the payload, or the approver's edited version, on the
+// output port and the decision on the "decision" port. Rejection fails the node.
+type approvalExecutor struct{}
+
+// Execute is only reached where a run cannot wait, such as inside a map or
+// loop sub-graph
+func (a *approvalExecutor) Execute(ctx context.Context, nc *NodeContext) (map[string]interface{}, error) {
+	return nil, fmt.Errorf("approval nodes cannot run inside embedded graphs")
+}
+
+// Wait records the approval request and notifies its assignees
+func (a *approvalExecutor) Wait(nc *NodeContext) (*uuid.UUID, error) {
+	e := nc.Engine
+	if e.approvals == nil {
+		return nil, ErrApprovalsDisabled
+	}
+
+	node := nc.Node
+	approval := &Approval{
+		ID:          uuid.New(),
+		RunID:       nc.Run.ID,
+		WorkspaceID: nc.Run.WorkspaceID,
+		NodeID:      node.ID,
+		Title:       dataString(node, "title", node.Label),
+		Message:     dataString(node, "message", ""),
+		Assignees:   []string{},
+		Payload:     singleInput(nc.Inputs),
+		Status:      ApprovalPending,
+		OnExpiry:    ApprovalStatus(dataString(node, "on_expiry", string(ApprovalRejected))),
+		CreatedAt:   time.Now().UTC(),
+	}
+	if approval.OnExpiry != ApprovalApproved && approval.OnExpiry != ApprovalRejected {
+		return nil, fmt.Errorf("on_expiry must be %q or %q", ApprovalApproved, ApprovalRejected)
+	}
+	if assignees, ok := node.Data["assignees"].([]interface{}); ok {
+		for _, assignee := range assignees {
+			approval.Assignees = append(approval.Assignees, fmt.Sprint(assignee))
+		}
+	}
+	if expiresIn := dataFloat(node, "expires_in", 0); expiresIn > 0 {
+		expires := approval.CreatedAt.Add(seconds(expiresIn))
+		approval.ExpiresAt = &expires
+	}
+
+	if err := e.approvals.CreateApproval(approval); err != nil {
+		return nil, err
+	}
+
+	if e.notifier != nil {
+		if err := e.notifier.NotifyApproval(approval); err != nil {
+			log.Printf("Failed to notify assignees of approval %s: %v", approval.ID, err)
+		}
+	}
+
+	return &approval.ID, nil
+}
+
+// Approve accepts a pending approval and continues its run. When edited is
+// set, payload replaces the payload sent downstream.
+func (e *Engine) Approve(id uuid.UUID, username string, payload interface{}, edited bool, comment string) (*Approval, error) {
+	approval, err := e.pendingApproval(id, username)
+	if err != nil {
+		return nil, err
+	}
+
+	approval.Result = approval.Payload
+	if edited {
+		approval.Result = payload
+	}
+	return e.decide(approval, ApprovalApproved, username, comment)
+}
+
+// Reject declines a pending approval, failing the node waiting on it
+func (e *Engine) Reject(id uuid.UUID, username, comment string) (*Approval, error) {
+	approval, err := e.pendingApproval(id, username)
+	if err != nil {
+		return nil, err
+	}
+	return e.decide(approval, ApprovalRejected, username, comment)
+}
+
+// ExpireApprovals applies the expiry decision to every pending approval
+// past its expiry time and returns how many were expired
+func (e *Engine) ExpireApprovals() (int, error) {
+	if e.approvals == nil {
+		return 0, nil
+	}
+
+	pending, err := e.approvals.ListApprovals(ApprovalFilter{Status: ApprovalPending})
+	if err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for i := range pending {
+		approval := &pending[i]
+		if !approval.expired() {
+			continue
+		}
+		if approval.OnExpiry == ApprovalApproved {
+			approval.Result = approval.Payload
+		}
+		if _, err := e.decide(approval, ApprovalExpired, "", "expired"); err != nil {
+			log.Printf("Failed to expire approval %s: %v", approval.ID, err)
+			continue
+		}
+		expired++
+	}
+
+	return expired, nil
+}
+
+// WatchApprovals expires overdue approvals every interval until ctx is done
+func (e *Engine) WatchApprovals(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := e.ExpireApprovals(); err != nil {
+				log.Printf("Failed to expire approvals: %v", err)
+			}
+		}
+	}
+}
+
+// cancelApproval withdraws the pending approval a cancelled run was waiting on
+func (e *Engine) cancelApproval(id uuid.UUID) error {
+	if e.approvals == nil {
+		return nil
+	}
+
+	approval, err := e.approvals.GetApproval(id)
+	if errors.Is(err, ErrApprovalNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if approval.Status != ApprovalPending {
+		return nil
+	}
+
+	approval.Status = ApprovalCancelled
+	approval.Comment = "run cancelled"
+	approval.DecidedAt = now()
+	if err := e.approvals.UpdateApproval(approval); err != nil && !errors.Is(err, ErrApprovalDecided) {
+		return err
+	}
+	return nil
+}
+
+func (a *Approval) expired() bool {
+	return a.ExpiresAt != nil && time.Now().After(*a.ExpiresAt)
+}
+
+// pendingApproval loads an approval the user may still decide
+func (e *Engine) pendingApproval(id uuid.UUID, username string) (*Approval, error) {
+	if e.approvals == nil {
+		return nil, ErrApprovalsDisabled
+	}
+
+	approval, err := e.approvals.GetApproval(id)
+	if err != nil {
+		return nil, err
+	}
+	if approval.Status != ApprovalPending {
+		return nil, ErrApprovalDecided
+	}
+	if approval.expired() {
+		// Settle it the way the sweeper would have
+		if _, err := e.ExpireApprovals(); err != nil {
+			log.Printf("Failed to expire approvals: %v", err)
+		}
+		return nil, ErrApprovalDecided
+	}
+	if !approval.AssignedTo(username) {
+		return nil, ErrNotAnAssignee
+	}
+
+	return approval, nil
+}
+
+// decide records a decision and hands the node's result to its run
+func (e *Engine) decide(approval *Approval, status ApprovalStatus, username, comment string) (*Approval, error) {
+	approval.Status = status
+	approval.DecidedBy = username
+	approval.Comment = comment
+	approval.DecidedAt = now()
+
+	if err := e.approvals.UpdateApproval(approval); err != nil {
+		return nil, err
+	}
+
+	var outputs map[string]interface{}
+	var nodeErr error
+
+	approved := status == ApprovalApproved || (status == ApprovalExpired && approval.OnExpiry == ApprovalApproved)
+	switch {
+	case approved:
+		outputs = map[string]interface{}{
+			DefaultPort: approval.Result,
+			"decision": map[string]interface{}{
+				"status":     string(status),
+				"decided_by": username,
+				"comment":    comment,
+			},
+		}
+	case status == ApprovalExpired:
+		nodeErr = fmt.Errorf("approval %q expired", approval.Title)
+	default:
+		nodeErr = fmt.Errorf("approval %q rejected by %s", approval.Title, username)
+		if comment != "" {
+			nodeErr = fmt.Errorf("%w: %s", nodeErr, comment)
+		}
+	}
+
+	if _, err := e.CompleteWaiting(approval.RunID, approval.NodeID, outputs, nodeErr); err != nil {
+		return approval, fmt.Errorf("approval recorded but the run could not continue: %w", err)
+	}
+
+	return approval, nil
+}
+
+// SupabaseApprovalStore stores approvals in the Supabase "approvals" table
+type SupabaseApprovalStore struct {
+	client *database.SupabaseClient
+}
+
+// NewSupabaseApprovalStore initializes a new Supabase-based ApprovalStore
+func NewSupabaseApprovalStore(client *database.SupabaseClient) *SupabaseApprovalStore {
+	return &SupabaseApprovalStore{
+		client: client,
+	}
+}
+
+// CreateApproval inserts a new approval request
+func (s *SupabaseApprovalStore) CreateApproval(a *Approval) error {
+	body, status, err := s.client.Request("POST", "approvals", a)
+	if err != nil {
+		return err
+	}
+
+	if status != http.StatusCreated {
+		log.Printf("Supabase returned status %d: %s", status, string(body))
+		return fmt.Errorf("failed to create approval: %s", string(body))
+	}
+
+	return nil
+}
+
+// UpdateApproval overwrites an approval request that is still pending. The
+// client asks for the updated rows back, so an empty result means another
+// decision got there first.
+func (s *SupabaseApprovalStore) UpdateApproval(a *Approval) error {
+	endpoint := fmt.Sprintf("approvals?id=eq.%s&status=eq.%s", a.ID.String(), ApprovalPending)
+	body, status, err := s.client.Request("PATCH", endpoint, a)
+	if err != nil {
+		return err
+	}
+
+	if status != http.StatusOK {
+		log.Printf("Supabase returned status %d: %s", status, string(body))
+		return fmt.Errorf("failed to update approval: %s", string(body))
+	}
+
+	var updated []Approval
+	if err := json.Unmarshal(body, &updated); err != nil {
+		return err
+	}
+
+	if len(updated) == 0 {
+		return ErrApprovalDecided
+	}
+
+	return nil
+}
+
+// GetApproval retrieves a single approval request
+func (s *SupabaseApprovalStore) GetApproval(id uuid.UUID) (*Approval, error) {
+	body, status, err := s.client.Request("GET", fmt.Sprintf("approvals?id=eq.%s", id.String()), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK {
+		log.Printf("Supabase returned status %d: %s", status, string(body))
+		return nil, fmt.Errorf("failed to get approval: %s", string(body))
+	}
+
+	var approvals []Approval
+	if err := json.Unmarshal(body, &approvals); err != nil {
+		return nil, err
+	}
+
+	if len(approvals) == 0 {
+		return nil, ErrApprovalNotFound
+	}
+
+	return &approvals[0], nil
+}
+
+// ListApprovals retrieves approvals matching the filter, oldest first
+func (s *SupabaseApprovalStore) ListApprovals(filter ApprovalFilter) ([]Approval, error) {
+	query := url.Values{}
+	query.Set("order", "created_at.asc")
+	if filter.Status != "" {
+		query.Set("status", "eq."+string(filter.Status))
+	}
+	if filter.Assignee != "" {
+		// Approvals listing the user, and those without assignees that anyone may decide
+		encoded, _ := json.Marshal(filter.Assignee)
+		query.Set("or", fmt.Sprintf("(assignees.cs.{%s},assignees.eq.{})", encoded))
+	}
+
+	body, status, err := s.client.Request("GET", "approvals?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK {
+		log.Printf("Supabase returned status %d: %s", status, string(body))
+		return nil, fmt.Errorf("failed to fetch approvals: %s", string(body))
+	}
+
+	var approvals []Approval
+	if err := json.Unmarshal(body, &approvals); err != nil {
+		return nil, err
+	}
+
+	return approvals, nil
+}
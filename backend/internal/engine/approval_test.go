@@ -0,0 +1,54 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/xizko39/nodeloom/internal/llm"
+	"github.com/xizko39/nodeloom/internal/workspace"
+)
+
+func TestApprovalWaitsAfterBreakpoint(t *testing.T) {
+	ws := flow(
+		workspace.Node{Type: workspace.InputNode, Label: "draft"},
+		workspace.Node{Type: workspace.ApprovalNode, Label: "review", Data: map[string]interface{}{"breakpoint": true}},
+		workspace.Node{Type: workspace.OutputNode, Label: "published"},
+	)
+	e, store := mockEngine(t, &llm.Fixture{}, memoryWorkspaces{ws.ID: ws})
+	approvals := newMemoryApprovalStore()
+	e.UseApprovals(approvals, nil)
+
+	_, done, err := e.Start(ws, NewRun(ws.ID, map[string]interface{}{"draft": "Hello"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := (<-done).snapshot()
+	if run.Status != StatusPaused || run.Paused == nil || run.Paused.NodeID != ws.Nodes[1].ID {
+		t.Fatalf("status = %s, paused = %+v, want paused at the approval node", run.Status, run.Paused)
+	}
+
+	// Resuming past the breakpoint must still wait for a decision
+	done, err = e.Resume(ws, run, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run = (<-done).snapshot()
+	if run.Status != StatusWaiting || run.Paused == nil || run.Paused.WaitID == nil {
+		t.Fatalf("status = %s, error = %q, want waiting on an approval", run.Status, run.Error)
+	}
+
+	approval, err := approvals.GetApproval(*run.Paused.WaitID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if approval.Status != ApprovalPending || approval.Payload != "Hello" {
+		t.Errorf("approval = %+v", approval)
+	}
+
+	if _, err := e.Approve(approval.ID, "alice", nil, false, "looks good"); err != nil {
+		t.Fatal(err)
+	}
+	run = waitForRun(t, store, run.ID, StatusSucceeded, StatusFailed)
+	if run.Status != StatusSucceeded || run.Outputs["published"] != "Hello" {
+		t.Errorf("status = %s, error = %q, outputs = %v", run.Status, run.Error, run.Outputs)
+	}
+}
@@ -0,0 +1,103 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/xizko39/nodeloom/internal/expr"
+	"github.com/xizko39/nodeloom/internal/workspace"
+)
+
+// branchRoute is one conditional output of a branch node
+type branchRoute struct {
+	Port string
+	When string
+}
+
+// branchExecutor routes its input to the output ports whose "when"
+// expression holds. Node data:
+//
+//	routes:  [{"port": "spam", "when": "input.label == 'spam'"}, ...]
+//	default: port used when no route matches (optional)
+//	mode:    "first" (default) fires the first matching route, "all" fires every match
+//
+// Expressions see the node's inputs as "inputs" and the default input as "input".
+// Downstream nodes on ports that do not fire are skipped.
+type branchExecutor struct{}
+
+func (b *branchExecutor) Execute(ctx context.Context, nc *NodeContext) (map[string]interface{}, error) {
+	routes, err := parseRoutes(nc.Node)
+	if err != nil {
+		return nil, err
+	}
+
+	value := singleInput(nc.Inputs)
+	vars := map[string]interface{}{
+		"inputs": nc.Inputs,
+		"input":  nc.Inputs[DefaultInput],
+	}
+	matchAll := dataString(nc.Node, "mode", "first") == "all"
+
+	outputs := make(map[string]interface{})
+	for _, route := range routes {
+		result, err := expr.Eval(route.When, vars)
+		if err != nil {
+			return nil, fmt.Errorf("route %q: %w", route.Port, err)
+		}
+		if !expr.Truthy(result) {
+			continue
+		}
+		outputs[route.Port] = value
+		if !matchAll {
+			break
+		}
+	}
+
+	if len(outputs) == 0 {
+		if port := dataString(nc.Node, "default", ""); port != "" {
+			outputs[port] = value
+		}
+	}
+
+	return outputs, nil
+}
+
+func parseRoutes(node *workspace.Node) ([]branchRoute, error) {
+	raw, ok := node.Data["routes"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("branch node requires a list of routes")
+	}
+
+	routes := make([]branchRoute, 0, len(raw))
+	for i, item := range raw {
+		fields, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("route %d must be an object", i)
+		}
+		port, _ := fields["port"].(string)
+		when, _ := fields["when"].(string)
+		if port == "" || when == "" {
+			return nil, fmt.Errorf("route %d requires a port and a when expression", i)
+		}
+		routes = append(routes, branchRoute{Port: port, When: when})
+	}
+
+	return routes, nil
+}
+
+// mergeExecutor joins branches. With data mode "any" it proceeds as soon as
+// the first incoming branch completes; with "all" (default) it waits for
+// every incoming branch and proceeds with those that were taken. Its output
+// is the single value received, or a list when several branches arrived.
+type mergeExecutor struct{}
+
+func (m *mergeExecutor) JoinMode(node *workspace.Node) JoinMode {
+	if dataString(node, "mode", "all") == "any" {
+		return JoinAny
+	}
+	return JoinTaken
+}
+
+func (m *mergeExecutor) Execute(ctx context.Context, nc *NodeContext) (map[string]interface{}, error) {
+	return map[string]interface{}{DefaultPort: singleInput(nc.Inputs)}, nil
+}
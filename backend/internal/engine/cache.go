@@ -0,0 +1,180 @@
+package engine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/xizko39/nodeloom/internal/database"
+	"github.com/xizko39/nodeloom/internal/workspace"
+)
+
+// DefaultCacheTTL is how long cached outputs are kept when a node does not
+// set "cache_ttl"
+const DefaultCacheTTL = 24 * time.Hour
+
+// Cache stores node outputs by content hash
+type Cache interface {
+	// Get returns the outputs stored under key, if present and not expired
+	Get(key string) (map[string]interface{}, bool, error)
+	// Put stores outputs under key for ttl
+	Put(key string, workspaceID uuid.UUID, outputs map[string]interface{}, ttl time.Duration) error
+	// Purge removes every entry of a workspace and returns how many were removed
+	Purge(workspaceID uuid.UUID) (int, error)
+}
+
+// Cacheable is implemented by executors whose outputs depend only on the
+// node's kind, resolved data and inputs, so they may be served from the cache
+type Cacheable interface {
+	Cacheable(node *workspace.Node) bool
+}
+
+// cachePolicy decides whether a node's outputs are cached and for how long.
+// Node data can opt in or out with "cache": true|false and set the lifetime
+// in seconds with "cache_ttl"; otherwise executors implementing Cacheable
+// are cached for DefaultCacheTTL.
+func (e *Engine) cachePolicy(node *workspace.Node) (bool, time.Duration) {
+	if e.cache == nil {
+		return false, 0
+	}
+
+	enabled := false
+	if cacheable, ok := e.executors[node.Type].(Cacheable); ok {
+		enabled = cacheable.Cacheable(node)
+	}
+	if flag, ok := node.Data["cache"].(bool); ok {
+		enabled = flag
+	}
+
+	ttl := DefaultCacheTTL
+	if seconds := dataFloat(node, "cache_ttl", 0); seconds > 0 {
+		ttl = time.Duration(seconds * float64(time.Second))
+	}
+
+	return enabled, ttl
+}
+
+// cacheKey hashes a node's kind, resolved data and inputs. Keys are scoped
+// to the workspace so purging a workspace removes everything it produced.
+// JSON encoding sorts map keys, which makes the hash independent of order.
+func cacheKey(workspaceID uuid.UUID, node *workspace.Node, inputs map[string]interface{}) (string, error) {
+	data := make(map[string]interface{}, len(node.Data))
+	for k, v := range node.Data {
+		// Cache settings do not change what the node computes
+		if k != "cache" && k != "cache_ttl" {
+			data[k] = v
+		}
+	}
+
+	encoded, err := json.Marshal(map[string]interface{}{
+		"workspace_id": workspaceID,
+		"type":         node.Type,
+		"data":         data,
+		"inputs":       inputs,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// SupabaseCache stores cached outputs in the Supabase "node_cache" table,
+// whose primary key is key
+type SupabaseCache struct {
+	client *database.SupabaseClient
+}
+
+// NewSupabaseCache initializes a new Supabase-based Cache
+func NewSupabaseCache(client *database.SupabaseClient) *SupabaseCache {
+	return &SupabaseCache{
+		client: client,
+	}
+}
+
+type cacheEntry struct {
+	Key         string                 `json:"key"`
+	WorkspaceID uuid.UUID              `json:"workspace_id"`
+	Outputs     map[string]interface{} `json:"outputs"`
+	CreatedAt   time.Time              `json:"created_at"`
+	ExpiresAt   time.Time              `json:"expires_at"`
+}
+
+// Get fetches an unexpired cache entry
+func (s *SupabaseCache) Get(key string) (map[string]interface{}, bool, error) {
+	endpoint := fmt.Sprintf("node_cache?key=eq.%s&expires_at=gt.%s", key, time.Now().UTC().Format(time.RFC3339))
+	body, status, err := s.client.Request("GET", endpoint, nil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if status != http.StatusOK {
+		log.Printf("Supabase returned status %d: %s", status, string(body))
+		return nil, false, fmt.Errorf("failed to get cache entry: %s", string(body))
+	}
+
+	var entries []cacheEntry
+	if err := json.Unmarshal(body, &entries); err != nil {
+		return nil, false, err
+	}
+
+	if len(entries) == 0 {
+		return nil, false, nil
+	}
+
+	return entries[0].Outputs, true, nil
+}
+
+// Put inserts or replaces a cache entry. An expired entry under the same key
+// is overwritten in place, so concurrent writers never see it missing.
+func (s *SupabaseCache) Put(key string, workspaceID uuid.UUID, outputs map[string]interface{}, ttl time.Duration) error {
+	created := time.Now().UTC()
+	entry := cacheEntry{
+		Key:         key,
+		WorkspaceID: workspaceID,
+		Outputs:     outputs,
+		CreatedAt:   created,
+		ExpiresAt:   created.Add(ttl),
+	}
+
+	body, status, err := s.client.Upsert("node_cache", entry)
+	if err != nil {
+		return err
+	}
+
+	if status != http.StatusCreated && status != http.StatusOK {
+		log.Printf("Supabase returned status %d: %s", status, string(body))
+		return fmt.Errorf("failed to store cache entry: %s", string(body))
+	}
+
+	return nil
+}
+
+// Purge deletes every cache entry of a workspace
+func (s *SupabaseCache) Purge(workspaceID uuid.UUID) (int, error) {
+	endpoint := fmt.Sprintf("node_cache?workspace_id=eq.%s", workspaceID.String())
+	body, status, err := s.client.Request("DELETE", endpoint, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	if status != http.StatusOK && status != http.StatusNoContent {
+		log.Printf("Supabase returned status %d: %s", status, string(body))
+		return 0, fmt.Errorf("failed to purge cache: %s", string(body))
+	}
+
+	var deleted []cacheEntry
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &deleted); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(deleted), nil
+}
@@ -0,0 +1,56 @@
+package engine
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/xizko39/nodeloom/internal/database"
+)
+
+func TestSupabaseCachePutUpserts(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	rows := make(map[string]cacheEntry)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, r.Method+" "+r.URL.Path)
+
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		var entry cacheEntry
+		json.NewDecoder(r.Body).Decode(&entry)
+		if _, ok := rows[entry.Key]; ok && r.Header.Get("Prefer") != "resolution=merge-duplicates,return=representation" {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		rows[entry.Key] = entry
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode([]cacheEntry{entry})
+	}))
+	defer server.Close()
+	cache := NewSupabaseCache(database.NewSupabaseClient(server.URL, "test-key"))
+
+	workspaceID := uuid.New()
+	if err := cache.Put("k", workspaceID, map[string]interface{}{"output": "old"}, -time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Put("k", workspaceID, map[string]interface{}{"output": "new"}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(requests) != 2 || requests[0] != "POST /rest/v1/node_cache" || requests[1] != "POST /rest/v1/node_cache" {
+		t.Errorf("requests = %q, want one POST per Put", requests)
+	}
+	if entry := rows["k"]; entry.Outputs["output"] != "new" || !entry.ExpiresAt.After(time.Now()) {
+		t.Errorf("stored entry = %+v", entry)
+	}
+}
@@ -0,0 +1,130 @@
+package engine
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/xizko39/nodeloom/internal/workspace"
+)
+
+var (
+	// ErrRunNotPaused is returned when resuming a run that is not at a breakpoint
+	ErrRunNotPaused = fmt.Errorf("run is not paused")
+	// ErrRunNotWaiting is returned when completing a node the run is not waiting on
+	ErrRunNotWaiting = fmt.Errorf("run is not waiting on the node")
+)
+
+// shouldPause reports whether the run stops before executing a node. Runs
+// pause at nodes with "breakpoint": true in their data, at the run's own
+// breakpoints, and before every node while stepping. Nested runs never pause.
+func (x *execution) shouldPause(node *workspace.Node) bool {
+	if !x.persist || node.ID == x.resumeNode {
+		return false
+	}
+	if x.run.Stepping {
+		return true
+	}
+	if flag, ok := node.Data["breakpoint"].(bool); ok && flag {
+		return true
+	}
+	for _, id := range x.run.Breakpoints {
+		if id == node.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// pause records the inputs a node is stopped with. The run stops launching
+// nodes and pauses once those already in flight have finished.
+func (x *execution) pause(node *workspace.Node, inputs map[string]interface{}, reason PauseReason, waitID *uuid.UUID) {
+	x.run.Paused = &Pause{
+		NodeID:   node.ID,
+		Reason:   reason,
+		WaitID:   waitID,
+		Inputs:   inputs,
+		PausedAt: time.Now().UTC(),
+	}
+
+	nodeRun := x.run.Nodes[node.ID]
+	nodeRun.Status = x.run.Paused.status()
+	nodeRun.Inputs = inputs
+	x.save()
+}
+
+// Resume continues a paused run in the background. The paused node runs with
+// inputs, or with the inputs it paused with when inputs is nil. With step set
+// the run pauses again before the next node. The run may have been loaded
+// from the run store, so a run can be resumed by a different process than
+// the one that paused it.
+func (e *Engine) Resume(ws *workspace.Workspace, run *Run, inputs map[string]interface{}, step bool) (<-chan *Run, error) {
+	if run.Status != StatusPaused || run.Paused == nil {
+		return nil, ErrRunNotPaused
+	}
+	if !e.claim(run.ID) {
+		return nil, ErrRunNotPaused
+	}
+
+	pause := run.Paused
+	if inputs == nil {
+		inputs = pause.Inputs
+	}
+	run.Stepping = step
+
+	x := e.resumeExecution(ws, run)
+	x.resumeInputs = inputs
+	return e.background(x), nil
+}
+
+// claim marks a stopped run as in progress so that concurrent attempts to
+// continue it are refused. background takes over the claim.
+func (e *Engine) claim(runID uuid.UUID) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, active := e.active[runID]; active {
+		return false
+	}
+	e.active[runID] = func(error) {}
+	return true
+}
+
+// resumeExecution prepares the execution that continues a stopped run from
+// the node it stopped at
+func (e *Engine) resumeExecution(ws *workspace.Workspace, run *Run) *execution {
+	pause := run.Paused
+	if nodeRun, ok := run.Nodes[pause.NodeID]; ok {
+		nodeRun.Status = StatusPending
+	}
+	run.Paused = nil
+
+	x := newExecution(e, ws, run, true)
+	x.resumeNode = pause.NodeID
+	return x
+}
+
+// CompleteWaiting supplies the result of a node the run is waiting on and
+// continues the run in the background. A non-nil err fails the node.
+func (e *Engine) CompleteWaiting(runID, nodeID uuid.UUID, outputs map[string]interface{}, err error) (<-chan *Run, error) {
+	run, loadErr := e.store.GetRun(runID)
+	if loadErr != nil {
+		return nil, loadErr
+	}
+	if run.Status != StatusWaiting || run.Paused == nil || run.Paused.NodeID != nodeID {
+		return nil, ErrRunNotWaiting
+	}
+
+	ws, loadErr := e.workspaces.GetWorkspace(run.WorkspaceID)
+	if loadErr != nil {
+		return nil, loadErr
+	}
+
+	if !e.claim(run.ID) {
+		return nil, ErrRunNotWaiting
+	}
+
+	x := e.resumeExecution(ws, run)
+	x.resumeResult = &nodeResult{outputs: outputs, err: err}
+	return e.background(x), nil
+}
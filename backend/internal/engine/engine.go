@@ -0,0 +1,776 @@
+// Package engine executes workspaces. Nodes run as soon as all of their
+// inputs are available; independent nodes run concurrently.
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/xizko39/nodeloom/internal/llm"
+	"github.com/xizko39/nodeloom/internal/workspace"
+)
+
+const (
+	// DefaultPort is the output port used by edges without a source handle
+	DefaultPort = "output"
+	// DefaultInput is the input name used by edges without a target handle
+	DefaultInput = "input"
+)
+
+// NodeContext carries everything an executor needs to run a node. Run is
+// shared with the scheduler and must be treated as read-only.
+type NodeContext struct {
+	Run       *Run
+	Workspace *workspace.Workspace
+	Node      *workspace.Node
+	Inputs    map[string]interface{}
+	Engine    *Engine
+
+	mu         sync.Mutex
+	iterations []*Run
+	toolCalls  []ToolInvocation
+	streams    map[string]*Stream  // Streams opened on output ports, by port
+	opened     chan<- openedStream // Tells the scheduler about new streams
+	meter      *meter              // Usage of the node's LLM calls
+}
+
+// RecordIteration adds a finished iteration to the node's run record
+func (nc *NodeContext) RecordIteration(iteration *Run) {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	nc.iterations = append(nc.iterations, iteration)
+}
+
+// RecordToolCall adds a finished tool call to the node's run record
+func (nc *NodeContext) RecordToolCall(call ToolInvocation) {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	nc.toolCalls = append(nc.toolCalls, call)
+}
+
+// resetIterations drops iterations and tool calls recorded by an earlier attempt
+func (nc *NodeContext) resetIterations() {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	nc.iterations = nil
+	nc.toolCalls = nil
+}
+
+// Executor runs nodes of one type. The returned map holds a value for every
+// output port that fired; edges leaving ports without a value are not taken.
+type Executor interface {
+	Execute(ctx context.Context, nc *NodeContext) (map[string]interface{}, error)
+}
+
+// ExecutorFunc adapts a function to the Executor interface
+type ExecutorFunc func(ctx context.Context, nc *NodeContext) (map[string]interface{}, error)
+
+func (f ExecutorFunc) Execute(ctx context.Context, nc *NodeContext) (map[string]interface{}, error) {
+	return f(ctx, nc)
+}
+
+// JoinMode decides when a node with several incoming edges may run
+type JoinMode int
+
+const (
+	// JoinAll waits for every incoming edge and skips the node if any was not taken
+	JoinAll JoinMode = iota
+	// JoinAny runs the node as soon as one incoming edge carries a value
+	JoinAny
+	// JoinTaken waits for every incoming edge and runs if at least one was taken
+	JoinTaken
+)
+
+// Waiter is implemented by executors of nodes that wait on something outside
+// the run, such as a person. Instead of executing, the node suspends the run
+// with StatusWaiting; Engine.CompleteWaiting later supplies its result. Wait
+// returns the ID of what the node waits on.
+type Waiter interface {
+	Wait(nc *NodeContext) (*uuid.UUID, error)
+}
+
+// Joiner is implemented by executors that need a join mode other than JoinAll
+type Joiner interface {
+	JoinMode(node *workspace.Node) JoinMode
+}
+
+// Engine executes workspaces and records their runs
+type Engine struct {
+	store      RunStore
+	workspaces WorkspaceLoader
+	executors  map[workspace.NodeType]Executor
+	cache      Cache
+	approvals  ApprovalStore
+	notifier   Notifier
+	providers  *llm.Registry
+	sessions   SessionStore
+
+	sessionLocks sessionLocks
+
+	budgetMu sync.Mutex
+	budgets  map[uuid.UUID]*workspaceBudget // Meters shared by the runs of a workspace in progress
+
+	mu     sync.Mutex
+	active map[uuid.UUID]context.CancelCauseFunc // Cancel functions of runs in progress
+	events map[uuid.UUID]*eventLog               // Live events of runs in progress
+}
+
+// New creates an engine with the built-in node executors registered. The
+// loader is used to resolve subflow nodes.
+func New(store RunStore, workspaces WorkspaceLoader) *Engine {
+	e := &Engine{
+		store:      store,
+		workspaces: workspaces,
+		executors:  make(map[workspace.NodeType]Executor),
+		active:     make(map[uuid.UUID]context.CancelCauseFunc),
+		events:     make(map[uuid.UUID]*eventLog),
+		budgets:    make(map[uuid.UUID]*workspaceBudget),
+	}
+
+	e.Register(workspace.InputNode, ExecutorFunc(executeInput))
+	e.Register(workspace.OutputNode, &outputExecutor{})
+	e.Register(workspace.ProcessNode, &processExecutor{})
+	e.Register(workspace.BranchNode, &branchExecutor{})
+	e.Register(workspace.MergeNode, &mergeExecutor{})
+	e.Register(workspace.MapNode, &mapExecutor{})
+	e.Register(workspace.SubflowNode, &subflowExecutor{})
+	e.Register(workspace.LoopNode, &loopExecutor{})
+	e.Register(workspace.PromptNode, &promptExecutor{})
+	e.Register(workspace.ApprovalNode, &approvalExecutor{})
+	e.Register(workspace.LLMNode, &llmExecutor{})
+	e.Register(workspace.AgentNode, &agentExecutor{})
+	e.Register(workspace.ExtractNode, &extractExecutor{})
+	e.Register(workspace.MemoryNode, &memoryExecutor{})
+
+	return e
+}
+
+// Register sets the executor used for a node type
+func (e *Engine) Register(nodeType workspace.NodeType, executor Executor) {
+	e.executors[nodeType] = executor
+}
+
+// UseCache enables the node output cache
+func (e *Engine) UseCache(cache Cache) {
+	e.cache = cache
+}
+
+// PurgeCache removes the cached node outputs of a workspace
+func (e *Engine) PurgeCache(workspaceID uuid.UUID) (int, error) {
+	if e.cache == nil {
+		return 0, nil
+	}
+	return e.cache.Purge(workspaceID)
+}
+
+// Start records a run and executes it in the background. It returns a
+// snapshot of the pending run and a channel that receives the run once it
+// has finished or paused at a breakpoint. The run is stopped when it
+// exceeds its timeout or is cancelled. The runs of a workspace with a budget
+// share it, and ErrBudgetExceeded is returned once it is spent or reserved.
+func (e *Engine) Start(ws *workspace.Workspace, run *Run) (*Run, <-chan *Run, error) {
+	if err := e.checkBudget(ws); err != nil {
+		return nil, nil, err
+	}
+	if err := e.store.CreateRun(run); err != nil {
+		return nil, nil, err
+	}
+
+	snapshot := run.snapshot()
+	return snapshot, e.background(newExecution(e, ws, run, true)), nil
+}
+
+// background executes a run on its own goroutine, registering it so it can
+// be cancelled while in progress
+func (e *Engine) background(x *execution) <-chan *Run {
+	run := x.run
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	stop := func() {}
+	if run.Timeout > 0 {
+		timeout := seconds(run.Timeout)
+		ctx, stop = context.WithTimeoutCause(ctx, timeout, fmt.Errorf("%w after %s", ErrRunTimedOut, timeout))
+	}
+
+	history := newEventLog()
+	e.mu.Lock()
+	e.active[run.ID] = cancel
+	e.events[run.ID] = history
+	e.mu.Unlock()
+
+	done := make(chan *Run, 1)
+	go func() {
+		defer func() {
+			e.mu.Lock()
+			delete(e.active, run.ID)
+			delete(e.events, run.ID)
+			e.mu.Unlock()
+			stop()
+			cancel(nil)
+		}()
+
+		if err := x.execute(ctx); err != nil {
+			log.Printf("Run %s failed: %v", run.ID, err)
+		}
+		history.append(RunEvent{Type: EventDone, Run: run.snapshot()}, true)
+		done <- run
+	}()
+
+	return done
+}
+
+// Cancel stops a run in progress. In-flight nodes see their context
+// cancelled and the run finishes with StatusCancelled. A paused or waiting
+// run is marked cancelled in the run store, and the approval a waiting run
+// waits on is cancelled with it.
+func (e *Engine) Cancel(runID uuid.UUID) error {
+	e.mu.Lock()
+	cancel, ok := e.active[runID]
+	e.mu.Unlock()
+
+	if ok {
+		cancel(ErrRunCancelled)
+		return nil
+	}
+
+	run, err := e.store.GetRun(runID)
+	if err != nil {
+		return err
+	}
+	if run.Status != StatusPaused && run.Status != StatusWaiting {
+		return ErrRunNotActive
+	}
+
+	paused := run.Paused
+	if paused != nil {
+		if nodeRun, ok := run.Nodes[paused.NodeID]; ok {
+			nodeRun.Status = StatusCancelled
+		}
+	}
+	run.Status = StatusCancelled
+	run.Error = ErrRunCancelled.Error()
+	run.Paused = nil
+	run.FinishedAt = now()
+	if err := e.store.UpdateRun(run); err != nil {
+		return err
+	}
+
+	// Nobody should be left deciding an approval the run no longer waits on
+	if paused != nil && paused.Reason == PauseWaiting && paused.WaitID != nil {
+		if err := e.cancelApproval(*paused.WaitID); err != nil {
+			log.Printf("Failed to cancel approval %s of run %s: %v", *paused.WaitID, run.ID, err)
+		}
+	}
+	return nil
+}
+
+// Execute runs a workspace to completion, recording progress in run
+func (e *Engine) Execute(ctx context.Context, ws *workspace.Workspace, run *Run) error {
+	return newExecution(e, ws, run, true).execute(ctx)
+}
+
+// executeNested runs a graph on behalf of a node in another run. Nested runs
+// are not written to the run store.
+func (e *Engine) executeNested(ctx context.Context, ws *workspace.Workspace, run *Run) error {
+	return newExecution(e, ws, run, false).execute(ctx)
+}
+
+type edgeState int
+
+const (
+	edgePending edgeState = iota
+	edgeTaken
+	edgeNotTaken
+)
+
+type nodeResult struct {
+	nodeID    uuid.UUID
+	nc        *NodeContext
+	outputs   map[string]interface{}
+	attempts  []Attempt
+	cached    bool
+	cancelled bool
+	err       error
+}
+
+// execution holds the scheduling state of a single run
+type execution struct {
+	engine   *Engine
+	ws       *workspace.Workspace
+	run      *Run
+	nodes    map[uuid.UUID]*workspace.Node
+	incoming map[uuid.UUID][]int
+	outgoing map[uuid.UUID][]int
+	edges    []edgeState
+	values   []interface{}
+	persist  bool
+
+	// Set when resuming from a breakpoint: the paused node runs with the
+	// given inputs without pausing again
+	resumeNode   uuid.UUID
+	resumeInputs map[string]interface{}
+	resumeResult *nodeResult // Result of a waiting node, supplied when it completes
+
+	opened chan openedStream // Streams opened by running nodes
+	meter  *meter            // Usage of the run's LLM calls
+}
+
+func newExecution(e *Engine, ws *workspace.Workspace, run *Run, persist bool) *execution {
+	x := &execution{
+		engine:   e,
+		ws:       ws,
+		run:      run,
+		persist:  persist,
+		nodes:    make(map[uuid.UUID]*workspace.Node, len(ws.Nodes)),
+		incoming: make(map[uuid.UUID][]int),
+		outgoing: make(map[uuid.UUID][]int),
+		edges:    make([]edgeState, len(ws.Edges)),
+		values:   make([]interface{}, len(ws.Edges)),
+		opened:   make(chan openedStream),
+	}
+
+	for i := range ws.Nodes {
+		node := &ws.Nodes[i]
+		x.nodes[node.ID] = node
+		nodeRun, ok := run.Nodes[node.ID]
+		if !ok {
+			run.Nodes[node.ID] = &NodeRun{NodeID: node.ID, Status: StatusPending}
+		} else if nodeRun.Status == StatusRunning {
+			// Interrupted before it finished; run it again
+			nodeRun.Status = StatusPending
+		}
+	}
+
+	for i, edge := range ws.Edges {
+		if x.nodes[edge.Source] == nil || x.nodes[edge.Target] == nil {
+			// Edges to missing nodes can never fire
+			x.edges[i] = edgeNotTaken
+			continue
+		}
+		x.outgoing[edge.Source] = append(x.outgoing[edge.Source], i)
+		x.incoming[edge.Target] = append(x.incoming[edge.Target], i)
+	}
+
+	// Nodes already finished, such as those reused by a partial rerun, feed
+	// their results forward before anything is scheduled
+	for id, nodeRun := range run.Nodes {
+		switch nodeRun.Status {
+		case StatusSucceeded:
+			x.resolveEdges(id, nodeRun.Outputs)
+		case StatusSkipped:
+			for _, edge := range x.outgoing[id] {
+				x.edges[edge] = edgeNotTaken
+			}
+		}
+	}
+
+	return x
+}
+
+func (x *execution) execute(ctx context.Context) error {
+	parent := meterFrom(ctx)
+	if x.persist {
+		// Runs of the same workspace draw on its budget together
+		shared, release, err := x.engine.workspaceMeter(x.ws)
+		if err != nil {
+			x.run.Status = StatusFailed
+			x.run.Error = err.Error()
+			x.run.FinishedAt = now()
+			x.save()
+			return err
+		}
+		defer release()
+		if shared != nil {
+			parent = shared
+		}
+	}
+	x.meter = newMeter(parent, x.run.Budget, x.run.Usage)
+	x.run.Status = StatusRunning
+	if x.run.StartedAt == nil {
+		x.run.StartedAt = now()
+	}
+	x.save()
+
+	results := make(chan nodeResult)
+	running := 0
+	var failure error
+
+	for {
+		if failure == nil && ctx.Err() == nil && x.run.Paused == nil {
+			for _, node := range x.readyNodes() {
+				if x.run.Paused != nil {
+					// Hold everything else back until the run is resumed
+					x.run.Nodes[node.ID].Status = StatusPending
+					continue
+				}
+				if x.shouldPause(node) {
+					x.pause(node, x.gatherInputs(node), PauseBreakpoint, nil)
+					continue
+				}
+				if x.launch(ctx, node, results) {
+					running++
+				}
+			}
+		}
+
+		if running == 0 {
+			break
+		}
+
+		select {
+		case opened := <-x.opened:
+			// Consumers of the stream may start now
+			x.resolveStream(opened)
+		case res := <-results:
+			running--
+			// Errors caused by the run being stopped are not failures of the node
+			res.cancelled = res.err != nil && ctx.Err() != nil
+			x.complete(res)
+			if res.err != nil && !res.cancelled && failure == nil {
+				failure = fmt.Errorf("node %q failed: %w", x.nodes[res.nodeID].Label, res.err)
+			}
+			x.save()
+		}
+	}
+
+	if x.run.Paused != nil {
+		if failure == nil && ctx.Err() == nil {
+			// Nodes in flight have finished; wait to be resumed
+			x.run.Status = x.run.Paused.status()
+			x.save()
+			return nil
+		}
+		x.run.Nodes[x.run.Paused.NodeID].Status = StatusPending
+		if pause := x.run.Paused; pause.Reason == PauseWaiting && pause.WaitID != nil {
+			// The run stopped before anyone decided; withdraw the approval
+			if err := x.engine.cancelApproval(*pause.WaitID); err != nil {
+				log.Printf("Failed to cancel approval %s of run %s: %v", *pause.WaitID, x.run.ID, err)
+			}
+		}
+		x.run.Paused = nil
+	}
+
+	stopped := false
+	if failure == nil && ctx.Err() != nil {
+		failure = context.Cause(ctx)
+		stopped = true
+		for _, nodeRun := range x.run.Nodes {
+			if nodeRun.Status == StatusPending {
+				nodeRun.Status = StatusCancelled
+			}
+		}
+	}
+	if failure == nil {
+		for _, nodeRun := range x.run.Nodes {
+			if nodeRun.Status == StatusPending {
+				failure = fmt.Errorf("some nodes could not be scheduled; the graph contains a cycle")
+				break
+			}
+		}
+	}
+
+	x.collectOutputs()
+	x.run.FinishedAt = now()
+	switch {
+	case stopped && errors.Is(failure, ErrRunCancelled):
+		x.run.Status = StatusCancelled
+		x.run.Error = failure.Error()
+	case failure != nil:
+		x.run.Status = StatusFailed
+		x.run.Error = failure.Error()
+	default:
+		x.run.Status = StatusSucceeded
+	}
+	x.save()
+
+	return failure
+}
+
+// readyNodes marks pending nodes whose inputs are resolved as running and
+// returns them. Nodes that can no longer run are marked skipped, which may in
+// turn resolve further nodes.
+func (x *execution) readyNodes() []*workspace.Node {
+	var ready []*workspace.Node
+
+	for changed := true; changed; {
+		changed = false
+		for i := range x.ws.Nodes {
+			node := &x.ws.Nodes[i]
+			nodeRun := x.run.Nodes[node.ID]
+			if nodeRun.Status != StatusPending {
+				continue
+			}
+
+			run, skip := x.joinReady(node)
+			switch {
+			case skip:
+				nodeRun.Status = StatusSkipped
+				for _, edge := range x.outgoing[node.ID] {
+					x.edges[edge] = edgeNotTaken
+				}
+				changed = true
+			case run:
+				nodeRun.Status = StatusRunning
+				ready = append(ready, node)
+			}
+		}
+	}
+
+	return ready
+}
+
+// joinReady evaluates the node's join mode against the state of its incoming edges
+func (x *execution) joinReady(node *workspace.Node) (run bool, skip bool) {
+	edges := x.incoming[node.ID]
+	if len(edges) == 0 {
+		return true, false
+	}
+
+	taken, notTaken := 0, 0
+	for _, edge := range edges {
+		switch x.edges[edge] {
+		case edgeTaken:
+			taken++
+		case edgeNotTaken:
+			notTaken++
+		}
+	}
+	resolved := taken+notTaken == len(edges)
+
+	mode := JoinAll
+	if joiner, ok := x.engine.executors[node.Type].(Joiner); ok {
+		mode = joiner.JoinMode(node)
+	}
+
+	switch mode {
+	case JoinAny:
+		if taken > 0 {
+			return true, false
+		}
+		return false, resolved
+	case JoinTaken:
+		if !resolved {
+			return false, false
+		}
+		return taken > 0, taken == 0
+	default:
+		if notTaken > 0 {
+			return false, true
+		}
+		return resolved, false
+	}
+}
+
+// gatherInputs collects the values of taken incoming edges keyed by target
+// handle. Several edges into the same handle produce a list.
+func (x *execution) gatherInputs(node *workspace.Node) map[string]interface{} {
+	inputs := make(map[string]interface{})
+	counts := make(map[string]int)
+
+	for _, i := range x.incoming[node.ID] {
+		if x.edges[i] != edgeTaken {
+			continue
+		}
+		key := x.ws.Edges[i].TargetHandle
+		if key == "" {
+			key = DefaultInput
+		}
+
+		counts[key]++
+		switch counts[key] {
+		case 1:
+			inputs[key] = x.values[i]
+		case 2:
+			inputs[key] = []interface{}{inputs[key], x.values[i]}
+		default:
+			inputs[key] = append(inputs[key].([]interface{}), x.values[i])
+		}
+	}
+
+	return inputs
+}
+
+// launch starts executing a node on its own goroutine, which delivers the
+// result on results. It returns false when the node suspended the run
+// instead, as waiting nodes do.
+func (x *execution) launch(ctx context.Context, node *workspace.Node, results chan<- nodeResult) bool {
+	inputs := x.gatherInputs(node)
+	resuming := node.ID == x.resumeNode
+	if resuming && x.resumeInputs != nil {
+		inputs = x.resumeInputs
+	}
+
+	nodeRun := x.run.Nodes[node.ID]
+	nodeRun.Inputs = inputs
+	if nodeRun.StartedAt == nil || !resuming {
+		nodeRun.StartedAt = now()
+	}
+
+	executor, ok := x.engine.executors[node.Type]
+	resolved, resolveErr := resolveNode(node, x.ws.Partials, x.templateVars(inputs))
+	if resolveErr != nil {
+		resolved = node
+	}
+	nc := &NodeContext{Run: x.run, Workspace: x.ws, Node: resolved, Inputs: inputs, Engine: x.engine, opened: x.opened}
+	nc.meter = newMeter(x.meter, 0, nil)
+
+	// A waiting node resumes with the result supplied from outside the run
+	if resuming && x.resumeResult != nil {
+		res := *x.resumeResult
+		res.nodeID = node.ID
+		res.nc = nc
+		go func() { results <- res }()
+		return true
+	}
+
+	// A waiting node suspends the run, also when it was paused at a
+	// breakpoint first; only completing the wait above skips it
+	waiter, waits := executor.(Waiter)
+	if waits && x.persist && resolveErr == nil {
+		waitID, err := waiter.Wait(nc)
+		if err == nil {
+			x.pause(node, inputs, PauseWaiting, waitID)
+			return false
+		}
+		resolveErr = err
+	}
+
+	go func() {
+		if resolveErr != nil {
+			results <- nodeResult{nodeID: node.ID, nc: nc, err: resolveErr}
+			return
+		}
+		if !ok {
+			results <- nodeResult{nodeID: node.ID, nc: nc, err: fmt.Errorf("no executor for node type %q", node.Type)}
+			return
+		}
+		results <- x.executeCached(withMeter(ctx, nc.meter), executor, nc)
+	}()
+	return true
+}
+
+// executeCached runs a node, serving its outputs from the cache when the
+// node's cache policy allows. Cache failures are logged and otherwise ignored.
+func (x *execution) executeCached(ctx context.Context, executor Executor, nc *NodeContext) nodeResult {
+	node := nc.Node
+	enabled, ttl := x.engine.cachePolicy(node)
+	if hasStreams(nc.Inputs) {
+		// The key would only cover the text streamed so far
+		enabled = false
+	}
+
+	var key string
+	if enabled {
+		var err error
+		key, err = cacheKey(x.ws.ID, node, nc.Inputs)
+		if err != nil {
+			log.Printf("Failed to hash node %s for the cache: %v", node.ID, err)
+			enabled = false
+		}
+	}
+
+	if enabled {
+		outputs, hit, err := x.engine.cache.Get(key)
+		if err != nil {
+			log.Printf("Failed to read cache for node %s: %v", node.ID, err)
+		} else if hit {
+			return nodeResult{nodeID: node.ID, nc: nc, outputs: outputs, cached: true}
+		}
+	}
+
+	outputs, attempts, err := x.executeWithRetry(ctx, executor, nc)
+	outputs = nc.finishStreams(outputs, err)
+	if err == nil && enabled {
+		if putErr := x.engine.cache.Put(key, x.ws.ID, outputs, ttl); putErr != nil {
+			log.Printf("Failed to cache outputs of node %s: %v", node.ID, putErr)
+		}
+	}
+	return nodeResult{nodeID: node.ID, nc: nc, outputs: outputs, attempts: attempts, err: err}
+}
+
+// complete records a node's result and resolves its outgoing edges
+func (x *execution) complete(res nodeResult) {
+	nodeRun := x.run.Nodes[res.nodeID]
+	nodeRun.FinishedAt = now()
+	nodeRun.Iterations = res.nc.iterations
+	nodeRun.ToolCalls = res.nc.toolCalls
+	nodeRun.Attempts = res.attempts
+	nodeRun.Usage = res.nc.meter.total()
+	x.run.Usage = x.meter.total()
+
+	if res.err != nil {
+		nodeRun.Status = StatusFailed
+		if res.cancelled {
+			nodeRun.Status = StatusCancelled
+		}
+		nodeRun.Error = res.err.Error()
+		return
+	}
+
+	nodeRun.Status = StatusSucceeded
+	nodeRun.Outputs = res.outputs
+	nodeRun.Cached = res.cached
+	x.resolveEdges(res.nodeID, res.outputs)
+}
+
+// resolveEdges takes the outgoing edges of ports that produced a value
+func (x *execution) resolveEdges(nodeID uuid.UUID, outputs map[string]interface{}) {
+	for _, i := range x.outgoing[nodeID] {
+		port := x.ws.Edges[i].SourceHandle
+		if port == "" {
+			port = DefaultPort
+		}
+		if value, ok := outputs[port]; ok {
+			x.edges[i] = edgeTaken
+			x.values[i] = value
+		} else {
+			x.edges[i] = edgeNotTaken
+		}
+	}
+}
+
+// collectOutputs copies the values received by OUTPUT nodes into the run
+func (x *execution) collectOutputs() {
+	for i := range x.ws.Nodes {
+		node := &x.ws.Nodes[i]
+		nodeRun := x.run.Nodes[node.ID]
+		if node.Type != workspace.OutputNode || nodeRun.Status != StatusSucceeded {
+			continue
+		}
+		x.run.Outputs[node.PortName()] = nodeRun.Outputs[DefaultPort]
+	}
+}
+
+func (x *execution) save() {
+	if !x.persist || x.engine.store == nil {
+		return
+	}
+	if err := x.engine.store.UpdateRun(x.run); err != nil {
+		log.Printf("Failed to save run %s: %v", x.run.ID, err)
+	}
+}
+
+// snapshot copies the run so it can be handed out while execution continues
+func (r *Run) snapshot() *Run {
+	c := *r
+	c.Inputs = copyMap(r.Inputs)
+	c.Outputs = copyMap(r.Outputs)
+	c.Nodes = make(map[uuid.UUID]*NodeRun, len(r.Nodes))
+	for id, nodeRun := range r.Nodes {
+		copied := *nodeRun
+		c.Nodes[id] = &copied
+	}
+	return &c
+}
+
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
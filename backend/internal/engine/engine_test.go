@@ -0,0 +1,43 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/xizko39/nodeloom/internal/workspace"
+)
+
+func TestJoinReady(t *testing.T) {
+	e := New(newMemoryRunStore(), memoryWorkspaces{})
+	tests := []struct {
+		name  string
+		node  workspace.Node
+		edges []edgeState
+		run   bool
+		skip  bool
+	}{
+		{"no incoming edges", workspace.Node{Type: workspace.ProcessNode}, nil, true, false},
+		{"all: waiting", workspace.Node{Type: workspace.ProcessNode}, []edgeState{edgeTaken, edgePending}, false, false},
+		{"all: every edge taken", workspace.Node{Type: workspace.ProcessNode}, []edgeState{edgeTaken, edgeTaken}, true, false},
+		{"all: one edge not taken", workspace.Node{Type: workspace.ProcessNode}, []edgeState{edgeNotTaken, edgePending}, false, true},
+		{"any: waiting", workspace.Node{Type: workspace.MergeNode, Data: map[string]interface{}{"mode": "any"}}, []edgeState{edgeNotTaken, edgePending}, false, false},
+		{"any: first edge taken", workspace.Node{Type: workspace.MergeNode, Data: map[string]interface{}{"mode": "any"}}, []edgeState{edgePending, edgeTaken}, true, false},
+		{"any: nothing taken", workspace.Node{Type: workspace.MergeNode, Data: map[string]interface{}{"mode": "any"}}, []edgeState{edgeNotTaken, edgeNotTaken}, false, true},
+		{"taken: waiting", workspace.Node{Type: workspace.MergeNode}, []edgeState{edgeTaken, edgePending}, false, false},
+		{"taken: some taken", workspace.Node{Type: workspace.MergeNode}, []edgeState{edgeTaken, edgeNotTaken}, true, false},
+		{"taken: nothing taken", workspace.Node{Type: workspace.MergeNode}, []edgeState{edgeNotTaken, edgeNotTaken}, false, true},
+	}
+	for _, tt := range tests {
+		node := tt.node
+		node.ID = uuid.New()
+		x := &execution{engine: e, incoming: make(map[uuid.UUID][]int), edges: tt.edges}
+		for i := range tt.edges {
+			x.incoming[node.ID] = append(x.incoming[node.ID], i)
+		}
+
+		run, skip := x.joinReady(&node)
+		if run != tt.run || skip != tt.skip {
+			t.Errorf("%s: joinReady = (%v, %v), want (%v, %v)", tt.name, run, skip, tt.run, tt.skip)
+		}
+	}
+}
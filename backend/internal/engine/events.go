@@ -0,0 +1,111 @@
+package engine
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// Run event types
+const (
+	EventChunk = "chunk" // Text streamed into an OUTPUT node
+	EventDone  = "done"  // The run finished, paused or started waiting
+)
+
+// RunEvent is a live update about a run in progress
+type RunEvent struct {
+	Type   string     `json:"type"`
+	NodeID *uuid.UUID `json:"node_id,omitempty"`
+	Output string     `json:"output,omitempty"` // Name of the flow output a chunk belongs to
+	Text   string     `json:"text,omitempty"`
+	Run    *Run       `json:"run,omitempty"` // Set on the done event
+}
+
+// eventLog keeps every event of a run in progress so that subscribers
+// joining late can catch up
+type eventLog struct {
+	mu      sync.Mutex
+	events  []RunEvent
+	closed  bool
+	changed chan struct{}
+}
+
+func newEventLog() *eventLog {
+	return &eventLog{changed: make(chan struct{})}
+}
+
+func (l *eventLog) append(event RunEvent, last bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return
+	}
+	l.events = append(l.events, event)
+	l.closed = last
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// publish records an event for the subscribers of a run. Events of runs not
+// executing in the background, such as nested runs, are dropped.
+func (e *Engine) publish(runID uuid.UUID, event RunEvent) {
+	e.mu.Lock()
+	history := e.events[runID]
+	e.mu.Unlock()
+
+	if history != nil {
+		history.append(event, false)
+	}
+}
+
+// Subscribe returns the events of a run in progress, starting with those
+// already published, until the run stops or ctx is done. It reports false
+// when the run is not executing on this engine.
+func (e *Engine) Subscribe(ctx context.Context, runID uuid.UUID) (<-chan RunEvent, bool) {
+	e.mu.Lock()
+	history := e.events[runID]
+	e.mu.Unlock()
+
+	if history == nil {
+		return nil, false
+	}
+
+	events := make(chan RunEvent)
+	go func() {
+		defer close(events)
+
+		next := 0
+		for {
+			history.mu.Lock()
+			pending := history.events[next:]
+			closed := history.closed
+			changed := history.changed
+			history.mu.Unlock()
+
+			for _, event := range pending {
+				select {
+				case events <- event:
+					next++
+				case <-ctx.Done():
+					return
+				}
+			}
+			if len(pending) > 0 {
+				continue
+			}
+			if closed {
+				return
+			}
+
+			select {
+			case <-changed:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return events, true
+}
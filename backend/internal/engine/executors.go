@@ -0,0 +1,175 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/xizko39/nodeloom/internal/workspace"
+)
+
+// executeInput emits the run input named after the node, falling back to
+// the node's "default" data value
+func executeInput(ctx context.Context, nc *NodeContext) (map[string]interface{}, error) {
+	value, ok := nc.Run.Inputs[nc.Node.PortName()]
+	if !ok {
+		value = nc.Node.Data["default"]
+	}
+	return map[string]interface{}{DefaultPort: value}, nil
+}
+
+// outputExecutor passes its input through; the engine copies it into the run
+// outputs. A streaming input is forwarded chunk by chunk to the run's
+// subscribers as it arrives, so callers see the flow's output before the
+// upstream node has finished.
+type outputExecutor struct{}
+
+func (o *outputExecutor) AcceptsStreams(node *workspace.Node) bool {
+	return true
+}
+
+func (o *outputExecutor) Execute(ctx context.Context, nc *NodeContext) (map[string]interface{}, error) {
+	value := singleInput(nc.Inputs)
+
+	if stream, ok := value.(*Stream); ok {
+		reader := stream.Reader()
+		defer reader.Close()
+
+		nodeID := nc.Node.ID
+		for {
+			chunk, err := reader.Next(ctx)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			nc.Engine.publish(nc.Run.ID, RunEvent{Type: EventChunk, NodeID: &nodeID, Output: nc.Node.PortName(), Text: chunk})
+		}
+		return map[string]interface{}{DefaultPort: stream.Text()}, nil
+	}
+
+	// Streams mixed with other inputs are passed on once complete
+	value, err := collectStreams(ctx, value)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{DefaultPort: value}, nil
+}
+
+// processExecutor passes its input through unchanged. A streaming input is
+// accumulated chunk by chunk and streamed on to the nodes downstream, so a
+// process node between an LLM node and an OUTPUT node keeps the output
+// streaming; its output value is the whole text.
+type processExecutor struct{}
+
+func (p *processExecutor) AcceptsStreams(node *workspace.Node) bool {
+	return true
+}
+
+func (p *processExecutor) Execute(ctx context.Context, nc *NodeContext) (map[string]interface{}, error) {
+	value := singleInput(nc.Inputs)
+
+	if input, ok := value.(*Stream); ok {
+		reader := input.Reader()
+		defer reader.Close()
+
+		output := nc.OpenStream(DefaultPort)
+		for {
+			chunk, err := reader.Next(ctx)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			if err := output.Send(ctx, chunk); err != nil {
+				return nil, err
+			}
+		}
+		return map[string]interface{}{DefaultPort: output}, nil
+	}
+
+	// Streams mixed with other inputs are passed on once complete
+	value, err := collectStreams(ctx, value)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{DefaultPort: value}, nil
+}
+
+// singleInput returns the default input if it is the only one, otherwise the whole input map
+func singleInput(inputs map[string]interface{}) interface{} {
+	if value, ok := inputs[DefaultInput]; ok && len(inputs) == 1 {
+		return value
+	}
+	return inputs
+}
+
+func dataString(node *workspace.Node, key, def string) string {
+	if value, ok := node.Data[key].(string); ok && value != "" {
+		return value
+	}
+	return def
+}
+
+func dataFloat(node *workspace.Node, key string, def float64) float64 {
+	switch value := node.Data[key].(type) {
+	case float64:
+		return value
+	case int:
+		return float64(value)
+	}
+	return def
+}
+
+func dataInt(node *workspace.Node, key string, def int) int {
+	return int(dataFloat(node, key, float64(def)))
+}
+
+// embeddedGraph decodes a sub-graph stored in node data as {"nodes": [...], "edges": [...]}
+func embeddedGraph(nc *NodeContext, key string) (*workspace.Workspace, error) {
+	node := nc.Node
+	raw, ok := node.Data[key]
+	if !ok {
+		return nil, fmt.Errorf("node data has no %q graph", key)
+	}
+
+	encoded, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	var graph workspace.Workspace
+	if err := json.Unmarshal(encoded, &graph); err != nil {
+		return nil, fmt.Errorf("invalid %q graph: %w", key, err)
+	}
+
+	graph.ID = node.WorkspaceID
+	if nc.Workspace != nil {
+		// Sub-graphs share the partials of the workspace they are embedded in
+		graph.Partials = nc.Workspace.Partials
+	}
+	for i := range graph.Nodes {
+		if graph.Nodes[i].Data == nil {
+			graph.Nodes[i].Data = make(map[string]interface{})
+		}
+	}
+
+	return &graph, nil
+}
+
+// flowOutputs reduces a finished run's outputs to a single value when
+// exactly one OUTPUT node produced a value, and to null when none did
+func flowOutputs(run *Run) interface{} {
+	if len(run.Outputs) == 0 {
+		return nil
+	}
+	if len(run.Outputs) == 1 {
+		for _, value := range run.Outputs {
+			return value
+		}
+	}
+	return run.Outputs
+}
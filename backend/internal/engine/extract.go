@@ -0,0 +1,154 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/xizko39/nodeloom/internal/jsonschema"
+	"github.com/xizko39/nodeloom/internal/llm"
+	"github.com/xizko39/nodeloom/internal/workspace"
+)
+
+// DefaultMaxRepairs is how many times an extract node asks the model to fix
+// a reply that does not match its schema
+const DefaultMaxRepairs = 2
+
+// extractExecutor asks a model for JSON matching a schema. Node data:
+//
+//	provider, model, system, prompt, temperature, max_tokens, stop: as for LLM nodes
+//	schema:      JSON Schema the output must conform to
+//	max_repairs: attempts to correct a non-conforming reply (default DefaultMaxRepairs)
+//
+// The schema is included in the prompt and passed to providers able to
+// constrain their output. A reply that is not valid JSON or does not match
+// the schema is sent back to the model along with the validation errors. The
+// decoded value is emitted on the output port, token counts summed over all
+// attempts on "usage" and the number of model calls on "attempts". Replies
+// at temperature 0 are cached.
+type extractExecutor struct{}
+
+func (x *extractExecutor) Cacheable(node *workspace.Node) bool {
+	return zeroTemperature(node)
+}
+
+func (x *extractExecutor) Execute(ctx context.Context, nc *NodeContext) (map[string]interface{}, error) {
+	raw, ok := nc.Node.Data["schema"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("extract node requires a schema")
+	}
+	schema, err := jsonschema.Compile(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+
+	provider, err := nc.Engine.provider(nc.Node)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := chatRequest(nc.Node, nc.Inputs)
+	if err != nil {
+		return nil, err
+	}
+	instruction, err := schemaInstruction(raw)
+	if err != nil {
+		return nil, err
+	}
+	req.Messages = withSystem(req.Messages, instruction)
+	req.Schema = raw
+
+	var usage llm.Usage
+	maxRepairs := dataInt(nc.Node, "max_repairs", DefaultMaxRepairs)
+	for attempt := 1; ; attempt++ {
+		resp, err := nc.Engine.chat(ctx, nc, provider, req, nil)
+		if err != nil {
+			return nil, err
+		}
+		usage.PromptTokens += resp.Usage.PromptTokens
+		usage.CompletionTokens += resp.Usage.CompletionTokens
+
+		value, err := parseJSONReply(resp.Message.Content)
+		if err == nil {
+			err = schema.Validate(value)
+		}
+		if err == nil {
+			return map[string]interface{}{
+				DefaultPort: value,
+				"usage": map[string]interface{}{
+					"prompt_tokens":     usage.PromptTokens,
+					"completion_tokens": usage.CompletionTokens,
+				},
+				"attempts": attempt,
+			}, nil
+		}
+
+		if attempt > maxRepairs {
+			return nil, fmt.Errorf("no valid reply after %d attempts: %w", attempt, err)
+		}
+
+		req.Messages = append(req.Messages,
+			llm.Message{Role: llm.RoleAssistant, Content: resp.Message.Content},
+			llm.Message{Role: llm.RoleUser, Content: fmt.Sprintf(
+				"Your reply was rejected: %v\n\nReply again with only the corrected JSON.", err)},
+		)
+	}
+}
+
+// schemaInstruction tells the model the shape its reply must have
+func schemaInstruction(schema map[string]interface{}) (string, error) {
+	encoded, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return "Reply with only a JSON value that conforms to this JSON Schema, with no explanation or other text:\n\n" + string(encoded), nil
+}
+
+// withSystem adds a system message after any the chat starts with
+func withSystem(messages []llm.Message, content string) []llm.Message {
+	i := 0
+	for i < len(messages) && messages[i].Role == llm.RoleSystem {
+		i++
+	}
+	out := make([]llm.Message, 0, len(messages)+1)
+	out = append(out, messages[:i]...)
+	out = append(out, llm.Message{Role: llm.RoleSystem, Content: content})
+	return append(out, messages[i:]...)
+}
+
+// parseJSONReply decodes the JSON in a model's reply. Models often wrap it in
+// a Markdown code fence or surround it with a sentence, so when the whole
+// reply is not JSON the span from the first opening bracket to the last
+// closing one is tried.
+func parseJSONReply(reply string) (interface{}, error) {
+	text := strings.TrimSpace(reply)
+	if strings.HasPrefix(text, "```") {
+		text = strings.TrimPrefix(text, "```")
+		if i := strings.IndexByte(text, '\n'); i >= 0 {
+			text = text[i+1:] // Drop the language tag
+		}
+		text = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(text), "```"))
+	}
+
+	var value interface{}
+	err := json.Unmarshal([]byte(text), &value)
+	if err == nil {
+		return value, nil
+	}
+
+	start := strings.IndexAny(text, "{[")
+	if start >= 0 {
+		closing := "}"
+		if text[start] == '[' {
+			closing = "]"
+		}
+		if end := strings.LastIndex(text, closing); end > start {
+			if json.Unmarshal([]byte(text[start:end+1]), &value) == nil {
+				return value, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("reply is not valid JSON: %v", err)
+}
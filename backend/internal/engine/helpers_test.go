@@ -0,0 +1,176 @@
+package engine
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/xizko39/nodeloom/internal/llm"
+	"github.com/xizko39/nodeloom/internal/workspace"
+)
+
+// memoryRunStore keeps runs in memory
+type memoryRunStore struct {
+	mu   sync.Mutex
+	runs map[uuid.UUID]*Run
+}
+
+func newMemoryRunStore() *memoryRunStore {
+	return &memoryRunStore{runs: make(map[uuid.UUID]*Run)}
+}
+
+func (s *memoryRunStore) CreateRun(run *Run) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.runs[run.ID] = run.snapshot()
+	return nil
+}
+
+func (s *memoryRunStore) UpdateRun(run *Run) error {
+	return s.CreateRun(run)
+}
+
+func (s *memoryRunStore) GetRun(id uuid.UUID) (*Run, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run, ok := s.runs[id]
+	if !ok {
+		return nil, ErrRunNotFound
+	}
+	return run.snapshot(), nil
+}
+
+func (s *memoryRunStore) ListRuns(workspaceID uuid.UUID) ([]Run, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var runs []Run
+	for _, run := range s.runs {
+		if run.WorkspaceID == workspaceID {
+			runs = append(runs, *run.snapshot())
+		}
+	}
+	return runs, nil
+}
+
+func (s *memoryRunStore) ListRunUsage(filter UsageFilter) ([]Run, error) {
+	var runs []Run
+	all, _ := s.ListRuns(*filter.WorkspaceID)
+	for _, run := range all {
+		if run.Usage != nil {
+			runs = append(runs, run)
+		}
+	}
+	return runs, nil
+}
+
+// memoryApprovalStore keeps approvals in memory
+type memoryApprovalStore struct {
+	mu        sync.Mutex
+	approvals map[uuid.UUID]Approval
+}
+
+func newMemoryApprovalStore() *memoryApprovalStore {
+	return &memoryApprovalStore{approvals: make(map[uuid.UUID]Approval)}
+}
+
+func (s *memoryApprovalStore) CreateApproval(a *Approval) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.approvals[a.ID] = *a
+	return nil
+}
+
+func (s *memoryApprovalStore) UpdateApproval(a *Approval) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stored, ok := s.approvals[a.ID]; !ok || stored.Status != ApprovalPending {
+		return ErrApprovalDecided
+	}
+	s.approvals[a.ID] = *a
+	return nil
+}
+
+func (s *memoryApprovalStore) GetApproval(id uuid.UUID) (*Approval, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.approvals[id]
+	if !ok {
+		return nil, ErrApprovalNotFound
+	}
+	return &a, nil
+}
+
+func (s *memoryApprovalStore) ListApprovals(filter ApprovalFilter) ([]Approval, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []Approval
+	for _, a := range s.approvals {
+		if (filter.Status == "" || a.Status == filter.Status) && (filter.Assignee == "" || a.AssignedTo(filter.Assignee)) {
+			list = append(list, a)
+		}
+	}
+	return list, nil
+}
+
+// memoryWorkspaces loads workspaces from memory
+type memoryWorkspaces map[uuid.UUID]*workspace.Workspace
+
+func (m memoryWorkspaces) GetWorkspace(id uuid.UUID) (*workspace.Workspace, error) {
+	ws, ok := m[id]
+	if !ok {
+		return nil, workspace.ErrWorkspaceNotFound
+	}
+	return ws, nil
+}
+
+// flow builds a workspace from nodes connected in a chain
+func flow(nodes ...workspace.Node) *workspace.Workspace {
+	ws := &workspace.Workspace{ID: uuid.New(), Name: "test"}
+	for i := range nodes {
+		nodes[i].ID = uuid.New()
+		nodes[i].WorkspaceID = ws.ID
+		if i > 0 {
+			ws.Edges = append(ws.Edges, workspace.Edge{ID: uuid.New(), WorkspaceID: ws.ID, Source: nodes[i-1].ID, Target: nodes[i].ID})
+		}
+	}
+	ws.Nodes = nodes
+	return ws
+}
+
+// waitForRun polls the run store until the run reaches one of the statuses
+func waitForRun(t *testing.T, store *memoryRunStore, id uuid.UUID, statuses ...Status) *Run {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		run, err := store.GetRun(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, status := range statuses {
+			if run.Status == status {
+				return run
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("run is %s, want one of %v", run.Status, statuses)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// mockEngine creates an engine whose only provider is a mock scripted by fixture
+func mockEngine(t *testing.T, fixture *llm.Fixture, workspaces memoryWorkspaces) (*Engine, *memoryRunStore) {
+	t.Helper()
+	mock, err := llm.NewMockFromFixture("mock", fixture, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	providers := llm.NewRegistry()
+	providers.Register(mock)
+
+	store := newMemoryRunStore()
+	e := New(store, workspaces)
+	e.UseProviders(providers)
+	return e, store
+}
@@ -0,0 +1,240 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/xizko39/nodeloom/internal/expr"
+	"github.com/xizko39/nodeloom/internal/llm"
+	"github.com/xizko39/nodeloom/internal/workspace"
+)
+
+// UseProviders sets the LLM providers available to LLM nodes
+func (e *Engine) UseProviders(providers *llm.Registry) {
+	e.providers = providers
+}
+
+// provider returns the provider an LLM node names in its "provider" data,
+// or the default provider
+func (e *Engine) provider(node *workspace.Node) (llm.Provider, error) {
+	if e.providers == nil {
+		return nil, fmt.Errorf("no LLM providers are configured")
+	}
+	return e.providers.Get(dataString(node, "provider", ""))
+}
+
+// llmExecutor asks a model to continue a chat. Node data:
+//
+//	provider:    name of a configured provider (defaults to the default provider)
+//	model:       model name
+//	system:      system prompt (optional)
+//	prompt:      user message; defaults to the text input
+//	temperature: sampling temperature (optional)
+//	max_tokens:  completion length limit (optional)
+//	stop:        list of stop sequences (optional)
+//	stream:      stream the reply to downstream nodes (default true)
+//	tools:       [{"name": ..., "description": ..., "parameters": {JSON Schema}}] (optional)
+//
+// A message list input, such as a prompt node's output, is sent as the chat
+// history before the prompt. The reply text is emitted on the output port,
+// the whole assistant message on "message", token counts on "usage" and any
+// tool calls the model asked for on "tool_calls". Replies at temperature 0
+// are cached.
+//
+// Switching "provider" between provider families needs no other changes:
+// messages and tool calls are translated by the provider.
+type llmExecutor struct{}
+
+func (l *llmExecutor) Cacheable(node *workspace.Node) bool {
+	return zeroTemperature(node)
+}
+
+// zeroTemperature reports whether a node asks for deterministic sampling
+func zeroTemperature(node *workspace.Node) bool {
+	temperature, ok := node.Data["temperature"].(float64)
+	return ok && temperature == 0
+}
+
+func (l *llmExecutor) Execute(ctx context.Context, nc *NodeContext) (map[string]interface{}, error) {
+	provider, err := nc.Engine.provider(nc.Node)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := chatRequest(nc.Node, nc.Inputs)
+	if err != nil {
+		return nil, err
+	}
+	if raw, ok := nc.Node.Data["tools"]; ok {
+		if err := fromValue(raw, &req.Tools); err != nil {
+			return nil, fmt.Errorf("invalid tools: %w", err)
+		}
+		for i, tool := range req.Tools {
+			if tool.Name == "" {
+				return nil, fmt.Errorf("tool %d has no name", i)
+			}
+		}
+	}
+
+	var resp *llm.ChatResponse
+	if stream, ok := nc.Node.Data["stream"].(bool); ok && !stream {
+		resp, err = nc.Engine.chat(ctx, nc, provider, req, nil)
+	} else {
+		resp, err = streamChat(ctx, nc, provider, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	message, err := toValue(resp.Message)
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := map[string]interface{}{
+		DefaultPort: resp.Message.Content,
+		"message":   message,
+		"usage": map[string]interface{}{
+			"prompt_tokens":     resp.Usage.PromptTokens,
+			"completion_tokens": resp.Usage.CompletionTokens,
+		},
+	}
+	if len(resp.Message.ToolCalls) > 0 {
+		outputs["tool_calls"] = message.(map[string]interface{})["tool_calls"]
+	}
+	return outputs, nil
+}
+
+// streamChat streams a reply onto the output port. The stream is opened on
+// the first piece of text, so a request that fails outright can still be
+// retried.
+func streamChat(ctx context.Context, nc *NodeContext, provider llm.Provider, req *llm.ChatRequest) (*llm.ChatResponse, error) {
+	var stream *Stream
+	return nc.Engine.chat(ctx, nc, provider, req, func(text string) error {
+		if stream == nil {
+			stream = nc.OpenStream(DefaultPort)
+		}
+		return stream.Send(ctx, text)
+	})
+}
+
+// chatRequest builds the request an LLM node sends from its data and inputs
+func chatRequest(node *workspace.Node, inputs map[string]interface{}) (*llm.ChatRequest, error) {
+	req := &llm.ChatRequest{
+		Model:     dataString(node, "model", ""),
+		MaxTokens: dataInt(node, "max_tokens", 0),
+	}
+	if req.Model == "" {
+		return nil, fmt.Errorf("LLM node requires a model")
+	}
+	if temperature, ok := node.Data["temperature"].(float64); ok {
+		req.Temperature = &temperature
+	}
+	if stops, ok := node.Data["stop"].([]interface{}); ok {
+		for _, stop := range stops {
+			req.Stop = append(req.Stop, expr.ToString(stop))
+		}
+	}
+
+	if system := dataString(node, "system", ""); system != "" {
+		req.Messages = append(req.Messages, llm.Message{Role: llm.RoleSystem, Content: system})
+	}
+
+	// A message list on any input is the chat so far; other inputs are text
+	var text string
+	for _, port := range []string{"messages", DefaultInput} {
+		value, ok := inputs[port]
+		if !ok {
+			continue
+		}
+		if history, ok := chatMessages(value); ok {
+			req.Messages = append(req.Messages, history...)
+		} else if port == DefaultInput {
+			text = expr.ToString(value)
+		}
+	}
+
+	if prompt := dataString(node, "prompt", text); prompt != "" {
+		req.Messages = append(req.Messages, llm.Message{Role: llm.RoleUser, Content: prompt})
+	}
+	if len(req.Messages) == 0 {
+		return nil, fmt.Errorf("LLM node has no prompt or messages")
+	}
+
+	return req, nil
+}
+
+// chatMessages converts a list of {"role", "content"} objects, which may
+// carry tool calls and results, reporting false if the value is not such a
+// list
+func chatMessages(value interface{}) ([]llm.Message, bool) {
+	list, ok := value.([]interface{})
+	if !ok || len(list) == 0 {
+		return nil, false
+	}
+
+	messages := make([]llm.Message, 0, len(list))
+	for _, item := range list {
+		fields, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if _, ok := fields["role"].(string); !ok {
+			return nil, false
+		}
+
+		var message llm.Message
+		content := fields["content"]
+		if _, isText := content.(string); !isText && content != nil {
+			// Structured content is passed to the model as text
+			fields = copyMap(fields)
+			fields["content"] = expr.ToString(content)
+		}
+		if err := fromValue(fields, &message); err != nil {
+			return nil, false
+		}
+		messages = append(messages, message)
+	}
+	return messages, true
+}
+
+// toValue converts a struct to the generic JSON form node outputs use
+func toValue(v interface{}) (interface{}, error) {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	if err := json.Unmarshal(encoded, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// fromValue decodes a generic JSON value, such as node data, into out
+func fromValue(value interface{}, out interface{}) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(encoded, out)
+}
+
+// classifyLLMError marks provider errors for retry policies
+func classifyLLMError(err error) error {
+	var status *llm.StatusError
+	if !errors.As(err, &status) {
+		return err
+	}
+
+	switch {
+	case status.RateLimited():
+		return &ClassifiedError{Class: ErrorRateLimit, Err: err, RetryAfter: status.RetryAfter}
+	case status.Temporary():
+		return &ClassifiedError{Class: ErrorTransient, Err: err}
+	default:
+		return &ClassifiedError{Class: ErrorPermanent, Err: err}
+	}
+}
@@ -0,0 +1,200 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/xizko39/nodeloom/internal/llm"
+	"github.com/xizko39/nodeloom/internal/workspace"
+)
+
+// runFlow starts a run of ws and waits for it to finish
+func runFlow(t *testing.T, e *Engine, ws *workspace.Workspace, inputs map[string]interface{}) *Run {
+	t.Helper()
+	_, done, err := e.Start(ws, NewRun(ws.ID, inputs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case run := <-done:
+		return run.snapshot()
+	case <-time.After(10 * time.Second):
+		t.Fatal("run did not finish")
+		return nil
+	}
+}
+
+// nodeRun returns the record of the node at index i of ws
+func nodeRun(t *testing.T, run *Run, ws *workspace.Workspace, i int) *NodeRun {
+	t.Helper()
+	nodeRun, ok := run.Nodes[ws.Nodes[i].ID]
+	if !ok {
+		t.Fatalf("node %q did not run", ws.Nodes[i].Label)
+	}
+	return nodeRun
+}
+
+func TestLLMNode(t *testing.T) {
+	ws := flow(
+		workspace.Node{Type: workspace.InputNode, Label: "question"},
+		workspace.Node{Type: workspace.LLMNode, Label: "llm", Data: map[string]interface{}{
+			"model":  "mock-model",
+			"system": "Answer in one sentence.",
+		}},
+		workspace.Node{Type: workspace.OutputNode, Label: "answer"},
+	)
+	e, _ := mockEngine(t, &llm.Fixture{Responses: []*llm.MockResponse{
+		{Match: "capital of France", Reply: "Paris is the capital of France.", Usage: &llm.Usage{PromptTokens: 20, CompletionTokens: 7}},
+	}}, memoryWorkspaces{ws.ID: ws})
+
+	run := runFlow(t, e, ws, map[string]interface{}{"question": "What is the capital of France?"})
+	if run.Status != StatusSucceeded {
+		t.Fatalf("status = %s, error = %q", run.Status, run.Error)
+	}
+	if got := run.Outputs["answer"]; got != "Paris is the capital of France." {
+		t.Errorf("answer = %v", got)
+	}
+
+	llmRun := nodeRun(t, run, ws, 1)
+	usage := llmRun.Outputs["usage"].(map[string]interface{})
+	if usage["prompt_tokens"] != 20 || usage["completion_tokens"] != 7 {
+		t.Errorf("usage output = %v", usage)
+	}
+	if llmRun.Usage == nil || llmRun.Usage.Calls != 1 || llmRun.Usage.PromptTokens != 20 {
+		t.Errorf("node usage = %+v", llmRun.Usage)
+	}
+	if run.Usage == nil || run.Usage.Calls != 1 || run.Usage.CompletionTokens != 7 {
+		t.Errorf("run usage = %+v", run.Usage)
+	}
+}
+
+func TestLLMNodeProviderError(t *testing.T) {
+	ws := flow(
+		workspace.Node{Type: workspace.InputNode, Label: "question"},
+		workspace.Node{Type: workspace.LLMNode, Label: "llm", Data: map[string]interface{}{"model": "mock-model"}},
+		workspace.Node{Type: workspace.OutputNode, Label: "answer"},
+	)
+	e, _ := mockEngine(t, &llm.Fixture{Responses: []*llm.MockResponse{
+		{Error: &llm.MockError{Status: 400, Message: "invalid_request_error: prompt is too long"}},
+	}}, memoryWorkspaces{ws.ID: ws})
+
+	run := runFlow(t, e, ws, map[string]interface{}{"question": "Hello"})
+	if run.Status != StatusFailed {
+		t.Fatalf("status = %s", run.Status)
+	}
+	if llmRun := nodeRun(t, run, ws, 1); llmRun.Status != StatusFailed || llmRun.Error == "" {
+		t.Errorf("llm node = %s, error = %q", llmRun.Status, llmRun.Error)
+	}
+}
+
+func TestAgentToolLoop(t *testing.T) {
+	ws := flow(
+		workspace.Node{Type: workspace.InputNode, Label: "question"},
+		workspace.Node{Type: workspace.AgentNode, Label: "agent", Data: map[string]interface{}{
+			"model": "mock-model",
+			"tools": []interface{}{map[string]interface{}{"type": ToolCalculator}},
+		}},
+		workspace.Node{Type: workspace.OutputNode, Label: "answer"},
+	)
+	// A tool result leaves the last user message unchanged, so the call is
+	// scripted to be made once and the answer follows
+	e, _ := mockEngine(t, &llm.Fixture{Responses: []*llm.MockResponse{
+		{Times: 1, ToolCalls: []llm.ToolCall{{ID: "call_1", Name: ToolCalculator, Arguments: map[string]interface{}{"expression": "6 * 7"}}}},
+		{Reply: "6 times 7 is 42."},
+	}}, memoryWorkspaces{ws.ID: ws})
+
+	run := runFlow(t, e, ws, map[string]interface{}{"question": "What is 6 times 7?"})
+	if run.Status != StatusSucceeded {
+		t.Fatalf("status = %s, error = %q", run.Status, run.Error)
+	}
+	if got := run.Outputs["answer"]; got != "6 times 7 is 42." {
+		t.Errorf("answer = %v", got)
+	}
+
+	agentRun := nodeRun(t, run, ws, 1)
+	if len(agentRun.ToolCalls) != 1 {
+		t.Fatalf("tool calls = %+v", agentRun.ToolCalls)
+	}
+	call := agentRun.ToolCalls[0]
+	if call.ID != "call_1" || call.Tool != ToolCalculator || call.Error != "" || fmt.Sprint(call.Result) != "42" {
+		t.Errorf("tool call = %+v", call)
+	}
+
+	// user, assistant calling the tool, tool result, final answer
+	messages := agentRun.Outputs["messages"].([]interface{})
+	if len(messages) != 4 {
+		t.Fatalf("messages = %v", messages)
+	}
+	result := messages[2].(map[string]interface{})
+	if result["role"] != llm.RoleTool || result["tool_call_id"] != "call_1" || result["content"] != "42" {
+		t.Errorf("tool result message = %v", result)
+	}
+	if agentRun.Usage == nil || agentRun.Usage.Calls != 2 {
+		t.Errorf("node usage = %+v", agentRun.Usage)
+	}
+}
+
+func TestExtractRepair(t *testing.T) {
+	ws := flow(
+		workspace.Node{Type: workspace.InputNode, Label: "text"},
+		workspace.Node{Type: workspace.ExtractNode, Label: "extract", Data: map[string]interface{}{
+			"model": "mock-model",
+			"schema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"name": map[string]interface{}{"type": "string"},
+					"age":  map[string]interface{}{"type": "integer"},
+				},
+				"required": []interface{}{"name", "age"},
+			},
+		}},
+		workspace.Node{Type: workspace.OutputNode, Label: "person"},
+	)
+	// The corrected reply only answers the repair prompt, which proves the
+	// rejection was sent back to the model
+	e, _ := mockEngine(t, &llm.Fixture{Responses: []*llm.MockResponse{
+		{Match: "Your reply was rejected", Reply: "```json\n{\"name\": \"Ada\", \"age\": 36}\n```"},
+		{Reply: `{"name": "Ada", "age": "thirty-six"}`},
+	}}, memoryWorkspaces{ws.ID: ws})
+
+	run := runFlow(t, e, ws, map[string]interface{}{"text": "Ada is 36 years old."})
+	if run.Status != StatusSucceeded {
+		t.Fatalf("status = %s, error = %q", run.Status, run.Error)
+	}
+
+	person, ok := run.Outputs["person"].(map[string]interface{})
+	if !ok || person["name"] != "Ada" || person["age"] != float64(36) {
+		t.Errorf("person = %v", run.Outputs["person"])
+	}
+	extractRun := nodeRun(t, run, ws, 1)
+	if extractRun.Outputs["attempts"] != 2 {
+		t.Errorf("attempts = %v", extractRun.Outputs["attempts"])
+	}
+	if extractRun.Usage == nil || extractRun.Usage.Calls != 2 {
+		t.Errorf("node usage = %+v", extractRun.Usage)
+	}
+}
+
+func TestExtractGivesUp(t *testing.T) {
+	ws := flow(
+		workspace.Node{Type: workspace.InputNode, Label: "text"},
+		workspace.Node{Type: workspace.ExtractNode, Label: "extract", Data: map[string]interface{}{
+			"model":       "mock-model",
+			"max_repairs": float64(1),
+			"schema":      map[string]interface{}{"type": "object"},
+		}},
+		workspace.Node{Type: workspace.OutputNode, Label: "result"},
+	)
+	e, _ := mockEngine(t, &llm.Fixture{Responses: []*llm.MockResponse{
+		{Reply: "I cannot answer that."},
+	}}, memoryWorkspaces{ws.ID: ws})
+
+	run := runFlow(t, e, ws, map[string]interface{}{"text": "Hello"})
+	if run.Status != StatusFailed {
+		t.Fatalf("status = %s", run.Status)
+	}
+	if extractRun := nodeRun(t, run, ws, 1); extractRun.Usage == nil || extractRun.Usage.Calls != 2 {
+		t.Errorf("node usage = %+v", extractRun.Usage)
+	}
+}
@@ -0,0 +1,114 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/xizko39/nodeloom/internal/expr"
+)
+
+const defaultMaxIterations = 10
+
+// loopExecutor re-runs an embedded sub-graph while a condition holds. The
+// outputs of each iteration are fed back as the inputs of the next, matched
+// by OUTPUT and INPUT node names; inputs without a matching output keep
+// their previous value. Node data:
+//
+//	graph:          embedded sub-graph {"nodes": [...], "edges": [...]}
+//	while:          expression evaluated after each iteration; the loop
+//	                continues while it is true. It sees "outputs" and
+//	                "iteration" (the number of completed iterations).
+//	max_iterations: upper bound on iterations (default 10)
+//	max_seconds:    upper bound on total loop time (optional)
+//	on_limit:       "stop" (default) emits the last outputs when a limit is
+//	                reached, "fail" fails the node
+//
+// The body always runs at least once. Every iteration is recorded in the
+// node's run record. The node emits the last iteration's outputs and the
+// iteration count on the "iterations" port.
+type loopExecutor struct{}
+
+func (l *loopExecutor) Execute(ctx context.Context, nc *NodeContext) (map[string]interface{}, error) {
+	body, err := embeddedGraph(nc, "graph")
+	if err != nil {
+		return nil, err
+	}
+
+	var condition *expr.Program
+	if source := dataString(nc.Node, "while", ""); source != "" {
+		condition, err = expr.Compile(source)
+		if err != nil {
+			return nil, fmt.Errorf("while: %w", err)
+		}
+	}
+
+	maxIterations := dataInt(nc.Node, "max_iterations", defaultMaxIterations)
+	failOnLimit := dataString(nc.Node, "on_limit", "stop") == "fail"
+
+	loopCtx := ctx
+	if seconds := dataFloat(nc.Node, "max_seconds", 0); seconds > 0 {
+		var cancel context.CancelFunc
+		loopCtx, cancel = context.WithTimeout(ctx, time.Duration(seconds*float64(time.Second)))
+		defer cancel()
+	}
+
+	inputs := flowInputs(body, nc.Inputs)
+	var last map[string]interface{}
+	iteration := 0
+
+	for {
+		run := NewRun(nc.Run.WorkspaceID, inputs)
+		err := nc.Engine.executeNested(loopCtx, body, run)
+		nc.RecordIteration(run)
+
+		if err != nil {
+			// Hitting the time limit ends the loop like reaching max_iterations
+			if ctx.Err() == nil && errors.Is(loopCtx.Err(), context.DeadlineExceeded) {
+				if failOnLimit || last == nil {
+					return nil, fmt.Errorf("loop exceeded its time limit after %d iterations", iteration)
+				}
+				break
+			}
+			return nil, fmt.Errorf("iteration %d: %w", iteration, err)
+		}
+
+		iteration++
+		last = run.Outputs
+
+		if condition != nil {
+			result, err := condition.Eval(map[string]interface{}{
+				"outputs":   run.Outputs,
+				"iteration": iteration,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("while: %w", err)
+			}
+			if !expr.Truthy(result) {
+				break
+			}
+		}
+
+		if iteration >= maxIterations {
+			// Without a condition the iteration count is the intended bound
+			if failOnLimit && condition != nil {
+				return nil, fmt.Errorf("loop did not finish within %d iterations", maxIterations)
+			}
+			break
+		}
+
+		next := make(map[string]interface{}, len(inputs))
+		for k, v := range inputs {
+			next[k] = v
+		}
+		for k, v := range run.Outputs {
+			next[k] = v
+		}
+		inputs = next
+	}
+
+	outputs := portOutputs(body, last)
+	outputs["iterations"] = iteration
+	return outputs, nil
+}
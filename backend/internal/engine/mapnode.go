@@ -0,0 +1,113 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+const defaultMapConcurrency = 4
+
+// mapExecutor runs an embedded sub-graph once per element of its list input
+// and collects the results in order. Node data:
+//
+//	graph:       embedded sub-graph {"nodes": [...], "edges": [...]}
+//	item_input:  name of the sub-graph INPUT node receiving the element (default "item")
+//	concurrency: number of elements processed at once (default 4)
+//	on_error:    "fail" (default) fails the node on the first item error,
+//	             "collect" records item errors on the "errors" port and
+//	             leaves a null result for the failed element
+//
+// INPUT nodes named "index" receive the element's position. The "output"
+// port carries the list of results.
+type mapExecutor struct{}
+
+func (m *mapExecutor) Execute(ctx context.Context, nc *NodeContext) (map[string]interface{}, error) {
+	items, ok := nc.Inputs[DefaultInput].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("map node expects a list input")
+	}
+
+	graph, err := embeddedGraph(nc, "graph")
+	if err != nil {
+		return nil, err
+	}
+
+	itemInput := dataString(nc.Node, "item_input", "item")
+	collectErrors := dataString(nc.Node, "on_error", "fail") == "collect"
+	concurrency := dataInt(nc.Node, "concurrency", defaultMapConcurrency)
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([]interface{}, len(items))
+	itemErrors := make([]error, len(items))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	// The first item to fail cancels the others, which then fail too; only
+	// its error is reported
+	var failMu sync.Mutex
+	var failed error
+
+	for i, item := range items {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(i int, item interface{}) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			run := NewRun(nc.Run.WorkspaceID, map[string]interface{}{
+				itemInput: item,
+				"index":   i,
+			})
+			if err := nc.Engine.executeNested(ctx, graph, run); err != nil {
+				itemErrors[i] = err
+				if !collectErrors {
+					failMu.Lock()
+					if failed == nil {
+						failed = fmt.Errorf("item %d: %w", i, err)
+					}
+					failMu.Unlock()
+					cancel()
+				}
+				return
+			}
+			results[i] = flowOutputs(run)
+		}(i, item)
+	}
+	wg.Wait()
+
+	if err := parent.Err(); err != nil {
+		return nil, err
+	}
+
+	if failed != nil {
+		return nil, failed
+	}
+
+	var collected []interface{}
+	for i, err := range itemErrors {
+		if err == nil {
+			continue
+		}
+		collected = append(collected, map[string]interface{}{"index": i, "error": err.Error()})
+	}
+
+	outputs := map[string]interface{}{DefaultPort: results}
+	if len(collected) > 0 {
+		outputs["errors"] = collected
+	}
+	return outputs, nil
+}
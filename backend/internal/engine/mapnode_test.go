@@ -0,0 +1,54 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/xizko39/nodeloom/internal/llm"
+	"github.com/xizko39/nodeloom/internal/workspace"
+)
+
+func TestMapReportsFirstFailingItem(t *testing.T) {
+	input, work, output := uuid.New(), uuid.New(), uuid.New()
+	graph := map[string]interface{}{
+		"nodes": []interface{}{
+			map[string]interface{}{"id": input.String(), "type": "INPUT", "label": "item"},
+			map[string]interface{}{"id": work.String(), "type": "WORK", "label": "work"},
+			map[string]interface{}{"id": output.String(), "type": "OUTPUT", "label": "result"},
+		},
+		"edges": []interface{}{
+			map[string]interface{}{"id": uuid.NewString(), "source": input.String(), "target": work.String()},
+			map[string]interface{}{"id": uuid.NewString(), "source": work.String(), "target": output.String()},
+		},
+	}
+	ws := flow(
+		workspace.Node{Type: workspace.InputNode, Label: "items"},
+		workspace.Node{Type: workspace.MapNode, Label: "map", Data: map[string]interface{}{"graph": graph}},
+		workspace.Node{Type: workspace.OutputNode, Label: "results"},
+	)
+	e, _ := mockEngine(t, &llm.Fixture{}, memoryWorkspaces{ws.ID: ws})
+
+	// Item 0 runs until it is cancelled; item 2 fails straight away
+	e.Register("WORK", ExecutorFunc(func(ctx context.Context, nc *NodeContext) (map[string]interface{}, error) {
+		if nc.Inputs[DefaultInput] == float64(2) {
+			return nil, fmt.Errorf("item is broken")
+		}
+		if nc.Inputs[DefaultInput] == float64(0) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return map[string]interface{}{DefaultPort: nc.Inputs[DefaultInput]}, nil
+	}))
+
+	run := runFlow(t, e, ws, map[string]interface{}{"items": []interface{}{float64(0), float64(1), float64(2)}})
+	if run.Status != StatusFailed {
+		t.Fatalf("status = %s", run.Status)
+	}
+	mapRun := nodeRun(t, run, ws, 1)
+	if !strings.Contains(mapRun.Error, "item 2:") || !strings.Contains(mapRun.Error, "item is broken") {
+		t.Errorf("map error = %q, want item 2's error", mapRun.Error)
+	}
+}
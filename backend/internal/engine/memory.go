@@ -0,0 +1,388 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/xizko39/nodeloom/internal/database"
+	"github.com/xizko39/nodeloom/internal/expr"
+	"github.com/xizko39/nodeloom/internal/llm"
+)
+
+var (
+	ErrSessionNotFound  = fmt.Errorf("session not found")
+	ErrSessionsDisabled = fmt.Errorf("sessions are not configured")
+)
+
+// Memory strategies select the part of a session's history a memory node
+// passes on
+const (
+	MemoryWindow  = "window"  // The last few messages
+	MemoryTokens  = "tokens"  // The most recent messages that fit a token limit
+	MemorySummary = "summary" // A rolling summary of older messages and the last few messages
+)
+
+const (
+	// DefaultMemoryWindow is how many messages the window and summary
+	// strategies pass on
+	DefaultMemoryWindow = 20
+	// DefaultMemoryTokens is the token limit of the tokens strategy
+	DefaultMemoryTokens = 2000
+)
+
+// defaultSummaryPrompt is the system prompt used to fold messages into a
+// session's summary
+const defaultSummaryPrompt = "You maintain the running summary of a conversation. " +
+	"Update the summary with the new messages, keeping the facts, names, decisions and open questions needed to continue the conversation. " +
+	"Reply with the updated summary only."
+
+// Session is the chat history of a conversation that spans runs. Summary
+// covers the first Summarized messages when the summary strategy is used.
+// Sessions belong to a workspace: two workspaces using the same session ID
+// keep separate histories.
+type Session struct {
+	ID          string        `json:"id"`
+	WorkspaceID uuid.UUID     `json:"workspace_id"`
+	Messages    []llm.Message `json:"messages"`
+	Summary     string        `json:"summary,omitempty"`
+	Summarized  int           `json:"summarized"`
+	CreatedAt   time.Time     `json:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+}
+
+// SessionStore persists conversation sessions, keyed by workspace and ID
+type SessionStore interface {
+	CreateSession(s *Session) error
+	UpdateSession(s *Session) error
+	GetSession(workspaceID uuid.UUID, id string) (*Session, error)
+}
+
+// UseSessions enables memory nodes, storing their sessions in store
+func (e *Engine) UseSessions(store SessionStore) {
+	e.sessions = store
+}
+
+// sessionLocks serializes the memory nodes of a session, so messages
+// appended by concurrent runs are not lost
+type sessionLocks struct {
+	mu    sync.Mutex
+	locks map[string]*sessionLock
+}
+
+type sessionLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock waits for the session and returns the function that releases it
+func (l *sessionLocks) lock(id string) func() {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*sessionLock)
+	}
+	lock := l.locks[id]
+	if lock == nil {
+		lock = &sessionLock{}
+		l.locks[id] = lock
+	}
+	lock.refs++
+	l.mu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		l.mu.Lock()
+		if lock.refs--; lock.refs == 0 {
+			delete(l.locks, id)
+		}
+		l.mu.Unlock()
+	}
+}
+
+// memoryExecutor loads and appends the chat history of a session. Node data:
+//
+//	session_id:     session to use; defaults to the "session_id" input
+//	strategy:       "window" (default), "tokens" or "summary"
+//	window:         messages passed on by the window and summary strategies (default DefaultMemoryWindow)
+//	max_tokens:     token limit of the tokens strategy (default DefaultMemoryTokens)
+//	role:           role of text appended from the input (default "user")
+//	provider:       provider summarizing older messages (summary strategy)
+//	model:          model summarizing older messages (summary strategy)
+//	summary_prompt: system prompt of the summarizing call (optional)
+//
+// A message, a message list or text on the input is appended to the session
+// first. The messages selected by the strategy are then emitted on the output
+// port, ready for an LLM node's "messages" input, along with "session_id" and
+// "summary". Under the summary strategy, messages that fall out of the window
+// are folded into the summary, which is passed on as a system message.
+//
+// A typical chat flow has one memory node recording the user's message and
+// feeding the LLM node, and another recording the LLM node's "message".
+type memoryExecutor struct{}
+
+func (m *memoryExecutor) Execute(ctx context.Context, nc *NodeContext) (map[string]interface{}, error) {
+	e := nc.Engine
+	if e.sessions == nil {
+		return nil, ErrSessionsDisabled
+	}
+
+	node := nc.Node
+	id := dataString(node, "session_id", "")
+	if id == "" {
+		if value, ok := nc.Inputs["session_id"]; ok && value != nil {
+			id = expr.ToString(value)
+		}
+	}
+	if id == "" {
+		return nil, fmt.Errorf("memory node requires a session_id")
+	}
+
+	strategy := dataString(node, "strategy", MemoryWindow)
+	if strategy != MemoryWindow && strategy != MemoryTokens && strategy != MemorySummary {
+		return nil, fmt.Errorf("unknown memory strategy %q", strategy)
+	}
+
+	appended := memoryMessages(nc.Inputs[DefaultInput], dataString(node, "role", llm.RoleUser))
+
+	unlock := e.sessionLocks.lock(nc.Run.WorkspaceID.String() + "/" + id)
+	defer unlock()
+
+	session, err := e.sessions.GetSession(nc.Run.WorkspaceID, id)
+	created := errors.Is(err, ErrSessionNotFound)
+	switch {
+	case created:
+		session = &Session{ID: id, WorkspaceID: nc.Run.WorkspaceID, Messages: []llm.Message{}, CreatedAt: time.Now().UTC()}
+	case err != nil:
+		return nil, err
+	}
+
+	session.Messages = append(session.Messages, appended...)
+	changed := len(appended) > 0
+
+	window := dataInt(node, "window", DefaultMemoryWindow)
+	if strategy == MemorySummary && len(session.Messages)-session.Summarized > window {
+		// The kept messages never start on a tool result whose call was
+		// folded into the summary
+		end := len(session.Messages) - window
+		for end < len(session.Messages) && session.Messages[end].Role == llm.RoleTool {
+			end++
+		}
+		if err := summarize(ctx, nc, session, end); err != nil {
+			return nil, err
+		}
+		changed = true
+	}
+
+	session.UpdatedAt = time.Now().UTC()
+	switch {
+	case created:
+		err = e.sessions.CreateSession(session)
+	case changed:
+		err = e.sessions.UpdateSession(session)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []llm.Message
+	switch strategy {
+	case MemoryWindow:
+		selected = lastMessages(session.Messages, window)
+	case MemoryTokens:
+		selected = fitTokens(session.Messages, dataInt(node, "max_tokens", DefaultMemoryTokens))
+	case MemorySummary:
+		selected = session.Messages[session.Summarized:]
+		if session.Summary != "" {
+			summary := llm.Message{Role: llm.RoleSystem, Content: "Summary of the conversation so far:\n" + session.Summary}
+			selected = append([]llm.Message{summary}, selected...)
+		}
+	}
+
+	messages, err := toValue(selected)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		DefaultPort:  messages,
+		"session_id": id,
+		"summary":    session.Summary,
+	}, nil
+}
+
+// memoryMessages converts the input of a memory node to the messages it
+// appends: a message list, a single message, or text sent in the given role
+func memoryMessages(value interface{}, role string) []llm.Message {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		if len(v) == 0 {
+			return nil
+		}
+		if messages, ok := chatMessages(v); ok {
+			return messages
+		}
+	case map[string]interface{}:
+		if messages, ok := chatMessages([]interface{}{v}); ok {
+			return messages
+		}
+	case string:
+		if v == "" {
+			return nil
+		}
+	}
+	return []llm.Message{{Role: role, Content: expr.ToString(value)}}
+}
+
+// lastMessages returns the last n messages. A window never starts on a tool
+// result, whose call would be missing.
+func lastMessages(messages []llm.Message, n int) []llm.Message {
+	start := len(messages) - n
+	if start < 0 {
+		start = 0
+	}
+	for start < len(messages) && messages[start].Role == llm.RoleTool {
+		start++
+	}
+	return messages[start:]
+}
+
+// fitTokens returns the most recent messages whose estimated tokens fit the
+// limit, and at least the last message
+func fitTokens(messages []llm.Message, limit int) []llm.Message {
+	used := 0
+	start := len(messages)
+	for start > 0 {
+		tokens := llm.EstimateTokens(&llm.ChatRequest{Messages: messages[start-1 : start]})
+		if used+tokens > limit && start < len(messages) {
+			break
+		}
+		used += tokens
+		start--
+	}
+	return lastMessages(messages, len(messages)-start)
+}
+
+// summarize folds the session's messages up to end into its summary
+func summarize(ctx context.Context, nc *NodeContext, session *Session, end int) error {
+	if model := dataString(nc.Node, "model", ""); model == "" {
+		return fmt.Errorf("summary memory requires a model")
+	}
+	provider, err := nc.Engine.provider(nc.Node)
+	if err != nil {
+		return err
+	}
+
+	var transcript strings.Builder
+	if session.Summary != "" {
+		fmt.Fprintf(&transcript, "Current summary:\n%s\n\n", session.Summary)
+	}
+	transcript.WriteString("New messages:\n")
+	for _, message := range session.Messages[session.Summarized:end] {
+		fmt.Fprintf(&transcript, "%s: %s\n", message.Role, message.Content)
+		for _, call := range message.ToolCalls {
+			arguments, _ := json.Marshal(call.Arguments)
+			fmt.Fprintf(&transcript, "%s called %s(%s)\n", message.Role, call.Name, arguments)
+		}
+	}
+
+	req := &llm.ChatRequest{
+		Model: dataString(nc.Node, "model", ""),
+		Messages: []llm.Message{
+			{Role: llm.RoleSystem, Content: dataString(nc.Node, "summary_prompt", defaultSummaryPrompt)},
+			{Role: llm.RoleUser, Content: transcript.String()},
+		},
+	}
+	resp, err := nc.Engine.chat(ctx, nc, provider, req, nil)
+	if err != nil {
+		return fmt.Errorf("failed to summarize session: %w", err)
+	}
+
+	session.Summary = strings.TrimSpace(resp.Message.Content)
+	session.Summarized = end
+	return nil
+}
+
+// SupabaseSessionStore stores sessions in the Supabase "sessions" table,
+// whose primary key is (workspace_id, id)
+type SupabaseSessionStore struct {
+	client *database.SupabaseClient
+}
+
+// NewSupabaseSessionStore initializes a new Supabase-based SessionStore
+func NewSupabaseSessionStore(client *database.SupabaseClient) *SupabaseSessionStore {
+	return &SupabaseSessionStore{
+		client: client,
+	}
+}
+
+// CreateSession inserts a new session
+func (s *SupabaseSessionStore) CreateSession(session *Session) error {
+	body, status, err := s.client.Request("POST", "sessions", session)
+	if err != nil {
+		return err
+	}
+
+	if status != http.StatusCreated {
+		log.Printf("Supabase returned status %d: %s", status, string(body))
+		return fmt.Errorf("failed to create session: %s", string(body))
+	}
+
+	return nil
+}
+
+// UpdateSession overwrites an existing session
+func (s *SupabaseSessionStore) UpdateSession(session *Session) error {
+	query := url.Values{}
+	query.Set("workspace_id", "eq."+session.WorkspaceID.String())
+	query.Set("id", "eq."+session.ID)
+
+	body, status, err := s.client.Request("PATCH", "sessions?"+query.Encode(), session)
+	if err != nil {
+		return err
+	}
+
+	if status != http.StatusOK && status != http.StatusNoContent {
+		log.Printf("Supabase returned status %d: %s", status, string(body))
+		return fmt.Errorf("failed to update session: %s", string(body))
+	}
+
+	return nil
+}
+
+// GetSession retrieves a workspace's session by ID
+func (s *SupabaseSessionStore) GetSession(workspaceID uuid.UUID, id string) (*Session, error) {
+	query := url.Values{}
+	query.Set("workspace_id", "eq."+workspaceID.String())
+	query.Set("id", "eq."+id)
+
+	body, status, err := s.client.Request("GET", "sessions?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK {
+		log.Printf("Supabase returned status %d: %s", status, string(body))
+		return nil, fmt.Errorf("failed to get session: %s", string(body))
+	}
+
+	var sessions []Session
+	if err := json.Unmarshal(body, &sessions); err != nil {
+		return nil, err
+	}
+
+	if len(sessions) == 0 {
+		return nil, ErrSessionNotFound
+	}
+
+	return &sessions[0], nil
+}
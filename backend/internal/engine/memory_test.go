@@ -0,0 +1,124 @@
+package engine
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/xizko39/nodeloom/internal/llm"
+	"github.com/xizko39/nodeloom/internal/workspace"
+)
+
+// memorySessionStore keeps sessions in memory
+type memorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]Session
+}
+
+func newMemorySessionStore() *memorySessionStore {
+	return &memorySessionStore{sessions: make(map[string]Session)}
+}
+
+func sessionKey(workspaceID uuid.UUID, id string) string {
+	return workspaceID.String() + "/" + id
+}
+
+func (s *memorySessionStore) CreateSession(session *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := *session
+	copied.Messages = append([]llm.Message(nil), session.Messages...)
+	s.sessions[sessionKey(session.WorkspaceID, session.ID)] = copied
+	return nil
+}
+
+func (s *memorySessionStore) UpdateSession(session *Session) error {
+	return s.CreateSession(session)
+}
+
+func (s *memorySessionStore) GetSession(workspaceID uuid.UUID, id string) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[sessionKey(workspaceID, id)]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	session.Messages = append([]llm.Message(nil), session.Messages...)
+	return &session, nil
+}
+
+func chatFlow(data map[string]interface{}) *workspace.Workspace {
+	return flow(
+		workspace.Node{Type: workspace.InputNode, Label: "message"},
+		workspace.Node{Type: workspace.MemoryNode, Label: "memory", Data: data},
+		workspace.Node{Type: workspace.OutputNode, Label: "history"},
+	)
+}
+
+func TestMemorySessionsBelongToWorkspace(t *testing.T) {
+	first := chatFlow(map[string]interface{}{"session_id": "default"})
+	second := chatFlow(map[string]interface{}{"session_id": "default"})
+	e, _ := mockEngine(t, &llm.Fixture{}, memoryWorkspaces{first.ID: first, second.ID: second})
+	sessions := newMemorySessionStore()
+	e.UseSessions(sessions)
+
+	runFlow(t, e, first, map[string]interface{}{"message": "first workspace"})
+	run := runFlow(t, e, second, map[string]interface{}{"message": "second workspace"})
+	if run.Status != StatusSucceeded {
+		t.Fatalf("status = %s, error = %q", run.Status, run.Error)
+	}
+
+	history := run.Outputs["history"].([]interface{})
+	if len(history) != 1 || history[0].(map[string]interface{})["content"] != "second workspace" {
+		t.Errorf("history = %v, want only the second workspace's message", history)
+	}
+	session, err := sessions.GetSession(first.ID, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(session.Messages) != 1 || session.Messages[0].Content != "first workspace" {
+		t.Errorf("first workspace's session = %+v", session.Messages)
+	}
+}
+
+func TestMemorySummaryKeepsToolCallsWithResults(t *testing.T) {
+	ws := chatFlow(map[string]interface{}{
+		"session_id": "s",
+		"strategy":   MemorySummary,
+		"window":     float64(3),
+		"model":      "mock-model",
+	})
+	e, _ := mockEngine(t, &llm.Fixture{Responses: []*llm.MockResponse{
+		{Reply: "The user asked for the time."},
+	}}, memoryWorkspaces{ws.ID: ws})
+	sessions := newMemorySessionStore()
+	e.UseSessions(sessions)
+
+	sessions.CreateSession(&Session{ID: "s", WorkspaceID: ws.ID, Messages: []llm.Message{
+		{Role: llm.RoleUser, Content: "What time is it?"},
+		{Role: llm.RoleAssistant, ToolCalls: []llm.ToolCall{{ID: "call_1", Name: "clock", Arguments: map[string]interface{}{}}}},
+		{Role: llm.RoleTool, ToolCallID: "call_1", Content: "12:00"},
+		{Role: llm.RoleAssistant, Content: "It is noon."},
+	}})
+
+	// With the new message, a window of three would start on the tool result
+	run := runFlow(t, e, ws, map[string]interface{}{"message": "Thanks"})
+	if run.Status != StatusSucceeded {
+		t.Fatalf("status = %s, error = %q", run.Status, run.Error)
+	}
+
+	history := run.Outputs["history"].([]interface{})
+	var roles []string
+	for _, raw := range history {
+		roles = append(roles, raw.(map[string]interface{})["role"].(string))
+	}
+	want := []string{llm.RoleSystem, llm.RoleAssistant, llm.RoleUser}
+	if len(roles) != len(want) || roles[0] != want[0] || roles[1] != want[1] || roles[2] != want[2] {
+		t.Errorf("history roles = %v, want %v", roles, want)
+	}
+
+	session, _ := sessions.GetSession(ws.ID, "s")
+	if session.Summarized != 3 || session.Summary != "The user asked for the time." {
+		t.Errorf("summarized = %d, summary = %q", session.Summarized, session.Summary)
+	}
+}
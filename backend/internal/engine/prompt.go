@@ -0,0 +1,74 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/xizko39/nodeloom/internal/expr"
+	"github.com/xizko39/nodeloom/internal/workspace"
+)
+
+// promptExecutor renders a chat message list. Node data:
+//
+//	messages: [{"role": "system", "content": "You answer questions about {{ topic }}."},
+//	           {"role": "user", "content": "{{> question_format }}"}]
+//
+// Placeholders are rendered by the engine before the node runs, so each
+// input port is available by name and partials are included with
+// {{> name }}. The rendered messages are emitted on the output port.
+type promptExecutor struct{}
+
+func (p *promptExecutor) Execute(ctx context.Context, nc *NodeContext) (map[string]interface{}, error) {
+	messages, err := promptMessages(nc.Node)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{DefaultPort: messages}, nil
+}
+
+// promptMessages reads the rendered message list from a prompt node
+func promptMessages(node *workspace.Node) ([]interface{}, error) {
+	raw, ok := node.Data["messages"].([]interface{})
+	if !ok || len(raw) == 0 {
+		return nil, fmt.Errorf("prompt has no messages")
+	}
+
+	messages := make([]interface{}, 0, len(raw))
+	for i, item := range raw {
+		fields, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("message %d is not an object", i)
+		}
+		role, _ := fields["role"].(string)
+		switch role {
+		case "system", "user", "assistant":
+		default:
+			return nil, fmt.Errorf("message %d has invalid role %q", i, role)
+		}
+		messages = append(messages, map[string]interface{}{
+			"role":    role,
+			"content": expr.ToString(fields["content"]),
+		})
+	}
+
+	return messages, nil
+}
+
+// RenderPrompt renders a prompt node of a workspace against sample inputs
+// without running anything else. Steps are empty and the run carries only
+// the given inputs.
+func RenderPrompt(ws *workspace.Workspace, node *workspace.Node, inputs map[string]interface{}) ([]interface{}, error) {
+	if node.Type != workspace.PromptNode {
+		return nil, fmt.Errorf("node is a %s node, not a prompt", node.Type)
+	}
+	if inputs == nil {
+		inputs = make(map[string]interface{})
+	}
+
+	vars := templateVars(inputs, map[string]interface{}{}, map[string]interface{}{"inputs": inputs})
+	resolved, err := resolveNode(node, ws.Partials, vars)
+	if err != nil {
+		return nil, err
+	}
+	return promptMessages(resolved)
+}
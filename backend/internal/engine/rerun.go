@@ -0,0 +1,100 @@
+package engine
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/google/uuid"
+	"github.com/xizko39/nodeloom/internal/workspace"
+)
+
+// ErrInvalidRerun is returned when a partial rerun cannot be set up as requested
+var ErrInvalidRerun = fmt.Errorf("invalid rerun")
+
+// RerunOptions selects the nodes a partial rerun executes again. The nodes
+// in StartFrom and Only are re-executed together with everything downstream
+// of them, so no descendant reuses a result computed from their old outputs.
+// The two lists are equivalent; both are accepted because clients use both
+// names.
+type RerunOptions struct {
+	StartFrom []uuid.UUID
+	Only      []uuid.UUID
+}
+
+// NewRerun prepares a run that reuses the results of a previous run for
+// every node that is not selected. Unselected nodes that did not succeed or
+// get skipped previously have nothing to reuse and run as usual. When inputs
+// is nil the previous run's inputs are used; otherwise the INPUT nodes whose
+// value changed are selected too, so the new inputs take effect.
+func NewRerun(ws *workspace.Workspace, previous *Run, inputs map[string]interface{}, opts RerunOptions) (*Run, error) {
+	if previous.WorkspaceID != ws.ID {
+		return nil, fmt.Errorf("%w: run %s belongs to another workspace", ErrInvalidRerun, previous.ID)
+	}
+	if inputs == nil {
+		inputs = copyMap(previous.Inputs)
+	}
+
+	nodeIDs := make(map[uuid.UUID]bool, len(ws.Nodes))
+	for _, n := range ws.Nodes {
+		nodeIDs[n.ID] = true
+	}
+
+	selected := make(map[uuid.UUID]bool)
+	var queue []uuid.UUID
+	for _, id := range append(append([]uuid.UUID{}, opts.StartFrom...), opts.Only...) {
+		if !nodeIDs[id] {
+			return nil, fmt.Errorf("%w: node %s is not in the workspace", ErrInvalidRerun, id)
+		}
+		if !selected[id] {
+			selected[id] = true
+			queue = append(queue, id)
+		}
+	}
+	for _, n := range ws.Nodes {
+		if n.Type != workspace.InputNode || selected[n.ID] {
+			continue
+		}
+		port := n.PortName()
+		value, ok := inputs[port]
+		old, hadOld := previous.Inputs[port]
+		if ok != hadOld || !reflect.DeepEqual(value, old) {
+			selected[n.ID] = true
+			queue = append(queue, n.ID)
+		}
+	}
+	if len(queue) == 0 {
+		return nil, fmt.Errorf("%w: no nodes selected", ErrInvalidRerun)
+	}
+
+	// Everything downstream of a selected node runs again too
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, e := range ws.Edges {
+			if e.Source == id && nodeIDs[e.Target] && !selected[e.Target] {
+				selected[e.Target] = true
+				queue = append(queue, e.Target)
+			}
+		}
+	}
+
+	run := NewRun(ws.ID, inputs)
+	parentID := previous.ID
+	run.ParentRunID = &parentID
+
+	for id := range nodeIDs {
+		prev, ok := previous.Nodes[id]
+		if selected[id] || !ok {
+			continue
+		}
+		if prev.Status != StatusSucceeded && prev.Status != StatusSkipped {
+			continue
+		}
+		reused := *prev
+		reused.Reused = true
+		reused.Usage = nil // Spent by the earlier run
+		run.Nodes[id] = &reused
+	}
+
+	return run, nil
+}
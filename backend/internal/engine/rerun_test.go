@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/xizko39/nodeloom/internal/expr"
+	"github.com/xizko39/nodeloom/internal/llm"
+	"github.com/xizko39/nodeloom/internal/workspace"
+)
+
+func TestRerunWithNewInputs(t *testing.T) {
+	// Two independent chains: a → upper → A and b → upper → B
+	ws := flow(
+		workspace.Node{Type: workspace.InputNode, Label: "a"},
+		workspace.Node{Type: "UPPER", Label: "upper a"},
+		workspace.Node{Type: workspace.OutputNode, Label: "A"},
+	)
+	second := flow(
+		workspace.Node{Type: workspace.InputNode, Label: "b"},
+		workspace.Node{Type: "UPPER", Label: "upper b"},
+		workspace.Node{Type: workspace.OutputNode, Label: "B"},
+	)
+	for i := range second.Nodes {
+		second.Nodes[i].WorkspaceID = ws.ID
+	}
+	ws.Nodes = append(ws.Nodes, second.Nodes...)
+	ws.Edges = append(ws.Edges, second.Edges...)
+
+	e, _ := mockEngine(t, &llm.Fixture{}, memoryWorkspaces{ws.ID: ws})
+	var calls atomic.Int32
+	e.Register("UPPER", ExecutorFunc(func(ctx context.Context, nc *NodeContext) (map[string]interface{}, error) {
+		calls.Add(1)
+		return map[string]interface{}{DefaultPort: strings.ToUpper(expr.ToString(nc.Inputs[DefaultInput]))}, nil
+	}))
+
+	previous := runFlow(t, e, ws, map[string]interface{}{"a": "x", "b": "y"})
+	if previous.Status != StatusSucceeded || calls.Load() != 2 {
+		t.Fatalf("status = %s, calls = %d", previous.Status, calls.Load())
+	}
+
+	// Unchanged inputs and no nodes: nothing would run again
+	if _, err := NewRerun(ws, previous, nil, RerunOptions{}); !errors.Is(err, ErrInvalidRerun) {
+		t.Errorf("rerun without changes: error = %v, want ErrInvalidRerun", err)
+	}
+
+	// A new value for b reruns its chain and reuses the other
+	rerun, err := NewRerun(ws, previous, map[string]interface{}{"a": "x", "b": "z"}, RerunOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls.Store(0)
+	_, done, err := e.Start(ws, rerun)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := (<-done).snapshot()
+	if run.Status != StatusSucceeded {
+		t.Fatalf("status = %s, error = %q", run.Status, run.Error)
+	}
+	if run.Outputs["A"] != "X" || run.Outputs["B"] != "Z" {
+		t.Errorf("outputs = %v, want A=X and B=Z", run.Outputs)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("upper ran %d times, want once", calls.Load())
+	}
+	if !nodeRun(t, run, ws, 1).Reused || nodeRun(t, run, ws, 4).Reused {
+		t.Errorf("upper a reused = %v, upper b reused = %v", nodeRun(t, run, ws, 1).Reused, nodeRun(t, run, ws, 4).Reused)
+	}
+}
@@ -0,0 +1,192 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"time"
+
+	"github.com/xizko39/nodeloom/internal/workspace"
+)
+
+// ErrorClass groups node errors for retry decisions
+type ErrorClass string
+
+const (
+	ErrorTimeout   ErrorClass = "timeout"    // The node, or a call it made, timed out
+	ErrorTransient ErrorClass = "transient"  // Temporary failure such as a dropped connection or a 5xx response
+	ErrorRateLimit ErrorClass = "rate_limit" // The callee asked us to slow down
+	ErrorPermanent ErrorClass = "permanent"  // Retrying will not help
+)
+
+// ClassifiedError attaches an ErrorClass to an error. Executors return it to
+// let retry policies tell transient failures from permanent ones. RetryAfter
+// is how long the callee asked us to wait, if it said.
+type ClassifiedError struct {
+	Class      ErrorClass
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *ClassifiedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ClassifiedError) Unwrap() error {
+	return e.Err
+}
+
+// Classify returns the class of an error. Unclassified errors are permanent
+// unless they are timeouts or network failures.
+func Classify(err error) ErrorClass {
+	var classified *ClassifiedError
+	if errors.As(err, &classified) {
+		return classified.Class
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return ErrorTimeout
+		}
+		return ErrorTransient
+	}
+	return ErrorPermanent
+}
+
+// RetryPolicy controls how often a failing node is attempted again. Node data:
+//
+//	retry: {"max_attempts": 3, "backoff": 1, "max_backoff": 30,
+//	        "multiplier": 2, "retry_on": ["timeout", "transient", "rate_limit"]}
+//
+// Backoff values are in seconds; the delay grows by multiplier after every
+// attempt up to max_backoff, and is stretched to any Retry-After the callee
+// sent. "any" in retry_on retries every error class.
+type RetryPolicy struct {
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	Multiplier  float64
+	RetryOn     map[ErrorClass]bool
+}
+
+// defaultRetryOn lists the error classes retried when retry_on is not set
+var defaultRetryOn = []ErrorClass{ErrorTimeout, ErrorTransient, ErrorRateLimit}
+
+// retryPolicy reads a node's retry policy, reporting false when it has none
+func retryPolicy(node *workspace.Node) (RetryPolicy, bool) {
+	raw, ok := node.Data["retry"].(map[string]interface{})
+	if !ok {
+		return RetryPolicy{}, false
+	}
+	settings := &workspace.Node{Data: raw}
+
+	policy := RetryPolicy{
+		MaxAttempts: dataInt(settings, "max_attempts", 3),
+		Backoff:     seconds(dataFloat(settings, "backoff", 1)),
+		MaxBackoff:  seconds(dataFloat(settings, "max_backoff", 30)),
+		Multiplier:  dataFloat(settings, "multiplier", 2),
+		RetryOn:     make(map[ErrorClass]bool),
+	}
+	if policy.Multiplier < 1 {
+		policy.Multiplier = 1
+	}
+
+	classes, _ := raw["retry_on"].([]interface{})
+	for _, class := range classes {
+		if name, ok := class.(string); ok {
+			policy.RetryOn[ErrorClass(name)] = true
+		}
+	}
+	if len(policy.RetryOn) == 0 {
+		for _, class := range defaultRetryOn {
+			policy.RetryOn[class] = true
+		}
+	}
+
+	return policy, true
+}
+
+// retries reports whether errors of the class are retried
+func (p RetryPolicy) retries(class ErrorClass) bool {
+	return p.RetryOn["any"] || p.RetryOn[class]
+}
+
+// delay returns the wait after the given attempt
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := float64(p.Backoff) * math.Pow(p.Multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		return p.MaxBackoff
+	}
+	return time.Duration(d)
+}
+
+// nodeTimeout reads the per-attempt timeout in seconds from node data
+func nodeTimeout(node *workspace.Node) time.Duration {
+	return seconds(dataFloat(node, "timeout", 0))
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// executeWithRetry runs a node under its timeout and retry policy. Attempts
+// are only recorded for nodes with a retry policy. Nodes that have streamed
+// output are not retried, since their consumers have already seen it.
+func (x *execution) executeWithRetry(ctx context.Context, executor Executor, nc *NodeContext) (map[string]interface{}, []Attempt, error) {
+	policy, hasPolicy := retryPolicy(nc.Node)
+	timeout := nodeTimeout(nc.Node)
+
+	var attempts []Attempt
+	for n := 1; ; n++ {
+		nc.resetIterations()
+
+		attempt := Attempt{Number: n, StartedAt: now()}
+		outputs, err := executeOnce(ctx, executor, nc, timeout)
+		attempt.FinishedAt = now()
+		if err != nil {
+			attempt.Error = err.Error()
+			attempt.Class = Classify(err)
+		}
+		if hasPolicy {
+			attempts = append(attempts, attempt)
+		}
+
+		if err == nil || ctx.Err() != nil || !hasPolicy || n >= policy.MaxAttempts || !policy.retries(attempt.Class) || nc.streamed() {
+			return outputs, attempts, err
+		}
+
+		// Wait at least as long as the callee asked
+		delay := policy.delay(n)
+		var classified *ClassifiedError
+		if errors.As(err, &classified) && classified.RetryAfter > delay {
+			delay = classified.RetryAfter
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, attempts, context.Cause(ctx)
+		}
+	}
+}
+
+// executeOnce runs a single attempt, bounded by the node's timeout
+func executeOnce(ctx context.Context, executor Executor, nc *NodeContext, timeout time.Duration) (map[string]interface{}, error) {
+	if timeout <= 0 {
+		return executor.Execute(ctx, nc)
+	}
+
+	attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	outputs, err := executor.Execute(attemptCtx, nc)
+	if err != nil && ctx.Err() == nil && attemptCtx.Err() != nil {
+		return nil, &ClassifiedError{Class: ErrorTimeout, Err: fmt.Errorf("node timed out after %s", timeout)}
+	}
+	return outputs, err
+}
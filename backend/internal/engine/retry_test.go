@@ -0,0 +1,33 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/xizko39/nodeloom/internal/workspace"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	tests := []struct {
+		retry   map[string]interface{}
+		attempt int
+		want    time.Duration
+	}{
+		{map[string]interface{}{}, 1, time.Second},
+		{map[string]interface{}{}, 3, 4 * time.Second},
+		{map[string]interface{}{}, 10, 30 * time.Second},
+		{map[string]interface{}{"backoff": 0.5, "multiplier": float64(3)}, 2, 1500 * time.Millisecond},
+		{map[string]interface{}{"backoff": float64(2), "multiplier": 0.5}, 4, 2 * time.Second},
+		{map[string]interface{}{"backoff": float64(10), "max_backoff": float64(15)}, 2, 15 * time.Second},
+		{map[string]interface{}{"backoff": float64(10), "max_backoff": float64(0)}, 4, 80 * time.Second},
+	}
+	for _, tt := range tests {
+		policy, ok := retryPolicy(&workspace.Node{Data: map[string]interface{}{"retry": tt.retry}})
+		if !ok {
+			t.Fatalf("retry %v: no policy", tt.retry)
+		}
+		if got := policy.delay(tt.attempt); got != tt.want {
+			t.Errorf("retry %v: delay(%d) = %s, want %s", tt.retry, tt.attempt, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package engine
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Status is the state of a run or of a single node within a run
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusSkipped   Status = "skipped"   // Node was on a branch that was not taken
+	StatusCancelled Status = "cancelled" // Run was cancelled while the node was pending or running
+	StatusPaused    Status = "paused"    // Stopped at a breakpoint, waiting to be resumed
+	StatusWaiting   Status = "waiting"   // Suspended until something outside the run, such as an approval, completes the node
+)
+
+// Run records one execution of a workspace
+type Run struct {
+	ID          uuid.UUID              `json:"id"`
+	WorkspaceID uuid.UUID              `json:"workspace_id"`
+	Status      Status                 `json:"status"`
+	Inputs      map[string]interface{} `json:"inputs"`
+	Outputs     map[string]interface{} `json:"outputs"`
+	Nodes       map[uuid.UUID]*NodeRun `json:"nodes"`
+	Error       string                 `json:"error,omitempty"`
+	ParentRunID *uuid.UUID             `json:"parent_run_id,omitempty"` // Run whose results a partial rerun reused
+	Timeout     float64                `json:"timeout,omitempty"`       // Seconds the whole run may take; zero means no limit
+	Breakpoints []uuid.UUID            `json:"breakpoints,omitempty"`   // Nodes to pause before, besides those flagged in node data
+	Stepping    bool                   `json:"stepping,omitempty"`      // Pause before every node
+	Paused      *Pause                 `json:"paused,omitempty"`        // Where the run is waiting while paused
+	Budget      float64                `json:"budget,omitempty"`        // US dollars the run may spend on LLM calls; zero means no limit
+	Usage       *Usage                 `json:"usage,omitempty"`         // LLM calls made by the run, including nested runs
+	CreatedBy   string                 `json:"created_by,omitempty"`    // Username of whoever started the run
+	CreatedAt   time.Time              `json:"created_at"`
+	StartedAt   *time.Time             `json:"started_at,omitempty"`
+	FinishedAt  *time.Time             `json:"finished_at,omitempty"`
+}
+
+// NodeRun records the execution of a single node within a run
+type NodeRun struct {
+	NodeID     uuid.UUID              `json:"node_id"`
+	Status     Status                 `json:"status"`
+	Inputs     map[string]interface{} `json:"inputs,omitempty"`
+	Outputs    map[string]interface{} `json:"outputs,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	Iterations []*Run                 `json:"iterations,omitempty"` // One nested run per loop iteration
+	Reused     bool                   `json:"reused,omitempty"`     // Result was copied from the parent run
+	Cached     bool                   `json:"cached,omitempty"`     // Outputs were served from the output cache
+	Attempts   []Attempt              `json:"attempts,omitempty"`   // Recorded for nodes with a retry policy
+	ToolCalls  []ToolInvocation       `json:"tool_calls,omitempty"` // Tools an agent node called, in order
+	Usage      *Usage                 `json:"usage,omitempty"`      // LLM calls made by the node, including nested runs
+	StartedAt  *time.Time             `json:"started_at,omitempty"`
+	FinishedAt *time.Time             `json:"finished_at,omitempty"`
+}
+
+// PauseReason tells why a run stopped
+type PauseReason string
+
+const (
+	PauseBreakpoint PauseReason = "breakpoint" // Stopped before the node; resumed by the user
+	PauseWaiting    PauseReason = "waiting"    // The node is waiting on something outside the run
+)
+
+// Pause describes a run stopped at a node. Inputs are the values the node
+// receives; at a breakpoint they may be edited before resuming.
+type Pause struct {
+	NodeID   uuid.UUID              `json:"node_id"`
+	Reason   PauseReason            `json:"reason"`
+	WaitID   *uuid.UUID             `json:"wait_id,omitempty"` // What the node waits on, such as an approval
+	Inputs   map[string]interface{} `json:"inputs"`
+	PausedAt time.Time              `json:"paused_at"`
+}
+
+// status returns the status a run and its node take while paused
+func (p *Pause) status() Status {
+	if p.Reason == PauseWaiting {
+		return StatusWaiting
+	}
+	return StatusPaused
+}
+
+// Attempt records one try at executing a node
+type Attempt struct {
+	Number     int        `json:"number"`
+	Error      string     `json:"error,omitempty"`
+	Class      ErrorClass `json:"class,omitempty"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// ToolInvocation records one tool call made by an agent node
+type ToolInvocation struct {
+	ID         string                 `json:"id"`
+	Tool       string                 `json:"tool"`
+	Arguments  map[string]interface{} `json:"arguments"`
+	Result     interface{}            `json:"result,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	Run        *Run                   `json:"run,omitempty"` // Nested run of a workspace tool
+	StartedAt  *time.Time             `json:"started_at,omitempty"`
+	FinishedAt *time.Time             `json:"finished_at,omitempty"`
+}
+
+// NewRun creates a pending run for a workspace
+func NewRun(workspaceID uuid.UUID, inputs map[string]interface{}) *Run {
+	if inputs == nil {
+		inputs = make(map[string]interface{})
+	}
+	return &Run{
+		ID:          uuid.New(),
+		WorkspaceID: workspaceID,
+		Status:      StatusPending,
+		Inputs:      inputs,
+		Outputs:     make(map[string]interface{}),
+		Nodes:       make(map[uuid.UUID]*NodeRun),
+		CreatedAt:   time.Now().UTC(),
+	}
+}
+
+// Finished reports whether the run has reached a terminal state
+func (r *Run) Finished() bool {
+	return r.Status == StatusSucceeded || r.Status == StatusFailed || r.Status == StatusCancelled
+}
+
+func now() *time.Time {
+	t := time.Now().UTC()
+	return &t
+}
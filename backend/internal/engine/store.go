@@ -0,0 +1,160 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/xizko39/nodeloom/internal/database"
+)
+
+var (
+	ErrRunNotFound  = fmt.Errorf("run not found")
+	ErrRunNotActive = fmt.Errorf("run is not in progress")
+	ErrRunCancelled = fmt.Errorf("run cancelled")
+	ErrRunTimedOut  = fmt.Errorf("run timed out")
+)
+
+// RunStore persists run records
+type RunStore interface {
+	CreateRun(run *Run) error
+	UpdateRun(run *Run) error
+	GetRun(id uuid.UUID) (*Run, error)
+	ListRuns(workspaceID uuid.UUID) ([]Run, error)
+}
+
+// SupabaseRunStore stores runs in the Supabase "runs" table
+type SupabaseRunStore struct {
+	client *database.SupabaseClient
+}
+
+// NewSupabaseRunStore initializes a new Supabase-based RunStore
+func NewSupabaseRunStore(client *database.SupabaseClient) *SupabaseRunStore {
+	return &SupabaseRunStore{
+		client: client,
+	}
+}
+
+// CreateRun inserts a new run record
+func (s *SupabaseRunStore) CreateRun(run *Run) error {
+	body, status, err := s.client.Request("POST", "runs", run)
+	if err != nil {
+		return err
+	}
+
+	if status != http.StatusCreated {
+		log.Printf("Supabase returned status %d: %s", status, string(body))
+		return fmt.Errorf("failed to create run: %s", string(body))
+	}
+
+	return nil
+}
+
+// UpdateRun overwrites an existing run record
+func (s *SupabaseRunStore) UpdateRun(run *Run) error {
+	body, status, err := s.client.Request("PATCH", fmt.Sprintf("runs?id=eq.%s", run.ID.String()), run)
+	if err != nil {
+		return err
+	}
+
+	if status != http.StatusOK && status != http.StatusNoContent {
+		log.Printf("Supabase returned status %d: %s", status, string(body))
+		return fmt.Errorf("failed to update run: %s", string(body))
+	}
+
+	return nil
+}
+
+// GetRun retrieves a run record by ID
+func (s *SupabaseRunStore) GetRun(id uuid.UUID) (*Run, error) {
+	body, status, err := s.client.Request("GET", fmt.Sprintf("runs?id=eq.%s", id.String()), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK {
+		log.Printf("Supabase returned status %d: %s", status, string(body))
+		return nil, fmt.Errorf("failed to get run: %s", string(body))
+	}
+
+	var runs []Run
+	err = json.Unmarshal(body, &runs)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(runs) == 0 {
+		return nil, ErrRunNotFound
+	}
+
+	return &runs[0], nil
+}
+
+// ListRuns retrieves the runs of a workspace, newest first
+func (s *SupabaseRunStore) ListRuns(workspaceID uuid.UUID) ([]Run, error) {
+	endpoint := fmt.Sprintf("runs?workspace_id=eq.%s&order=created_at.desc", workspaceID.String())
+	body, status, err := s.client.Request("GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK {
+		log.Printf("Supabase returned status %d: %s", status, string(body))
+		return nil, fmt.Errorf("failed to fetch runs: %s", string(body))
+	}
+
+	var runs []Run
+	err = json.Unmarshal(body, &runs)
+	if err != nil {
+		return nil, err
+	}
+
+	return runs, nil
+}
+
+// ListRunUsage retrieves the usage of the runs matching filter. Only the
+// fields a usage report needs are fetched.
+func (s *SupabaseRunStore) ListRunUsage(filter UsageFilter) ([]Run, error) {
+	query := url.Values{}
+	query.Set("select", "id,workspace_id,created_by,usage,created_at")
+	query.Set("usage", "not.is.null")
+	if filter.WorkspaceID != nil {
+		query.Set("workspace_id", "eq."+filter.WorkspaceID.String())
+	}
+	if filter.User != "" {
+		query.Set("created_by", "eq."+filter.User)
+	}
+	var created []string
+	if filter.Since != nil {
+		created = append(created, "created_at.gte."+filter.Since.UTC().Format(time.RFC3339))
+	}
+	if filter.Until != nil {
+		created = append(created, "created_at.lt."+filter.Until.UTC().Format(time.RFC3339))
+	}
+	if len(created) > 0 {
+		query.Set("and", "("+strings.Join(created, ",")+")")
+	}
+
+	body, status, err := s.client.Request("GET", "runs?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK {
+		log.Printf("Supabase returned status %d: %s", status, string(body))
+		return nil, fmt.Errorf("failed to fetch run usage: %s", string(body))
+	}
+
+	var runs []Run
+	err = json.Unmarshal(body, &runs)
+	if err != nil {
+		return nil, err
+	}
+
+	return runs, nil
+}
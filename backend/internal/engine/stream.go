@@ -0,0 +1,330 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/xizko39/nodeloom/internal/workspace"
+)
+
+// DefaultStreamBuffer is how many chunks a stream's producer may get ahead
+// of its slowest reader before Send blocks
+const DefaultStreamBuffer = 64
+
+// ErrStreamClosed is returned when sending on a closed stream
+var ErrStreamClosed = fmt.Errorf("stream is closed")
+
+// Stream carries text from a node to the nodes downstream of it while the
+// node is still running, such as the tokens of an LLM completion. Every
+// chunk is kept, so readers attached late still see the whole text. Readers
+// that fall DefaultStreamBuffer chunks behind hold the producer back.
+//
+// A stream marshals to JSON as the text received so far, which is what run
+// records show for stream inputs.
+type Stream struct {
+	mu      sync.Mutex
+	chunks  []string
+	readers map[*StreamReader]bool
+	buffer  int
+	closed  bool
+	err     error
+	changed chan struct{} // Closed and replaced whenever the stream changes
+}
+
+// NewStream creates an open stream
+func NewStream() *Stream {
+	return &Stream{
+		readers: make(map[*StreamReader]bool),
+		buffer:  DefaultStreamBuffer,
+		changed: make(chan struct{}),
+	}
+}
+
+// broadcast wakes everyone waiting on the stream. Callers hold s.mu.
+func (s *Stream) broadcast() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// lag returns how far the slowest reader is behind. Callers hold s.mu.
+func (s *Stream) lag() int {
+	lag := 0
+	for r := range s.readers {
+		if behind := len(s.chunks) - r.pos; behind > lag {
+			lag = behind
+		}
+	}
+	return lag
+}
+
+// Send appends a chunk, waiting while a reader is too far behind
+func (s *Stream) Send(ctx context.Context, chunk string) error {
+	for {
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			return ErrStreamClosed
+		}
+		if s.lag() < s.buffer {
+			s.chunks = append(s.chunks, chunk)
+			s.broadcast()
+			s.mu.Unlock()
+			return nil
+		}
+		changed := s.changed
+		s.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		}
+	}
+}
+
+// Close ends the stream. A non-nil err is reported to readers once they
+// have read every chunk. Closing a closed stream has no effect.
+func (s *Stream) Close(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.err = err
+	s.broadcast()
+}
+
+// Text returns the text sent so far
+func (s *Stream) Text() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return strings.Join(s.chunks, "")
+}
+
+// String returns the text sent so far, so templates render streams as text
+func (s *Stream) String() string {
+	return s.Text()
+}
+
+// MarshalJSON encodes the text sent so far
+func (s *Stream) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.Text())
+}
+
+// Reader attaches a reader that starts at the first chunk
+func (s *Stream) Reader() *StreamReader {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := &StreamReader{stream: s}
+	s.readers[r] = true
+	return r
+}
+
+// Collect reads the stream to its end and returns the whole text
+func (s *Stream) Collect(ctx context.Context) (string, error) {
+	r := s.Reader()
+	defer r.Close()
+
+	var text strings.Builder
+	for {
+		chunk, err := r.Next(ctx)
+		if err == io.EOF {
+			return text.String(), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		text.WriteString(chunk)
+	}
+}
+
+// StreamReader reads the chunks of a stream in order
+type StreamReader struct {
+	stream *Stream
+	pos    int
+}
+
+// Next returns the next chunk, waiting for the producer if needed. It
+// returns io.EOF once the stream has closed cleanly, or the error the
+// stream was closed with.
+func (r *StreamReader) Next(ctx context.Context) (string, error) {
+	s := r.stream
+	for {
+		s.mu.Lock()
+		if r.pos < len(s.chunks) {
+			chunk := s.chunks[r.pos]
+			r.pos++
+			// The producer may be waiting for us to catch up
+			s.broadcast()
+			s.mu.Unlock()
+			return chunk, nil
+		}
+		if s.closed {
+			err := s.err
+			s.mu.Unlock()
+			if err == nil {
+				err = io.EOF
+			}
+			return "", err
+		}
+		changed := s.changed
+		s.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return "", context.Cause(ctx)
+		}
+	}
+}
+
+// Close detaches the reader so it no longer holds the producer back
+func (r *StreamReader) Close() {
+	s := r.stream
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.readers, r)
+	s.broadcast()
+}
+
+// StreamConsumer is implemented by executors that can start while an
+// upstream node is still streaming into them. Their inputs then hold a
+// *Stream rather than text. Nodes of other types receive the whole text once
+// the upstream node has finished.
+type StreamConsumer interface {
+	AcceptsStreams(node *workspace.Node) bool
+}
+
+// openedStream tells the scheduler that a running node started streaming on
+// one of its output ports
+type openedStream struct {
+	nodeID uuid.UUID
+	port   string
+	stream *Stream
+}
+
+// OpenStream starts streaming on an output port. Downstream nodes that
+// accept streams are started straight away; the executor sends chunks, and
+// once it returns, the port's value becomes the stream's whole text for
+// everyone else. A node that has streamed is not retried.
+func (nc *NodeContext) OpenStream(port string) *Stream {
+	stream := NewStream()
+
+	nc.mu.Lock()
+	if nc.streams == nil {
+		nc.streams = make(map[string]*Stream)
+	}
+	nc.streams[port] = stream
+	opened := nc.opened
+	nc.mu.Unlock()
+
+	if opened != nil {
+		opened <- openedStream{nodeID: nc.Node.ID, port: port, stream: stream}
+	}
+	return stream
+}
+
+// streamed reports whether the node has opened any stream
+func (nc *NodeContext) streamed() bool {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	return len(nc.streams) > 0
+}
+
+// finishStreams closes the node's streams and replaces stream outputs with
+// their text, so that recorded and cached outputs are plain values
+func (nc *NodeContext) finishStreams(outputs map[string]interface{}, err error) map[string]interface{} {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+
+	for port, stream := range nc.streams {
+		stream.Close(err)
+		if err != nil {
+			continue
+		}
+		if outputs == nil {
+			outputs = make(map[string]interface{})
+		}
+		if value, ok := outputs[port]; !ok || value == stream {
+			outputs[port] = stream.Text()
+		}
+	}
+	return outputs
+}
+
+// resolveStream takes the edges from a streaming port into nodes that accept
+// streams, so they can start before the streaming node finishes
+func (x *execution) resolveStream(opened openedStream) {
+	for _, i := range x.outgoing[opened.nodeID] {
+		edge := x.ws.Edges[i]
+		port := edge.SourceHandle
+		if port == "" {
+			port = DefaultPort
+		}
+		if port != opened.port || x.edges[i] != edgePending {
+			continue
+		}
+
+		consumer, ok := x.engine.executors[x.nodes[edge.Target].Type].(StreamConsumer)
+		if ok && consumer.AcceptsStreams(x.nodes[edge.Target]) {
+			x.edges[i] = edgeTaken
+			x.values[i] = opened.stream
+		}
+	}
+}
+
+// hasStreams reports whether any input is still streaming
+func hasStreams(inputs map[string]interface{}) bool {
+	for _, value := range inputs {
+		if _, ok := value.(*Stream); ok {
+			return true
+		}
+		if list, ok := value.([]interface{}); ok {
+			for _, item := range list {
+				if _, ok := item.(*Stream); ok {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// collectStreams waits for streaming inputs to finish and replaces them
+// with their text
+func collectStreams(ctx context.Context, value interface{}) (interface{}, error) {
+	switch val := value.(type) {
+	case *Stream:
+		return val.Collect(ctx)
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			collected, err := collectStreams(ctx, item)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = collected
+		}
+		return out, nil
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			collected, err := collectStreams(ctx, item)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = collected
+		}
+		return out, nil
+	}
+	return value, nil
+}
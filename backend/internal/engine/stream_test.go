@@ -0,0 +1,137 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/xizko39/nodeloom/internal/llm"
+	"github.com/xizko39/nodeloom/internal/workspace"
+)
+
+func TestStreamSendWaitsForSlowReader(t *testing.T) {
+	stream := NewStream()
+	stream.buffer = 2
+	reader := stream.Reader()
+	ctx := context.Background()
+
+	for _, chunk := range []string{"a", "b"} {
+		if err := stream.Send(ctx, chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sent := make(chan error, 1)
+	go func() { sent <- stream.Send(ctx, "c") }()
+	select {
+	case err := <-sent:
+		t.Fatalf("Send returned %v with the reader %d chunks behind", err, 2)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if chunk, err := reader.Next(ctx); err != nil || chunk != "a" {
+		t.Fatalf("Next = %q, %v", chunk, err)
+	}
+	select {
+	case err := <-sent:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Send still blocked after the reader caught up")
+	}
+
+	// A cancelled producer stops waiting
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := stream.Send(cancelled, "d"); err == nil {
+		t.Error("Send on a full stream ignored the cancelled context")
+	}
+
+	// Readers that leave no longer hold the producer back
+	reader.Close()
+	if err := stream.Send(ctx, "d"); err != nil {
+		t.Fatal(err)
+	}
+	stream.Close(nil)
+	if text := stream.Text(); text != "abcd" {
+		t.Errorf("text = %q", text)
+	}
+}
+
+func TestOutputStreamsBeforeUpstreamFinishes(t *testing.T) {
+	ws := flow(
+		workspace.Node{Type: workspace.InputNode, Label: "question"},
+		workspace.Node{Type: "TALK", Label: "talk"},
+		workspace.Node{Type: workspace.ProcessNode, Label: "process"},
+		workspace.Node{Type: workspace.OutputNode, Label: "answer"},
+	)
+	e, _ := mockEngine(t, &llm.Fixture{}, memoryWorkspaces{ws.ID: ws})
+
+	// The talking node only finishes once the first chunk has reached the
+	// run's subscribers, through the process node
+	release := make(chan struct{})
+	e.Register("TALK", ExecutorFunc(func(ctx context.Context, nc *NodeContext) (map[string]interface{}, error) {
+		stream := nc.OpenStream(DefaultPort)
+		if err := stream.Send(ctx, "Hello "); err != nil {
+			return nil, err
+		}
+		select {
+		case <-release:
+		case <-time.After(5 * time.Second):
+			return nil, fmt.Errorf("the first chunk was not streamed to the output")
+		}
+		if err := stream.Send(ctx, "world"); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{DefaultPort: stream}, nil
+	}))
+
+	snapshot, done, err := e.Start(ws, NewRun(ws.ID, map[string]interface{}{"question": "Hi"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, ok := e.Subscribe(ctx, snapshot.ID)
+	if !ok {
+		t.Fatal("run has no events")
+	}
+
+	var chunks []string
+	for event := range events {
+		if event.Type == EventChunk {
+			if event.Output != "answer" || event.NodeID == nil || *event.NodeID != ws.Nodes[3].ID {
+				t.Errorf("chunk event = %+v", event)
+			}
+			chunks = append(chunks, event.Text)
+			if len(chunks) == 1 {
+				close(release)
+			}
+		}
+		if event.Type == EventDone {
+			break
+		}
+	}
+
+	var run *Run
+	select {
+	case finished := <-done:
+		run = finished.snapshot()
+	case <-time.After(10 * time.Second):
+		t.Fatal("run did not finish")
+	}
+	if run.Status != StatusSucceeded {
+		t.Fatalf("status = %s, error = %q", run.Status, run.Error)
+	}
+	if len(chunks) != 2 || chunks[0] != "Hello " || chunks[1] != "world" {
+		t.Errorf("streamed chunks = %q", chunks)
+	}
+	if got := run.Outputs["answer"]; got != "Hello world" {
+		t.Errorf("answer = %v", got)
+	}
+	if got := nodeRun(t, run, ws, 2).Outputs[DefaultPort]; got != "Hello world" {
+		t.Errorf("process output = %v", got)
+	}
+}
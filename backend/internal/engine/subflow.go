@@ -0,0 +1,158 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/xizko39/nodeloom/internal/workspace"
+)
+
+// MaxSubflowDepth limits how deeply subflows may nest
+const MaxSubflowDepth = 8
+
+// WorkspaceLoader loads the workspaces referenced by subflow nodes
+type WorkspaceLoader interface {
+	GetWorkspace(id uuid.UUID) (*workspace.Workspace, error)
+}
+
+// RevisionLoader is implemented by loaders that can return a published
+// revision of a workspace
+type RevisionLoader interface {
+	GetWorkspaceRevision(id uuid.UUID, revision int) (*workspace.Workspace, error)
+}
+
+type callStackKey struct{}
+
+// callStack returns the chain of workspace IDs of the subflows being executed
+func callStack(ctx context.Context) []uuid.UUID {
+	stack, _ := ctx.Value(callStackKey{}).([]uuid.UUID)
+	return stack
+}
+
+func withCallStack(ctx context.Context, stack []uuid.UUID) context.Context {
+	return context.WithValue(ctx, callStackKey{}, stack)
+}
+
+// subflowExecutor runs another workspace as a single node. Its INPUT nodes
+// become the subflow node's input handles and its OUTPUT nodes become its
+// output ports. Node data:
+//
+//	workspace_id: ID of the workspace to run
+//	revision:     revision published with POST /workspaces/:id:publish to run instead of the current graph (optional)
+//
+// A value on the default input is routed to the subflow's only INPUT node,
+// and a subflow with a single OUTPUT node also emits on the default port.
+type subflowExecutor struct{}
+
+func (s *subflowExecutor) Execute(ctx context.Context, nc *NodeContext) (map[string]interface{}, error) {
+	targetID, err := uuid.Parse(dataString(nc.Node, "workspace_id", ""))
+	if err != nil {
+		return nil, fmt.Errorf("subflow node requires a valid workspace_id")
+	}
+
+	ctx, err = enterSubflow(ctx, nc, targetID)
+	if err != nil {
+		return nil, err
+	}
+
+	child, err := nc.Engine.loadSubflow(targetID, dataInt(nc.Node, "revision", 0))
+	if err != nil {
+		return nil, err
+	}
+
+	run := NewRun(child.ID, flowInputs(child, nc.Inputs))
+	if err := nc.Engine.executeNested(ctx, child, run); err != nil {
+		return nil, fmt.Errorf("subflow %q: %w", child.Name, err)
+	}
+
+	return portOutputs(child, run.Outputs), nil
+}
+
+// enterSubflow adds a workspace to the call stack of ctx, refusing cycles
+// and nesting deeper than MaxSubflowDepth
+func enterSubflow(ctx context.Context, nc *NodeContext, targetID uuid.UUID) (context.Context, error) {
+	stack := callStack(ctx)
+	if len(stack) == 0 {
+		stack = []uuid.UUID{nc.Run.WorkspaceID}
+	}
+	for _, id := range stack {
+		if id == targetID {
+			return nil, fmt.Errorf("subflow cycle detected: %s", formatStack(append(stack, targetID)))
+		}
+	}
+	if len(stack) > MaxSubflowDepth {
+		return nil, fmt.Errorf("subflows nested deeper than %d levels", MaxSubflowDepth)
+	}
+
+	stack = append(append([]uuid.UUID(nil), stack...), targetID)
+	return withCallStack(ctx, stack), nil
+}
+
+// flowInputs maps a node's inputs onto the INPUT nodes of a graph. A value
+// on the default input goes to the graph's only INPUT node.
+func flowInputs(ws *workspace.Workspace, nodeInputs map[string]interface{}) map[string]interface{} {
+	inputs := make(map[string]interface{}, len(nodeInputs))
+	for k, v := range nodeInputs {
+		inputs[k] = v
+	}
+	if value, ok := inputs[DefaultInput]; ok {
+		if names := portNames(ws, workspace.InputNode); len(names) == 1 {
+			delete(inputs, DefaultInput)
+			inputs[names[0]] = value
+		}
+	}
+	return inputs
+}
+
+// portOutputs exposes a graph's outputs as node output ports. A graph with a
+// single OUTPUT node also emits on the default port.
+func portOutputs(ws *workspace.Workspace, runOutputs map[string]interface{}) map[string]interface{} {
+	outputs := make(map[string]interface{}, len(runOutputs)+1)
+	for k, v := range runOutputs {
+		outputs[k] = v
+	}
+	if names := portNames(ws, workspace.OutputNode); len(names) == 1 {
+		if value, ok := runOutputs[names[0]]; ok {
+			outputs[DefaultPort] = value
+		}
+	}
+	return outputs
+}
+
+// loadSubflow loads the current graph or a published revision of a workspace
+func (e *Engine) loadSubflow(id uuid.UUID, revision int) (*workspace.Workspace, error) {
+	if e.workspaces == nil {
+		return nil, fmt.Errorf("subflows are not available: no workspace loader configured")
+	}
+
+	if revision > 0 {
+		revisions, ok := e.workspaces.(RevisionLoader)
+		if !ok {
+			return nil, fmt.Errorf("published revisions are not available")
+		}
+		return revisions.GetWorkspaceRevision(id, revision)
+	}
+
+	return e.workspaces.GetWorkspace(id)
+}
+
+// portNames lists the port names of a workspace's INPUT or OUTPUT nodes
+func portNames(ws *workspace.Workspace, nodeType workspace.NodeType) []string {
+	var names []string
+	for i := range ws.Nodes {
+		if ws.Nodes[i].Type == nodeType {
+			names = append(names, ws.Nodes[i].PortName())
+		}
+	}
+	return names
+}
+
+func formatStack(stack []uuid.UUID) string {
+	parts := make([]string, len(stack))
+	for i, id := range stack {
+		parts[i] = id.String()
+	}
+	return strings.Join(parts, " -> ")
+}
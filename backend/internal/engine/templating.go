@@ -0,0 +1,113 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/xizko39/nodeloom/internal/expr"
+	"github.com/xizko39/nodeloom/internal/workspace"
+)
+
+// templateVars builds the variables visible to templates in a node's data:
+//
+//	inputs  all inputs of the node, by port
+//	input   the default input
+//	steps   outputs of completed nodes, by label and by node ID
+//	run     the run's ID and inputs
+//
+// Each input port is also visible under its own name, so "{{ question }}"
+// reads the "question" input.
+func (x *execution) templateVars(inputs map[string]interface{}) map[string]interface{} {
+	steps := make(map[string]interface{})
+	for id, nodeRun := range x.run.Nodes {
+		if nodeRun.Status != StatusSucceeded {
+			continue
+		}
+		outputs := copyMap(nodeRun.Outputs)
+		steps[id.String()] = outputs
+		if node := x.nodes[id]; node != nil && node.Label != "" {
+			steps[node.Label] = outputs
+		}
+	}
+
+	return templateVars(inputs, steps, map[string]interface{}{
+		"id":     x.run.ID.String(),
+		"inputs": x.run.Inputs,
+	})
+}
+
+func templateVars(inputs, steps, run map[string]interface{}) map[string]interface{} {
+	vars := make(map[string]interface{}, len(inputs)+4)
+	for port, value := range inputs {
+		vars[port] = value
+	}
+	vars["inputs"] = inputs
+	vars["input"] = inputs[DefaultInput]
+	vars["steps"] = steps
+	vars["run"] = run
+	return vars
+}
+
+// resolveNode returns a copy of the node with every template in its data
+// rendered, after expanding the workspace's partials. Embedded graphs are
+// left alone; their nodes are resolved when the sub-graph runs.
+func resolveNode(node *workspace.Node, partials workspace.Partials, vars map[string]interface{}) (*workspace.Node, error) {
+	if len(node.Data) == 0 {
+		return node, nil
+	}
+
+	data := make(map[string]interface{}, len(node.Data))
+	for k, v := range node.Data {
+		if k == "graph" {
+			data[k] = v
+			continue
+		}
+		resolved, err := resolveValue(v, partials, vars, "data."+k)
+		if err != nil {
+			return nil, err
+		}
+		data[k] = resolved
+	}
+
+	resolved := *node
+	resolved.Data = data
+	return &resolved, nil
+}
+
+func resolveValue(value interface{}, partials workspace.Partials, vars map[string]interface{}, path string) (interface{}, error) {
+	switch val := value.(type) {
+	case string:
+		if !expr.IsTemplate(val) {
+			return val, nil
+		}
+		expanded, err := expr.ExpandPartials(val, partials)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		out, err := expr.Render(expanded, vars)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return out, nil
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			resolved, err := resolveValue(item, partials, vars, path+"."+k)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = resolved
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			resolved, err := resolveValue(item, partials, vars, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			out[i] = resolved
+		}
+		return out, nil
+	}
+	return value, nil
+}
@@ -0,0 +1,511 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/xizko39/nodeloom/internal/expr"
+	"github.com/xizko39/nodeloom/internal/llm"
+	"github.com/xizko39/nodeloom/internal/workspace"
+)
+
+// Tool types accepted in the "type" field of an agent node's tools
+const (
+	ToolHTTPFetch  = "http_fetch"
+	ToolCalculator = "calculator"
+	ToolRetriever  = "retriever"
+	ToolWorkspace  = "workspace"
+)
+
+const (
+	// DefaultFetchLimit caps the bytes of a response the http_fetch tool returns
+	DefaultFetchLimit = 100 << 10
+	// DefaultTopK is how many documents the retriever tool returns
+	DefaultTopK = 3
+)
+
+// agentTool is a tool an agent node offers the model
+type agentTool interface {
+	// spec describes the tool to the model
+	spec() llm.Tool
+	// call runs the tool. A workspace tool also returns its nested run.
+	call(ctx context.Context, nc *NodeContext, args map[string]interface{}) (interface{}, *Run, error)
+}
+
+// buildTools reads an agent node's "tools" data
+func buildTools(nc *NodeContext) ([]agentTool, error) {
+	raw, _ := nc.Node.Data["tools"].([]interface{})
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("agent node requires at least one tool")
+	}
+
+	tools := make([]agentTool, 0, len(raw))
+	names := make(map[string]bool)
+	for i, item := range raw {
+		fields, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("tool %d must be an object", i)
+		}
+		config := &workspace.Node{Data: fields}
+
+		var tool agentTool
+		var err error
+		switch kind := dataString(config, "type", ""); kind {
+		case ToolHTTPFetch:
+			tool = newFetchTool(config)
+		case ToolCalculator:
+			tool = &calculatorTool{name: dataString(config, "name", ToolCalculator)}
+		case ToolRetriever:
+			tool, err = newRetrieverTool(nc, config)
+		case ToolWorkspace:
+			tool, err = newWorkspaceTool(nc, config)
+		default:
+			err = fmt.Errorf("unknown tool type %q", kind)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("tool %d: %w", i, err)
+		}
+
+		name := tool.spec().Name
+		if names[name] {
+			return nil, fmt.Errorf("tool %d: duplicate tool name %q", i, name)
+		}
+		names[name] = true
+		tools = append(tools, tool)
+	}
+
+	return tools, nil
+}
+
+// toolSchema builds an object schema from property schemas
+func toolSchema(properties map[string]interface{}, required []string) map[string]interface{} {
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// fetchTool retrieves a web page or API response. Tool config:
+//
+//	allowed_hosts: host names the tool may fetch from (optional; any host when empty)
+//	allow_private: allow loopback, link-local and private addresses (default false)
+//	max_bytes:     response size limit (default DefaultFetchLimit)
+//
+// The model may be steered by the pages it fetches, so the allowlist is
+// checked on every redirect, and the address a host resolves to is checked
+// when connecting, which keeps the tool away from the server's own network
+// unless allow_private is set.
+type fetchTool struct {
+	name         string
+	description  string
+	allowedHosts []string
+	allowPrivate bool
+	maxBytes     int64
+	client       *http.Client
+}
+
+// maxFetchRedirects is how many redirects the http_fetch tool follows
+const maxFetchRedirects = 10
+
+func newFetchTool(config *workspace.Node) *fetchTool {
+	tool := &fetchTool{
+		name:        dataString(config, "name", ToolHTTPFetch),
+		description: dataString(config, "description", "Fetch a URL with an HTTP GET request and return the response body."),
+		maxBytes:    int64(dataInt(config, "max_bytes", DefaultFetchLimit)),
+	}
+	if hosts, ok := config.Data["allowed_hosts"].([]interface{}); ok {
+		for _, host := range hosts {
+			tool.allowedHosts = append(tool.allowedHosts, strings.ToLower(expr.ToString(host)))
+		}
+	}
+	tool.allowPrivate, _ = config.Data["allow_private"].(bool)
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second, Control: tool.checkAddress}
+	tool.client = &http.Client{
+		Timeout: 30 * time.Second,
+		// No proxy: the dialer must see the address actually fetched from
+		Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: 10 * time.Second},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxFetchRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxFetchRedirects)
+			}
+			return tool.checkURL(req.URL)
+		},
+	}
+	return tool
+}
+
+// checkURL refuses URLs the tool may not fetch
+func (t *fetchTool) checkURL(target *url.URL) error {
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return fmt.Errorf("url must be an http or https URL")
+	}
+	if len(t.allowedHosts) > 0 && !containsString(t.allowedHosts, strings.ToLower(target.Hostname())) {
+		return fmt.Errorf("host %q is not allowed", target.Hostname())
+	}
+	return nil
+}
+
+// checkAddress refuses connections to loopback, link-local and private
+// addresses, such as the cloud metadata service or a local model server.
+// It runs on the resolved address, so names pointing inside are caught too.
+func (t *fetchTool) checkAddress(network, address string, _ syscall.RawConn) error {
+	if t.allowPrivate {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("invalid address %q", address)
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("address %s is not allowed", ip)
+	}
+	return nil
+}
+
+func (t *fetchTool) spec() llm.Tool {
+	return llm.Tool{
+		Name:        t.name,
+		Description: t.description,
+		Parameters: toolSchema(map[string]interface{}{
+			"url": map[string]interface{}{"type": "string", "description": "The http or https URL to fetch"},
+		}, []string{"url"}),
+	}
+}
+
+func (t *fetchTool) call(ctx context.Context, nc *NodeContext, args map[string]interface{}) (interface{}, *Run, error) {
+	target, err := url.Parse(expr.ToString(args["url"]))
+	if err != nil {
+		return nil, nil, fmt.Errorf("url must be an http or https URL")
+	}
+	if err := t.checkURL(target); err != nil {
+		return nil, nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, t.maxBytes))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return map[string]interface{}{
+		"status":       resp.StatusCode,
+		"content_type": resp.Header.Get("Content-Type"),
+		"body":         string(body),
+	}, nil, nil
+}
+
+// calculatorTool evaluates arithmetic with the expression language
+type calculatorTool struct {
+	name string
+}
+
+func (t *calculatorTool) spec() llm.Tool {
+	return llm.Tool{
+		Name:        t.name,
+		Description: "Evaluate an arithmetic expression such as (12.5 + 3) * 4 / 2 and return the result.",
+		Parameters: toolSchema(map[string]interface{}{
+			"expression": map[string]interface{}{"type": "string", "description": "The expression to evaluate"},
+		}, []string{"expression"}),
+	}
+}
+
+func (t *calculatorTool) call(ctx context.Context, nc *NodeContext, args map[string]interface{}) (interface{}, *Run, error) {
+	result, err := expr.Eval(expr.ToString(args["expression"]), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, nil, nil
+}
+
+// retrieverTool finds the documents most relevant to a query. Tool config:
+//
+//	documents:       list of strings or {"text": ..., ...} objects; defaults
+//	                 to the agent's "documents" input
+//	top_k:           number of documents returned (default DefaultTopK)
+//	embedding_model: rank by embedding similarity using this model of the
+//	                 agent's provider (optional; ranks by shared words otherwise)
+type retrieverTool struct {
+	name        string
+	description string
+	documents   []interface{}
+	topK        int
+	model       string
+	provider    llm.Provider
+	embedder    llm.Embedder
+	embeddings  [][]float64 // Computed on first use
+}
+
+func newRetrieverTool(nc *NodeContext, config *workspace.Node) (*retrieverTool, error) {
+	tool := &retrieverTool{
+		name:        dataString(config, "name", ToolRetriever),
+		description: dataString(config, "description", "Search the knowledge base and return the passages most relevant to a query."),
+		topK:        dataInt(config, "top_k", DefaultTopK),
+		model:       dataString(config, "embedding_model", ""),
+	}
+
+	tool.documents, _ = config.Data["documents"].([]interface{})
+	if tool.documents == nil {
+		tool.documents, _ = nc.Inputs["documents"].([]interface{})
+	}
+	if len(tool.documents) == 0 {
+		return nil, fmt.Errorf("retriever has no documents")
+	}
+
+	if tool.model != "" {
+		provider, err := nc.Engine.provider(nc.Node)
+		if err != nil {
+			return nil, err
+		}
+		embedder, ok := llm.AsEmbedder(provider)
+		if !ok {
+			return nil, fmt.Errorf("provider %q does not compute embeddings", provider.Name())
+		}
+		tool.provider = provider
+		tool.embedder = embedder
+	}
+
+	return tool, nil
+}
+
+func (t *retrieverTool) spec() llm.Tool {
+	return llm.Tool{
+		Name:        t.name,
+		Description: t.description,
+		Parameters: toolSchema(map[string]interface{}{
+			"query": map[string]interface{}{"type": "string", "description": "What to search for"},
+		}, []string{"query"}),
+	}
+}
+
+func (t *retrieverTool) call(ctx context.Context, nc *NodeContext, args map[string]interface{}) (interface{}, *Run, error) {
+	query := expr.ToString(args["query"])
+	if strings.TrimSpace(query) == "" {
+		return nil, nil, fmt.Errorf("query must not be empty")
+	}
+
+	texts := make([]string, len(t.documents))
+	for i, doc := range t.documents {
+		texts[i] = documentText(doc)
+	}
+
+	var scores []float64
+	if t.embedder != nil {
+		if t.embeddings == nil {
+			embeddings, err := nc.Engine.embed(ctx, nc, t.provider, t.embedder, t.model, texts)
+			if err != nil {
+				return nil, nil, err
+			}
+			t.embeddings = embeddings
+		}
+		queryEmbedding, err := nc.Engine.embed(ctx, nc, t.provider, t.embedder, t.model, []string{query})
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, embedding := range t.embeddings {
+			scores = append(scores, cosine(queryEmbedding[0], embedding))
+		}
+	} else {
+		terms := words(query)
+		for _, text := range texts {
+			scores = append(scores, overlap(terms, words(text)))
+		}
+	}
+
+	order := make([]int, len(texts))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return scores[order[a]] > scores[order[b]]
+	})
+
+	results := []interface{}{}
+	for _, i := range order {
+		if len(results) == t.topK || scores[i] <= 0 {
+			break
+		}
+		results = append(results, t.documents[i])
+	}
+	return results, nil, nil
+}
+
+// documentText returns the text of a document given as a string or as an
+// object with a "text" or "content" field
+func documentText(doc interface{}) string {
+	if fields, ok := doc.(map[string]interface{}); ok {
+		for _, key := range []string{"text", "content"} {
+			if text, ok := fields[key].(string); ok {
+				return text
+			}
+		}
+	}
+	return expr.ToString(doc)
+}
+
+var wordPattern = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// words returns the set of lower-cased words in a text
+func words(text string) map[string]bool {
+	set := make(map[string]bool)
+	for _, word := range wordPattern.FindAllString(strings.ToLower(text), -1) {
+		set[word] = true
+	}
+	return set
+}
+
+// overlap scores a document by the share of query words it contains
+func overlap(query, doc map[string]bool) float64 {
+	if len(query) == 0 {
+		return 0
+	}
+	shared := 0
+	for word := range query {
+		if doc[word] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(query))
+}
+
+func cosine(a, b []float64) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		if i >= len(b) {
+			break
+		}
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
+
+// workspaceTool runs another workspace as a tool. Its INPUT nodes become the
+// tool's parameters: the port name is the parameter name, and the node's
+// "type" and "description" data describe it. Parameters of INPUT nodes
+// without a "default" are required. Tool config:
+//
+//	workspace_id: ID of the workspace to run
+//	revision:     revision published with POST /workspaces/:id:publish to run instead of the current graph (optional)
+//	name:         tool name (defaults to the workspace name)
+//	description:  what the tool does (defaults to the template description)
+type workspaceTool struct {
+	name        string
+	description string
+	flow        *workspace.Workspace
+}
+
+var toolNameUnsafe = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+func newWorkspaceTool(nc *NodeContext, config *workspace.Node) (*workspaceTool, error) {
+	id, err := uuid.Parse(dataString(config, "workspace_id", ""))
+	if err != nil {
+		return nil, fmt.Errorf("workspace tool requires a valid workspace_id")
+	}
+
+	flow, err := nc.Engine.loadSubflow(id, dataInt(config, "revision", 0))
+	if err != nil {
+		return nil, err
+	}
+
+	name := dataString(config, "name", "")
+	if name == "" {
+		name = strings.Trim(toolNameUnsafe.ReplaceAllString(strings.ToLower(flow.Name), "_"), "_")
+	}
+	if name == "" {
+		return nil, fmt.Errorf("workspace tool requires a name")
+	}
+
+	description := dataString(config, "description", "")
+	if description == "" && flow.Template != nil {
+		description = flow.Template.Description
+	}
+	if description == "" {
+		description = fmt.Sprintf("Run the %q flow.", flow.Name)
+	}
+
+	return &workspaceTool{name: name, description: description, flow: flow}, nil
+}
+
+func (t *workspaceTool) spec() llm.Tool {
+	properties := make(map[string]interface{})
+	var required []string
+
+	for i := range t.flow.Nodes {
+		node := &t.flow.Nodes[i]
+		if node.Type != workspace.InputNode {
+			continue
+		}
+		name := node.PortName()
+		property := map[string]interface{}{"type": dataString(node, "type", "string")}
+		if description := dataString(node, "description", ""); description != "" {
+			property["description"] = description
+		}
+		properties[name] = property
+		if _, ok := node.Data["default"]; !ok {
+			required = append(required, name)
+		}
+	}
+	sort.Strings(required)
+
+	return llm.Tool{
+		Name:        t.name,
+		Description: t.description,
+		Parameters:  toolSchema(properties, required),
+	}
+}
+
+func (t *workspaceTool) call(ctx context.Context, nc *NodeContext, args map[string]interface{}) (interface{}, *Run, error) {
+	ctx, err := enterSubflow(ctx, nc, t.flow.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	run := NewRun(t.flow.ID, args)
+	if err := nc.Engine.executeNested(ctx, t.flow, run); err != nil {
+		return nil, run, err
+	}
+	return flowOutputs(run), run, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
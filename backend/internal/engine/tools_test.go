@@ -0,0 +1,100 @@
+package engine
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/xizko39/nodeloom/internal/workspace"
+)
+
+func fetchConfig(data map[string]interface{}) *workspace.Node {
+	return &workspace.Node{Data: data}
+}
+
+func TestFetchToolRefusesPrivateAddresses(t *testing.T) {
+	tool := newFetchTool(fetchConfig(map[string]interface{}{}))
+	tests := []struct {
+		address string
+		allowed bool
+	}{
+		{"127.0.0.1:11434", false},
+		{"[::1]:80", false},
+		{"169.254.169.254:80", false},
+		{"10.1.2.3:443", false},
+		{"172.16.0.1:80", false},
+		{"192.168.1.10:8080", false},
+		{"[fd00::1]:80", false},
+		{"0.0.0.0:80", false},
+		{"93.184.216.34:443", true},
+		{"[2606:2800:220:1:248:1893:25c8:1946]:443", true},
+	}
+	for _, tt := range tests {
+		err := tool.checkAddress("tcp", tt.address, nil)
+		if allowed := err == nil; allowed != tt.allowed {
+			t.Errorf("checkAddress(%s) = %v, want allowed %v", tt.address, err, tt.allowed)
+		}
+	}
+
+	if err := newFetchTool(fetchConfig(map[string]interface{}{"allow_private": true})).checkAddress("tcp", "127.0.0.1:80", nil); err != nil {
+		t.Errorf("allow_private: checkAddress = %v", err)
+	}
+}
+
+func TestFetchToolDialsResolvedAddress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secret"))
+	}))
+	defer server.Close()
+	port := server.URL[strings.LastIndex(server.URL, ":")+1:]
+
+	// A name that resolves to loopback is caught when connecting
+	tool := newFetchTool(fetchConfig(map[string]interface{}{}))
+	_, _, err := tool.call(context.Background(), nil, map[string]interface{}{"url": "http://localhost:" + port + "/"})
+	if err == nil || !strings.Contains(err.Error(), "is not allowed") {
+		t.Errorf("fetching localhost: error = %v", err)
+	}
+}
+
+func TestFetchToolChecksRedirects(t *testing.T) {
+	var target *httptest.Server
+	target = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/elsewhere":
+			// Same server, under a host name that is not allowed
+			u, _ := url.Parse(target.URL)
+			http.Redirect(w, r, "http://localhost:"+u.Port()+"/secret", http.StatusFound)
+		case "/same":
+			http.Redirect(w, r, "/ok", http.StatusFound)
+		default:
+			w.Write([]byte("reached " + r.URL.Path))
+		}
+	}))
+	defer target.Close()
+
+	tool := newFetchTool(fetchConfig(map[string]interface{}{
+		"allow_private": true,
+		"allowed_hosts": []interface{}{"127.0.0.1"},
+	}))
+
+	_, _, err := tool.call(context.Background(), nil, map[string]interface{}{"url": target.URL + "/elsewhere"})
+	if err == nil || !strings.Contains(err.Error(), `host "localhost" is not allowed`) {
+		t.Errorf("redirect to another host: error = %v", err)
+	}
+
+	result, _, err := tool.call(context.Background(), nil, map[string]interface{}{"url": target.URL + "/same"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := result.(map[string]interface{})["body"]; body != "reached /ok" {
+		t.Errorf("redirect on the same host: body = %v", body)
+	}
+
+	_, _, err = tool.call(context.Background(), nil, map[string]interface{}{"url": "http://localhost/"})
+	if err == nil || !strings.Contains(err.Error(), `host "localhost" is not allowed`) {
+		t.Errorf("host outside the allowlist: error = %v", err)
+	}
+}
@@ -0,0 +1,303 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/xizko39/nodeloom/internal/llm"
+	"github.com/xizko39/nodeloom/internal/workspace"
+)
+
+// ErrBudgetExceeded is returned when an LLM call or a run would spend more
+// than its budget allows
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+// Usage totals the tokens and cost of LLM calls. Calls to models missing from
+// the price table count tokens but cost nothing.
+type Usage struct {
+	Calls            int     `json:"calls"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	Cost             float64 `json:"cost"` // US dollars
+}
+
+func (u *Usage) add(other Usage) {
+	u.Calls += other.Calls
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.Cost += other.Cost
+}
+
+// meter adds up the usage of a node or a run. Meters form a chain from a
+// node to its run, and from a nested run to the node that started it, so a
+// call is counted at every level and checked against every budget above it.
+// The projected cost of calls in flight is reserved, so nodes running
+// concurrently cannot together overrun a budget.
+type meter struct {
+	parent *meter
+	budget float64 // US dollars; zero means no limit
+
+	mu       sync.Mutex
+	usage    Usage
+	reserved float64 // Projected cost of calls in flight
+}
+
+func newMeter(parent *meter, budget float64, spent *Usage) *meter {
+	m := &meter{parent: parent, budget: budget}
+	if spent != nil {
+		m.usage = *spent
+	}
+	return m
+}
+
+type meterKey struct{}
+
+// meterFrom returns the meter of the node whose executor is running
+func meterFrom(ctx context.Context) *meter {
+	m, _ := ctx.Value(meterKey{}).(*meter)
+	return m
+}
+
+func withMeter(ctx context.Context, m *meter) context.Context {
+	return context.WithValue(ctx, meterKey{}, m)
+}
+
+// reserve sets the projected cost of a call aside at every level, refusing
+// the call if it could cost more than what is left of any budget
+func (m *meter) reserve(cost float64) error {
+	for level := m; level != nil; level = level.parent {
+		level.mu.Lock()
+		committed := level.usage.Cost + level.reserved
+		if level.budget > 0 && committed+cost > level.budget {
+			level.mu.Unlock()
+			// Undo the reservations already made below this level
+			for undo := m; undo != level; undo = undo.parent {
+				undo.mu.Lock()
+				undo.reserved -= cost
+				undo.mu.Unlock()
+			}
+			return &ClassifiedError{Class: ErrorPermanent, Err: fmt.Errorf(
+				"%w: call could cost $%.4f with $%.4f of $%.4f committed", ErrBudgetExceeded, cost, committed, level.budget)}
+		}
+		level.reserved += cost
+		level.mu.Unlock()
+	}
+	return nil
+}
+
+// settle releases a reservation and records what the call actually used
+func (m *meter) settle(reserved float64, usage Usage) {
+	for ; m != nil; m = m.parent {
+		m.mu.Lock()
+		m.reserved -= reserved
+		m.usage.add(usage)
+		m.mu.Unlock()
+	}
+}
+
+// total returns the usage so far, or nil if nothing was used
+func (m *meter) total() *Usage {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.usage.Calls == 0 {
+		return nil
+	}
+	usage := m.usage
+	return &usage
+}
+
+// chat sends a request to a provider on behalf of a node, streaming the reply
+// to onText unless it is nil. The call is refused when its projected cost
+// would exceed the budget of the run or of a run it is nested in, and its
+// tokens and cost are recorded once it returns.
+func (e *Engine) chat(ctx context.Context, nc *NodeContext, provider llm.Provider, req *llm.ChatRequest, onText func(text string) error) (*llm.ChatResponse, error) {
+	price, _ := e.providers.Price(provider.Name(), req.Model)
+
+	completion := req.MaxTokens
+	if completion <= 0 {
+		completion = llm.EstimatedCompletionTokens
+	}
+	projected := price.Cost(llm.Usage{PromptTokens: llm.EstimateTokens(req), CompletionTokens: completion})
+	if err := nc.meter.reserve(projected); err != nil {
+		return nil, err
+	}
+
+	var resp *llm.ChatResponse
+	var err error
+	if onText == nil {
+		resp, err = provider.Chat(ctx, req)
+	} else {
+		resp, err = provider.ChatStream(ctx, req, onText)
+	}
+	if err != nil {
+		nc.meter.settle(projected, Usage{})
+		return nil, classifyLLMError(err)
+	}
+
+	if resp.Provider != "" {
+		// Served by a fallback provider, which may charge differently
+		price, _ = e.providers.Price(resp.Provider, resp.Model)
+	}
+	nc.meter.settle(projected, Usage{
+		Calls:            1,
+		PromptTokens:     resp.Usage.PromptTokens,
+		CompletionTokens: resp.Usage.CompletionTokens,
+		Cost:             price.Cost(resp.Usage),
+	})
+	return resp, nil
+}
+
+// embed computes embeddings on behalf of a node, metered and checked against
+// budgets like chat calls. Providers do not report the tokens of embedding
+// requests, so they are estimated at four bytes a token.
+func (e *Engine) embed(ctx context.Context, nc *NodeContext, provider llm.Provider, embedder llm.Embedder, model string, input []string) ([][]float64, error) {
+	size := 0
+	for _, text := range input {
+		size += len(text)
+	}
+	usage := llm.Usage{PromptTokens: size/4 + 1}
+	price, _ := e.providers.Price(provider.Name(), model)
+	cost := price.Cost(usage)
+	if err := nc.meter.reserve(cost); err != nil {
+		return nil, err
+	}
+
+	embeddings, err := embedder.Embed(ctx, model, input)
+	if err != nil {
+		nc.meter.settle(cost, Usage{})
+		return nil, classifyLLMError(err)
+	}
+
+	nc.meter.settle(cost, Usage{Calls: 1, PromptTokens: usage.PromptTokens, Cost: cost})
+	return embeddings, nil
+}
+
+// UsageStore is implemented by run stores that can list the usage of past runs
+type UsageStore interface {
+	ListRunUsage(filter UsageFilter) ([]Run, error)
+}
+
+// UsageFilter selects the runs a usage report covers. Zero fields match
+// every run.
+type UsageFilter struct {
+	WorkspaceID *uuid.UUID
+	User        string
+	Since       *time.Time
+	Until       *time.Time
+}
+
+// UsageReport totals the usage of runs overall, per workspace and per user
+type UsageReport struct {
+	Runs        int                  `json:"runs"`
+	Total       Usage                `json:"total"`
+	ByWorkspace map[uuid.UUID]*Usage `json:"by_workspace"`
+	ByUser      map[string]*Usage    `json:"by_user"`
+}
+
+// Usage reports the LLM usage of the runs matching filter
+func (e *Engine) Usage(filter UsageFilter) (*UsageReport, error) {
+	store, ok := e.store.(UsageStore)
+	if !ok {
+		return nil, fmt.Errorf("usage reports are not available")
+	}
+	runs, err := store.ListRunUsage(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &UsageReport{
+		ByWorkspace: make(map[uuid.UUID]*Usage),
+		ByUser:      make(map[string]*Usage),
+	}
+	for _, run := range runs {
+		if run.Usage == nil {
+			continue
+		}
+		report.Runs++
+		report.Total.add(*run.Usage)
+
+		if report.ByWorkspace[run.WorkspaceID] == nil {
+			report.ByWorkspace[run.WorkspaceID] = &Usage{}
+		}
+		report.ByWorkspace[run.WorkspaceID].add(*run.Usage)
+
+		if run.CreatedBy != "" {
+			if report.ByUser[run.CreatedBy] == nil {
+				report.ByUser[run.CreatedBy] = &Usage{}
+			}
+			report.ByUser[run.CreatedBy].add(*run.Usage)
+		}
+	}
+
+	return report, nil
+}
+
+// workspaceBudget is the meter shared by the runs of a workspace in progress
+type workspaceBudget struct {
+	meter *meter
+	runs  int
+}
+
+// workspaceMeter returns the meter shared by the runs of a workspace with a
+// budget, so that calls reserved by concurrent runs count against the
+// budget together. The meter starts from the usage of earlier runs and lives
+// while any run of the workspace executes in this process; release must be
+// called when the run stops. It is nil when the workspace has no budget.
+func (e *Engine) workspaceMeter(ws *workspace.Workspace) (*meter, func(), error) {
+	if ws.Budget <= 0 {
+		return nil, func() {}, nil
+	}
+
+	e.budgetMu.Lock()
+	defer e.budgetMu.Unlock()
+
+	shared := e.budgets[ws.ID]
+	if shared == nil {
+		report, err := e.Usage(UsageFilter{WorkspaceID: &ws.ID})
+		if err != nil {
+			return nil, nil, err
+		}
+		shared = &workspaceBudget{meter: newMeter(nil, ws.Budget, &report.Total)}
+		e.budgets[ws.ID] = shared
+	}
+	shared.runs++
+
+	// The budget may have changed since the meter was created
+	shared.meter.mu.Lock()
+	shared.meter.budget = ws.Budget
+	shared.meter.mu.Unlock()
+
+	release := func() {
+		e.budgetMu.Lock()
+		defer e.budgetMu.Unlock()
+		if shared.runs--; shared.runs == 0 {
+			delete(e.budgets, ws.ID)
+		}
+	}
+	return shared.meter, release, nil
+}
+
+// checkBudget refuses to start a run once its workspace's budget is spent or
+// reserved by the runs in progress
+func (e *Engine) checkBudget(ws *workspace.Workspace) error {
+	shared, release, err := e.workspaceMeter(ws)
+	if err != nil || shared == nil {
+		return err
+	}
+	defer release()
+
+	shared.mu.Lock()
+	committed := shared.usage.Cost + shared.reserved
+	shared.mu.Unlock()
+	if committed >= ws.Budget {
+		return fmt.Errorf("%w: workspace has spent or reserved $%.4f of $%.4f", ErrBudgetExceeded, committed, ws.Budget)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMeterReserve(t *testing.T) {
+	tests := []struct {
+		name         string
+		parentBudget float64
+		parentSpent  float64
+		budget       float64
+		spent        float64
+		reserved     float64 // Already reserved on the node's meter
+		cost         float64
+		ok           bool
+	}{
+		{"no budgets", 0, 5, 0, 5, 0, 1, true},
+		{"within the node budget", 0, 0, 1, 0.5, 0, 0.4, true},
+		{"over the node budget", 0, 0, 1, 0.5, 0, 0.6, false},
+		{"reservations count", 0, 0, 1, 0.2, 0.5, 0.4, false},
+		{"within both budgets", 2, 1, 1, 0.5, 0, 0.4, true},
+		{"over the parent budget", 2, 1.8, 1, 0, 0, 0.4, false},
+	}
+	for _, tt := range tests {
+		parent := newMeter(nil, tt.parentBudget, &Usage{Cost: tt.parentSpent})
+		m := newMeter(parent, tt.budget, &Usage{Cost: tt.spent})
+		m.reserved = tt.reserved
+		parent.reserved = tt.reserved
+
+		err := m.reserve(tt.cost)
+		if ok := err == nil; ok != tt.ok {
+			t.Errorf("%s: reserve = %v, want ok %v", tt.name, err, tt.ok)
+			continue
+		}
+		if err != nil && !errors.Is(err, ErrBudgetExceeded) {
+			t.Errorf("%s: reserve = %v, want ErrBudgetExceeded", tt.name, err)
+		}
+
+		// A refused call reserves nothing at any level
+		want := tt.reserved
+		if tt.ok {
+			want += tt.cost
+		}
+		if m.reserved != want || parent.reserved != want {
+			t.Errorf("%s: reserved %v and %v in the parent, want %v", tt.name, m.reserved, parent.reserved, want)
+		}
+	}
+}
@@ -0,0 +1,377 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+)
+
+type evalContext struct {
+	src  string
+	vars map[string]interface{}
+}
+
+func (c *evalContext) errorf(pos int, format string, args ...interface{}) error {
+	return newError(c.src, pos, fmt.Sprintf(format, args...))
+}
+
+type node interface {
+	eval(c *evalContext) (interface{}, error)
+}
+
+type literalNode struct {
+	value interface{}
+}
+
+func (n *literalNode) eval(c *evalContext) (interface{}, error) {
+	return n.value, nil
+}
+
+type identNode struct {
+	name string
+	pos  int
+}
+
+func (n *identNode) eval(c *evalContext) (interface{}, error) {
+	value, ok := c.vars[n.name]
+	if !ok {
+		return nil, c.errorf(n.pos, "unknown variable %q", n.name)
+	}
+	return value, nil
+}
+
+type listNode struct {
+	items []node
+}
+
+func (n *listNode) eval(c *evalContext) (interface{}, error) {
+	out := make([]interface{}, len(n.items))
+	for i, item := range n.items {
+		value, err := item.eval(c)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = value
+	}
+	return out, nil
+}
+
+type indexNode struct {
+	target node
+	index  node
+	pos    int
+}
+
+func (n *indexNode) eval(c *evalContext) (interface{}, error) {
+	target, err := n.target.eval(c)
+	if err != nil {
+		return nil, err
+	}
+	index, err := n.index.eval(c)
+	if err != nil {
+		return nil, err
+	}
+
+	switch val := target.(type) {
+	case nil:
+		// Indexing into a missing value yields null so optional fields can be tested
+		return nil, nil
+	case map[string]interface{}:
+		key, ok := index.(string)
+		if !ok {
+			return nil, c.errorf(n.pos, "object keys must be strings")
+		}
+		return val[key], nil
+	case []interface{}:
+		i, ok := toIndex(index, len(val))
+		if !ok {
+			return nil, c.errorf(n.pos, "list index must be a number")
+		}
+		if i < 0 || i >= len(val) {
+			return nil, nil
+		}
+		return val[i], nil
+	case string:
+		i, ok := toIndex(index, len(val))
+		if !ok {
+			return nil, c.errorf(n.pos, "string index must be a number")
+		}
+		if i < 0 || i >= len(val) {
+			return nil, nil
+		}
+		return val[i : i+1], nil
+	default:
+		return nil, c.errorf(n.pos, "cannot index into %s", typeName(target))
+	}
+}
+
+type unaryNode struct {
+	op      string
+	operand node
+	pos     int
+}
+
+func (n *unaryNode) eval(c *evalContext) (interface{}, error) {
+	value, err := n.operand.eval(c)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "!":
+		return !Truthy(value), nil
+	case "-":
+		num, ok := toNumber(value)
+		if !ok {
+			return nil, c.errorf(n.pos, "cannot negate %s", typeName(value))
+		}
+		return -num, nil
+	}
+	return nil, c.errorf(n.pos, "unknown operator %q", n.op)
+}
+
+type binaryNode struct {
+	op          string
+	left, right node
+	pos         int
+}
+
+func (n *binaryNode) eval(c *evalContext) (interface{}, error) {
+	left, err := n.left.eval(c)
+	if err != nil {
+		return nil, err
+	}
+
+	// Logical operators short-circuit
+	switch n.op {
+	case "&&":
+		if !Truthy(left) {
+			return false, nil
+		}
+		right, err := n.right.eval(c)
+		if err != nil {
+			return nil, err
+		}
+		return Truthy(right), nil
+	case "||":
+		if Truthy(left) {
+			return true, nil
+		}
+		right, err := n.right.eval(c)
+		if err != nil {
+			return nil, err
+		}
+		return Truthy(right), nil
+	}
+
+	right, err := n.right.eval(c)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return Equal(left, right), nil
+	case "!=":
+		return !Equal(left, right), nil
+	case "in":
+		return contains(right, left), nil
+	case "<", "<=", ">", ">=":
+		cmp, ok := compare(left, right)
+		if !ok {
+			return nil, c.errorf(n.pos, "cannot compare %s and %s", typeName(left), typeName(right))
+		}
+		switch n.op {
+		case "<":
+			return cmp < 0, nil
+		case "<=":
+			return cmp <= 0, nil
+		case ">":
+			return cmp > 0, nil
+		default:
+			return cmp >= 0, nil
+		}
+	case "+":
+		if ls, ok := left.(string); ok {
+			return ls + ToString(right), nil
+		}
+		if rs, ok := right.(string); ok {
+			return ToString(left) + rs, nil
+		}
+		if ll, ok := left.([]interface{}); ok {
+			if rl, ok := right.([]interface{}); ok {
+				return append(append([]interface{}{}, ll...), rl...), nil
+			}
+		}
+	}
+
+	ln, lok := toNumber(left)
+	rn, rok := toNumber(right)
+	if !lok || !rok {
+		return nil, c.errorf(n.pos, "operator %q needs numbers, got %s and %s", n.op, typeName(left), typeName(right))
+	}
+
+	switch n.op {
+	case "+":
+		return ln + rn, nil
+	case "-":
+		return ln - rn, nil
+	case "*":
+		return ln * rn, nil
+	case "/":
+		if rn == 0 {
+			return nil, c.errorf(n.pos, "division by zero")
+		}
+		return ln / rn, nil
+	case "%":
+		if rn == 0 {
+			return nil, c.errorf(n.pos, "division by zero")
+		}
+		return math.Mod(ln, rn), nil
+	}
+
+	return nil, c.errorf(n.pos, "unknown operator %q", n.op)
+}
+
+type callNode struct {
+	name string
+	args []node
+	pos  int
+}
+
+func (n *callNode) eval(c *evalContext) (interface{}, error) {
+	args := make([]interface{}, len(n.args))
+	for i, arg := range n.args {
+		value, err := arg.eval(c)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+
+	result, err := functions[n.name](args)
+	if err != nil {
+		return nil, c.errorf(n.pos, "%s: %v", n.name, err)
+	}
+	return result, nil
+}
+
+// Equal compares two values structurally, treating all numeric types alike
+func Equal(a, b interface{}) bool {
+	if an, ok := toNumber(a); ok {
+		if bn, ok := toNumber(b); ok {
+			return an == bn
+		}
+		return false
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func compare(a, b interface{}) (int, bool) {
+	if an, ok := toNumber(a); ok {
+		if bn, ok := toNumber(b); ok {
+			switch {
+			case an < bn:
+				return -1, true
+			case an > bn:
+				return 1, true
+			}
+			return 0, true
+		}
+	}
+	if as, ok := a.(string); ok {
+		if bs, ok := b.(string); ok {
+			return strings.Compare(as, bs), true
+		}
+	}
+	return 0, false
+}
+
+func contains(container, item interface{}) bool {
+	switch val := container.(type) {
+	case string:
+		return strings.Contains(val, ToString(item))
+	case []interface{}:
+		for _, v := range val {
+			if Equal(v, item) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		if key, ok := item.(string); ok {
+			_, found := val[key]
+			return found
+		}
+	}
+	return false
+}
+
+func toNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+func toIndex(v interface{}, length int) (int, bool) {
+	n, ok := toNumber(v)
+	if !ok {
+		return 0, false
+	}
+	i := int(n)
+	if i < 0 {
+		// Negative indexes count from the end
+		i += length
+	}
+	return i, true
+}
+
+// ToString formats a value for string concatenation and template output
+func ToString(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case float64:
+		if val == math.Trunc(val) && math.Abs(val) < 1e15 {
+			return fmt.Sprintf("%d", int64(val))
+		}
+		return fmt.Sprint(val)
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []interface{}:
+		return "list"
+	case map[string]interface{}:
+		return "object"
+	}
+	if _, ok := toNumber(v); ok {
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
@@ -0,0 +1,111 @@
+// Package expr implements the small, sandboxed expression language used to
+// evaluate conditions and values in node data. Expressions can only read the
+// variables they are given and call the built-in functions; they have no
+// access to the host.
+package expr
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Error describes a compile or evaluation error and where in the source it occurred
+type Error struct {
+	Offset int    `json:"offset"` // Byte offset into the source
+	Line   int    `json:"line"`   // 1-based line
+	Column int    `json:"column"` // 1-based column
+	Msg    string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s at line %d, column %d", e.Msg, e.Line, e.Column)
+}
+
+func newError(src string, offset int, msg string) *Error {
+	if offset > len(src) {
+		offset = len(src)
+	}
+	line := 1 + strings.Count(src[:offset], "\n")
+	column := offset + 1
+	if i := strings.LastIndex(src[:offset], "\n"); i >= 0 {
+		column = offset - i
+	}
+	return &Error{Offset: offset, Line: line, Column: column, Msg: msg}
+}
+
+// Program is a compiled expression
+type Program struct {
+	src  string // Full source text, used for error positions
+	text string // The expression itself
+	root node
+}
+
+// Compile parses an expression, reporting syntax errors with their position
+func Compile(src string) (*Program, error) {
+	return compileRange(src, 0, len(src))
+}
+
+// compileRange compiles the expression in src[start:end]. Error positions
+// are reported relative to the whole of src.
+func compileRange(src string, start, end int) (*Program, error) {
+	tokens, err := tokenize(src, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{src: src, tokens: tokens}
+	if tok := p.peek(); tok.kind == tokEOF {
+		return nil, newError(src, tok.pos, "empty expression")
+	}
+
+	root, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, newError(src, tok.pos, fmt.Sprintf("unexpected %q", tok.text))
+	}
+
+	return &Program{src: src, text: src[start:end], root: root}, nil
+}
+
+// Source returns the text the program was compiled from
+func (p *Program) Source() string {
+	return p.text
+}
+
+// Eval evaluates the program against the given variables
+func (p *Program) Eval(vars map[string]interface{}) (interface{}, error) {
+	return p.root.eval(&evalContext{src: p.src, vars: vars})
+}
+
+// Eval compiles and evaluates an expression in one step
+func Eval(src string, vars map[string]interface{}) (interface{}, error) {
+	program, err := Compile(src)
+	if err != nil {
+		return nil, err
+	}
+	return program.Eval(vars)
+}
+
+// Truthy reports whether a value counts as true in a condition
+func Truthy(v interface{}) bool {
+	switch val := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return val
+	case string:
+		return val != ""
+	case []interface{}:
+		return len(val) > 0
+	case map[string]interface{}:
+		return len(val) > 0
+	default:
+		if n, ok := toNumber(v); ok {
+			return n != 0
+		}
+		return true
+	}
+}
@@ -0,0 +1,113 @@
+package expr
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEval(t *testing.T) {
+	vars := map[string]interface{}{
+		"score": float64(7),
+		"name":  "Ada",
+		"tags":  []interface{}{"a", "b"},
+		"user":  map[string]interface{}{"role": "admin", "age": float64(36)},
+	}
+	tests := []struct {
+		src  string
+		want interface{}
+	}{
+		{`score > 5`, true},
+		{`score >= 5 && name == "Ada"`, true},
+		{`score < 5 or user.role == "admin"`, true},
+		{`!(score == 7)`, false},
+		{`score * 2 + 1`, float64(15)},
+		{`"b" in tags`, true},
+		{`user.age - 6`, float64(30)},
+		{`len(tags)`, float64(2)},
+		{`upper(name)`, "ADA"},
+		{`contains(lower(name), "ad")`, true},
+		{`join(tags, "-")`, "a-b"},
+		{`default(user.nickname, "none")`, "none"},
+		{`first(tags)`, "a"},
+	}
+	for _, tt := range tests {
+		got, err := Eval(tt.src, vars)
+		if err != nil {
+			t.Errorf("Eval(%s) error = %v", tt.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Eval(%s) = %#v, want %#v", tt.src, got, tt.want)
+		}
+	}
+
+	if _, err := Eval(`missing == 1`, vars); err == nil {
+		t.Error("unknown variable evaluated")
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		src    string
+		line   int
+		column int
+	}{
+		{``, 1, 1},
+		{`score >`, 1, 8},
+		{`score > 5 5`, 1, 11},
+		{"score > 5 &&\n  (name", 2, 8},
+	}
+	for _, tt := range tests {
+		_, err := Compile(tt.src)
+		e, ok := err.(*Error)
+		if !ok {
+			t.Errorf("Compile(%q) error = %v, want an *Error", tt.src, err)
+			continue
+		}
+		if e.Line != tt.line || e.Column != tt.column {
+			t.Errorf("Compile(%q) error at %d:%d, want %d:%d (%v)", tt.src, e.Line, e.Column, tt.line, tt.column, e)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	vars := map[string]interface{}{"name": "Ada", "count": float64(3)}
+	tests := []struct {
+		src  string
+		want interface{}
+	}{
+		{`Hello {{ name }}!`, "Hello Ada!"},
+		{`{{ count }} items`, "3 items"},
+		{`{{ count }}`, float64(3)}, // A single block keeps its type
+		{`no blocks`, "no blocks"},
+	}
+	for _, tt := range tests {
+		got, err := Render(tt.src, vars)
+		if err != nil {
+			t.Errorf("Render(%q) error = %v", tt.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Render(%q) = %#v, want %#v", tt.src, got, tt.want)
+		}
+	}
+
+	if _, err := CompileTemplate(`Hello {{ name`); err == nil {
+		t.Error("unclosed block compiled")
+	}
+}
+
+func TestExpandPartials(t *testing.T) {
+	partials := map[string]string{"greet": "Hello {{ name }}", "loop": "{{> loop }}"}
+
+	got, err := ExpandPartials(`{{> greet }}, welcome`, partials)
+	if err != nil || got != "Hello {{ name }}, welcome" {
+		t.Errorf("ExpandPartials = %q, %v", got, err)
+	}
+	if _, err := ExpandPartials(`{{> loop }}`, partials); err == nil {
+		t.Error("partial including itself expanded")
+	}
+	if _, err := ExpandPartials(`{{> missing }}`, partials); err == nil {
+		t.Error("unknown partial expanded")
+	}
+}
@@ -0,0 +1,174 @@
+package expr
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// functions are the built-ins callable from expressions. Each can also be
+// used as a filter, in which case the piped value is the first argument.
+var functions = map[string]func(args []interface{}) (interface{}, error){
+	"len":        fnLen,
+	"lower":      stringFunc(strings.ToLower),
+	"upper":      stringFunc(strings.ToUpper),
+	"trim":       stringFunc(strings.TrimSpace),
+	"contains":   fnContains,
+	"startsWith": fnStartsWith,
+	"endsWith":   fnEndsWith,
+	"string":     fnString,
+	"default":    fnDefault,
+	"join":       fnJoin,
+	"split":      fnSplit,
+	"replace":    fnReplace,
+	"first":      fnFirst,
+	"last":       fnLast,
+	"json":       fnJSON,
+}
+
+func checkArgs(args []interface{}, n int) error {
+	if len(args) != n {
+		return fmt.Errorf("expected %d argument(s), got %d", n, len(args))
+	}
+	return nil
+}
+
+func stringFunc(f func(string) string) func(args []interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		if err := checkArgs(args, 1); err != nil {
+			return nil, err
+		}
+		return f(ToString(args[0])), nil
+	}
+}
+
+func fnLen(args []interface{}) (interface{}, error) {
+	if err := checkArgs(args, 1); err != nil {
+		return nil, err
+	}
+	switch val := args[0].(type) {
+	case nil:
+		return 0.0, nil
+	case string:
+		return float64(len(val)), nil
+	case []interface{}:
+		return float64(len(val)), nil
+	case map[string]interface{}:
+		return float64(len(val)), nil
+	}
+	return nil, fmt.Errorf("cannot take length of %s", typeName(args[0]))
+}
+
+func fnContains(args []interface{}) (interface{}, error) {
+	if err := checkArgs(args, 2); err != nil {
+		return nil, err
+	}
+	return contains(args[0], args[1]), nil
+}
+
+func fnStartsWith(args []interface{}) (interface{}, error) {
+	if err := checkArgs(args, 2); err != nil {
+		return nil, err
+	}
+	return strings.HasPrefix(ToString(args[0]), ToString(args[1])), nil
+}
+
+func fnEndsWith(args []interface{}) (interface{}, error) {
+	if err := checkArgs(args, 2); err != nil {
+		return nil, err
+	}
+	return strings.HasSuffix(ToString(args[0]), ToString(args[1])), nil
+}
+
+func fnString(args []interface{}) (interface{}, error) {
+	if err := checkArgs(args, 1); err != nil {
+		return nil, err
+	}
+	return ToString(args[0]), nil
+}
+
+// fnDefault returns the fallback when the value is null or empty
+func fnDefault(args []interface{}) (interface{}, error) {
+	if err := checkArgs(args, 2); err != nil {
+		return nil, err
+	}
+	if !Truthy(args[0]) {
+		return args[1], nil
+	}
+	return args[0], nil
+}
+
+func fnJoin(args []interface{}) (interface{}, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, fmt.Errorf("expected 1 or 2 arguments, got %d", len(args))
+	}
+	list, ok := args[0].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("cannot join %s", typeName(args[0]))
+	}
+	sep := ""
+	if len(args) == 2 {
+		sep = ToString(args[1])
+	}
+	parts := make([]string, len(list))
+	for i, item := range list {
+		parts[i] = ToString(item)
+	}
+	return strings.Join(parts, sep), nil
+}
+
+func fnSplit(args []interface{}) (interface{}, error) {
+	if err := checkArgs(args, 2); err != nil {
+		return nil, err
+	}
+	parts := strings.Split(ToString(args[0]), ToString(args[1]))
+	out := make([]interface{}, len(parts))
+	for i, part := range parts {
+		out[i] = part
+	}
+	return out, nil
+}
+
+func fnReplace(args []interface{}) (interface{}, error) {
+	if err := checkArgs(args, 3); err != nil {
+		return nil, err
+	}
+	return strings.ReplaceAll(ToString(args[0]), ToString(args[1]), ToString(args[2])), nil
+}
+
+func fnFirst(args []interface{}) (interface{}, error) {
+	if err := checkArgs(args, 1); err != nil {
+		return nil, err
+	}
+	if list, ok := args[0].([]interface{}); ok {
+		if len(list) == 0 {
+			return nil, nil
+		}
+		return list[0], nil
+	}
+	return nil, fmt.Errorf("cannot take first of %s", typeName(args[0]))
+}
+
+func fnLast(args []interface{}) (interface{}, error) {
+	if err := checkArgs(args, 1); err != nil {
+		return nil, err
+	}
+	if list, ok := args[0].([]interface{}); ok {
+		if len(list) == 0 {
+			return nil, nil
+		}
+		return list[len(list)-1], nil
+	}
+	return nil, fmt.Errorf("cannot take last of %s", typeName(args[0]))
+}
+
+func fnJSON(args []interface{}) (interface{}, error) {
+	if err := checkArgs(args, 1); err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return string(encoded), nil
+}
@@ -0,0 +1,114 @@
+package expr
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// twoCharOps must be matched before the single character operators
+var twoCharOps = []string{"==", "!=", "<=", ">=", "&&", "||"}
+
+const singleCharOps = "+-*/%<>!()[].,|"
+
+// tokenize splits src[start:end] into tokens, recording the offset of each
+// one within src so errors can point into a larger template
+func tokenize(src string, start, end int) ([]token, error) {
+	var tokens []token
+	i := start
+	for i < end {
+		c := rune(src[i])
+
+		switch {
+		case unicode.IsSpace(c):
+			i++
+
+		case unicode.IsDigit(c):
+			begin := i
+			for i < end && (unicode.IsDigit(rune(src[i])) || src[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: src[begin:i], pos: begin})
+
+		case c == '_' || unicode.IsLetter(c):
+			begin := i
+			for i < end && (src[i] == '_' || unicode.IsLetter(rune(src[i])) || unicode.IsDigit(rune(src[i]))) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: src[begin:i], pos: begin})
+
+		case c == '"' || c == '\'':
+			text, n, err := readString(src[i:end])
+			if err != nil {
+				return nil, newError(src, i, err.Error())
+			}
+			tokens = append(tokens, token{kind: tokString, text: text, pos: i})
+			i += n
+
+		default:
+			matched := false
+			for _, op := range twoCharOps {
+				if strings.HasPrefix(src[i:end], op) {
+					tokens = append(tokens, token{kind: tokOp, text: op, pos: i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if matched {
+				continue
+			}
+			if strings.ContainsRune(singleCharOps, c) {
+				tokens = append(tokens, token{kind: tokOp, text: string(c), pos: i})
+				i++
+				continue
+			}
+			return nil, newError(src, i, fmt.Sprintf("unexpected character %q", c))
+		}
+	}
+
+	tokens = append(tokens, token{kind: tokEOF, pos: end})
+	return tokens, nil
+}
+
+// readString reads a quoted string literal and returns its value and length
+func readString(src string) (string, int, error) {
+	quote := src[0]
+	var b strings.Builder
+	for i := 1; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case c == '\\' && i+1 < len(src):
+			i++
+			switch src[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			default:
+				b.WriteByte(src[i])
+			}
+		case c == quote:
+			return b.String(), i + 1, nil
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
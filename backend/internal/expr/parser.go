@@ -0,0 +1,318 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+)
+
+type parser struct {
+	src    string
+	tokens []token
+	i      int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.i]
+	if tok.kind != tokEOF {
+		p.i++
+	}
+	return tok
+}
+
+// accept consumes the next token if it is one of the given operators or keywords
+func (p *parser) accept(ops ...string) (token, bool) {
+	tok := p.peek()
+	if tok.kind != tokOp && tok.kind != tokIdent {
+		return tok, false
+	}
+	for _, op := range ops {
+		if tok.text == op {
+			p.i++
+			return tok, true
+		}
+	}
+	return tok, false
+}
+
+func (p *parser) expect(op string) (token, error) {
+	tok := p.peek()
+	if tok.kind != tokOp || tok.text != op {
+		return tok, p.errorAt(tok, fmt.Sprintf("expected %q", op))
+	}
+	p.i++
+	return tok, nil
+}
+
+func (p *parser) errorAt(tok token, msg string) error {
+	if tok.kind == tokEOF {
+		return newError(p.src, tok.pos, msg+", found end of expression")
+	}
+	return newError(p.src, tok.pos, fmt.Sprintf("%s, found %q", msg, tok.text))
+}
+
+// parseExpression parses a full expression including filters, which bind
+// loosest: "a or b | upper" applies upper to the result of "a or b"
+func (p *parser) parseExpression() (node, error) {
+	left, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("|"); !ok {
+			return left, nil
+		}
+		name := p.next()
+		if name.kind != tokIdent {
+			return nil, p.errorAt(name, "expected filter name")
+		}
+		if _, known := functions[name.text]; !known {
+			return nil, newError(p.src, name.pos, fmt.Sprintf("unknown filter %q", name.text))
+		}
+
+		// The piped value becomes the filter's first argument
+		args := []node{left}
+		if _, ok := p.accept("("); ok {
+			extra, err := p.parseArguments(")")
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, extra...)
+		}
+		left = &callNode{name: name.text, args: args, pos: name.pos}
+	}
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok, ok := p.accept("||", "or")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: "||", left: left, right: right, pos: tok.pos}
+	}
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok, ok := p.accept("&&", "and")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: "&&", left: left, right: right, pos: tok.pos}
+	}
+}
+
+func (p *parser) parseNot() (node, error) {
+	if tok, ok := p.accept("!", "not"); ok {
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op: "!", operand: operand, pos: tok.pos}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	tok, ok := p.accept("==", "!=", "<", "<=", ">", ">=", "in")
+	if !ok {
+		return left, nil
+	}
+	right, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	return &binaryNode{op: tok.text, left: left, right: right, pos: tok.pos}, nil
+}
+
+func (p *parser) parseAdditive() (node, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok, ok := p.accept("+", "-")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: tok.text, left: left, right: right, pos: tok.pos}
+	}
+}
+
+func (p *parser) parseMultiplicative() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok, ok := p.accept("*", "/", "%")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: tok.text, left: left, right: right, pos: tok.pos}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if tok, ok := p.accept("-"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op: "-", operand: operand, pos: tok.pos}, nil
+	}
+	return p.parsePostfix()
+}
+
+func (p *parser) parsePostfix() (node, error) {
+	n, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		tok := p.peek()
+		if tok.kind != tokOp {
+			return n, nil
+		}
+
+		switch tok.text {
+		case ".":
+			p.next()
+			name := p.next()
+			if name.kind != tokIdent {
+				return nil, p.errorAt(name, "expected field name")
+			}
+			n = &indexNode{target: n, index: &literalNode{value: name.text}, pos: name.pos}
+		case "[":
+			p.next()
+			index, err := p.parseExpression()
+			if err != nil {
+				return nil, err
+			}
+			if _, err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			n = &indexNode{target: n, index: index, pos: tok.pos}
+		case "(":
+			ident, ok := n.(*identNode)
+			if !ok {
+				return nil, newError(p.src, tok.pos, "only built-in functions can be called")
+			}
+			if _, known := functions[ident.name]; !known {
+				return nil, newError(p.src, ident.pos, fmt.Sprintf("unknown function %q", ident.name))
+			}
+			p.next()
+			args, err := p.parseArguments(")")
+			if err != nil {
+				return nil, err
+			}
+			n = &callNode{name: ident.name, args: args, pos: ident.pos}
+		default:
+			return n, nil
+		}
+	}
+}
+
+// parseArguments parses a comma separated list up to the closing token
+func (p *parser) parseArguments(closing string) ([]node, error) {
+	var args []node
+	if _, ok := p.accept(closing); ok {
+		return args, nil
+	}
+	for {
+		arg, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+
+		if _, ok := p.accept(","); ok {
+			continue
+		}
+		if _, err := p.expect(closing); err != nil {
+			return nil, err
+		}
+		return args, nil
+	}
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	tok := p.next()
+
+	switch tok.kind {
+	case tokNumber:
+		value, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, newError(p.src, tok.pos, fmt.Sprintf("invalid number %q", tok.text))
+		}
+		return &literalNode{value: value}, nil
+
+	case tokString:
+		return &literalNode{value: tok.text}, nil
+
+	case tokIdent:
+		switch tok.text {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "null", "nil":
+			return &literalNode{value: nil}, nil
+		}
+		return &identNode{name: tok.text, pos: tok.pos}, nil
+
+	case tokOp:
+		switch tok.text {
+		case "(":
+			inner, err := p.parseExpression()
+			if err != nil {
+				return nil, err
+			}
+			if _, err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return inner, nil
+		case "[":
+			items, err := p.parseArguments("]")
+			if err != nil {
+				return nil, err
+			}
+			return &listNode{items: items}, nil
+		}
+	}
+
+	return nil, p.errorAt(tok, "expected a value")
+}
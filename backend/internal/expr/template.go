@@ -0,0 +1,165 @@
+package expr
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	openDelim     = "{{"
+	closeDelim    = "}}"
+	partialMarker = ">"
+
+	// maxPartialDepth bounds how deeply partials may include each other
+	maxPartialDepth = 8
+)
+
+// Template is a string with embedded {{ expression }} blocks
+type Template struct {
+	src   string
+	parts []templatePart
+}
+
+type templatePart struct {
+	literal string
+	program *Program
+}
+
+// IsTemplate reports whether a string contains template blocks
+func IsTemplate(s string) bool {
+	return strings.Contains(s, openDelim)
+}
+
+// CompileTemplate parses a template, reporting the position of the first
+// error within the template text
+func CompileTemplate(src string) (*Template, error) {
+	t := &Template{src: src}
+
+	i := 0
+	for i < len(src) {
+		start := strings.Index(src[i:], openDelim)
+		if start < 0 {
+			t.parts = append(t.parts, templatePart{literal: src[i:]})
+			break
+		}
+		start += i
+		if start > i {
+			t.parts = append(t.parts, templatePart{literal: src[i:start]})
+		}
+
+		exprStart := start + len(openDelim)
+		end := strings.Index(src[exprStart:], closeDelim)
+		if end < 0 {
+			return nil, newError(src, start, "unclosed \"{{\"")
+		}
+		end += exprStart
+
+		program, err := compileRange(src, exprStart, end)
+		if err != nil {
+			return nil, err
+		}
+		t.parts = append(t.parts, templatePart{program: program})
+		i = end + len(closeDelim)
+	}
+
+	return t, nil
+}
+
+// Render evaluates the template. A template consisting of a single block
+// returns the block's value unchanged, so "{{ inputs.items }}" yields a list;
+// anything else renders to a string.
+func (t *Template) Render(vars map[string]interface{}) (interface{}, error) {
+	if len(t.parts) == 1 && t.parts[0].program != nil {
+		return t.parts[0].program.Eval(vars)
+	}
+
+	var b strings.Builder
+	for _, part := range t.parts {
+		if part.program == nil {
+			b.WriteString(part.literal)
+			continue
+		}
+		value, err := part.program.Eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		b.WriteString(ToString(value))
+	}
+	return b.String(), nil
+}
+
+// Render compiles and renders a template in one step
+func Render(src string, vars map[string]interface{}) (interface{}, error) {
+	t, err := CompileTemplate(src)
+	if err != nil {
+		return nil, err
+	}
+	return t.Render(vars)
+}
+
+// ExpandPartials replaces every {{> name }} block with the named partial.
+// Partials may include other partials; unknown names and include cycles are
+// reported at the position of the offending block.
+func ExpandPartials(src string, partials map[string]string) (string, error) {
+	return expandPartials(src, partials, nil)
+}
+
+func expandPartials(src string, partials map[string]string, stack []string) (string, error) {
+	if !strings.Contains(src, openDelim) {
+		return src, nil
+	}
+
+	var b strings.Builder
+	i := 0
+	for i < len(src) {
+		start := strings.Index(src[i:], openDelim)
+		if start < 0 {
+			b.WriteString(src[i:])
+			break
+		}
+		start += i
+
+		end := strings.Index(src[start:], closeDelim)
+		if end < 0 {
+			// Left for CompileTemplate to report
+			b.WriteString(src[i:])
+			break
+		}
+		end += start
+
+		inner := strings.TrimSpace(src[start+len(openDelim) : end])
+		if !strings.HasPrefix(inner, partialMarker) {
+			b.WriteString(src[i : end+len(closeDelim)])
+			i = end + len(closeDelim)
+			continue
+		}
+		b.WriteString(src[i:start])
+
+		name := strings.TrimSpace(strings.TrimPrefix(inner, partialMarker))
+		content, ok := partials[name]
+		if !ok {
+			return "", newError(src, start, fmt.Sprintf("unknown partial %q", name))
+		}
+		for _, seen := range stack {
+			if seen == name {
+				return "", newError(src, start, fmt.Sprintf("partial %q includes itself", name))
+			}
+		}
+		if len(stack) >= maxPartialDepth {
+			return "", newError(src, start, fmt.Sprintf("partials nested deeper than %d", maxPartialDepth))
+		}
+
+		expanded, err := expandPartials(content, partials, append(stack, name))
+		if err != nil {
+			if exprErr, ok := err.(*Error); ok {
+				// Point at the include, naming the partial that failed
+				return "", newError(src, start, fmt.Sprintf("in partial %q: %s", name, exprErr.Msg))
+			}
+			return "", err
+		}
+		b.WriteString(expanded)
+		i = end + len(closeDelim)
+	}
+
+	return b.String(), nil
+}
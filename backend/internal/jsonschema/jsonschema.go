@@ -0,0 +1,547 @@
+// Package jsonschema validates decoded JSON values against a JSON Schema.
+// It covers the keywords used to describe the shape of model output: type,
+// enum, const, properties, required, additionalProperties, items, the
+// numeric, string and array bounds, pattern, allOf, anyOf, oneOf, not and
+// local $ref into $defs or definitions. Other keywords are ignored.
+package jsonschema
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Error is a single validation failure
+type Error struct {
+	Path string `json:"path"` // JSON pointer to the failing value; empty for the root
+	Msg  string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	if e.Path == "" {
+		return e.Msg
+	}
+	return e.Path + ": " + e.Msg
+}
+
+// Errors is the list of failures of a value
+type Errors []*Error
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Schema is a checked schema ready to validate values
+type Schema struct {
+	root     map[string]interface{}
+	patterns map[string]*regexp.Regexp
+}
+
+// Compile checks a schema and prepares it for validation
+func Compile(schema map[string]interface{}) (*Schema, error) {
+	s := &Schema{root: schema, patterns: make(map[string]*regexp.Regexp)}
+	if err := s.check(schema, ""); err != nil {
+		return nil, err
+	}
+	if err := s.checkRefs(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Validate reports every way value fails the schema, or nil if it conforms
+func (s *Schema) Validate(value interface{}) error {
+	var errs Errors
+	s.validate(s.root, value, "", &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+var knownTypes = map[string]bool{
+	"object": true, "array": true, "string": true, "number": true,
+	"integer": true, "boolean": true, "null": true,
+}
+
+// check verifies the keywords of a schema and its subschemas
+func (s *Schema) check(schema map[string]interface{}, path string) error {
+	fail := func(keyword, format string, args ...interface{}) error {
+		return &Error{Path: path + "/" + keyword, Msg: fmt.Sprintf(format, args...)}
+	}
+
+	switch t := schema["type"].(type) {
+	case nil:
+	case string:
+		if !knownTypes[t] {
+			return fail("type", "unknown type %q", t)
+		}
+	case []interface{}:
+		for _, item := range t {
+			if name, _ := item.(string); !knownTypes[name] {
+				return fail("type", "unknown type %v", item)
+			}
+		}
+	default:
+		return fail("type", "type must be a string or a list of strings")
+	}
+
+	if raw, ok := schema["pattern"]; ok {
+		pattern, ok := raw.(string)
+		if !ok {
+			return fail("pattern", "pattern must be a string")
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fail("pattern", "invalid pattern: %v", err)
+		}
+		s.patterns[pattern] = re
+	}
+
+	for _, keyword := range []string{"minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum", "minLength", "maxLength", "minItems", "maxItems", "minProperties", "maxProperties"} {
+		if raw, ok := schema[keyword]; ok {
+			if _, ok := raw.(float64); !ok {
+				return fail(keyword, "%s must be a number", keyword)
+			}
+		}
+	}
+
+	if raw, ok := schema["required"]; ok {
+		list, ok := raw.([]interface{})
+		if !ok {
+			return fail("required", "required must be a list of property names")
+		}
+		for _, item := range list {
+			if _, ok := item.(string); !ok {
+				return fail("required", "required must be a list of property names")
+			}
+		}
+	}
+	if raw, ok := schema["enum"]; ok {
+		if _, ok := raw.([]interface{}); !ok {
+			return fail("enum", "enum must be a list")
+		}
+	}
+
+	if raw, ok := schema["$ref"]; ok {
+		ref, _ := raw.(string)
+		if _, err := s.resolve(ref); err != nil {
+			return fail("$ref", "%v", err)
+		}
+	}
+
+	// Subschemas
+	for _, keyword := range []string{"properties", "$defs", "definitions"} {
+		if raw, ok := schema[keyword]; ok {
+			children, ok := raw.(map[string]interface{})
+			if !ok {
+				return fail(keyword, "%s must be an object", keyword)
+			}
+			for name, child := range children {
+				if err := s.checkChild(child, path+"/"+keyword+"/"+name); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for _, keyword := range []string{"items", "not"} {
+		if raw, ok := schema[keyword]; ok {
+			if err := s.checkChild(raw, path+"/"+keyword); err != nil {
+				return err
+			}
+		}
+	}
+	if raw, ok := schema["additionalProperties"]; ok {
+		if _, isBool := raw.(bool); !isBool {
+			if err := s.checkChild(raw, path+"/additionalProperties"); err != nil {
+				return err
+			}
+		}
+	}
+	for _, keyword := range []string{"allOf", "anyOf", "oneOf"} {
+		if raw, ok := schema[keyword]; ok {
+			list, ok := raw.([]interface{})
+			if !ok || len(list) == 0 {
+				return fail(keyword, "%s must be a non-empty list of schemas", keyword)
+			}
+			for i, child := range list {
+				if err := s.checkChild(child, fmt.Sprintf("%s/%s/%d", path, keyword, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *Schema) checkChild(raw interface{}, path string) error {
+	child, ok := raw.(map[string]interface{})
+	if !ok {
+		return &Error{Path: path, Msg: "schema must be an object"}
+	}
+	return s.check(child, path)
+}
+
+// subschema is a schema nested in another or referenced by it
+type subschema struct {
+	schema    map[string]interface{}
+	path      string
+	sameValue bool // Validated against the same value as its parent
+}
+
+// subschemas lists the schemas a schema nests or references
+func (s *Schema) subschemas(schema map[string]interface{}, path string) []subschema {
+	var subs []subschema
+	add := func(raw interface{}, path string, sameValue bool) {
+		if child, ok := raw.(map[string]interface{}); ok {
+			subs = append(subs, subschema{schema: child, path: path, sameValue: sameValue})
+		}
+	}
+
+	if ref, ok := schema["$ref"].(string); ok {
+		if target, err := s.resolve(ref); err == nil {
+			add(target, strings.TrimPrefix(ref, "#"), true)
+		}
+	}
+	for _, keyword := range []string{"properties", "$defs", "definitions"} {
+		children, _ := schema[keyword].(map[string]interface{})
+		for name, child := range children {
+			add(child, path+"/"+keyword+"/"+name, false)
+		}
+	}
+	add(schema["items"], path+"/items", false)
+	add(schema["additionalProperties"], path+"/additionalProperties", false)
+	add(schema["not"], path+"/not", true)
+	for _, keyword := range []string{"allOf", "anyOf", "oneOf"} {
+		list, _ := schema[keyword].([]interface{})
+		for i, child := range list {
+			add(child, fmt.Sprintf("%s/%s/%d", path, keyword, i), true)
+		}
+	}
+	return subs
+}
+
+// checkRefs rejects references that lead back to a schema without going
+// through properties or items first. Validation would follow them forever
+// without ever moving on to a smaller value.
+func (s *Schema) checkRefs() error {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[uintptr]int)
+	var follow func(schema map[string]interface{}, path string) error
+	follow = func(schema map[string]interface{}, path string) error {
+		key := reflect.ValueOf(schema).Pointer()
+		switch state[key] {
+		case visiting:
+			return &Error{Path: path, Msg: "$ref cycle: the schema refers back to itself without going through properties or items"}
+		case visited:
+			return nil
+		}
+		state[key] = visiting
+		for _, sub := range s.subschemas(schema, path) {
+			if sub.sameValue {
+				if err := follow(sub.schema, sub.path); err != nil {
+					return err
+				}
+			}
+		}
+		state[key] = visited
+		return nil
+	}
+
+	// Referenced schemas may sit outside $defs, so every schema reachable
+	// from the root is a starting point
+	seen := make(map[uintptr]bool)
+	var walk func(schema map[string]interface{}, path string) error
+	walk = func(schema map[string]interface{}, path string) error {
+		key := reflect.ValueOf(schema).Pointer()
+		if seen[key] {
+			return nil
+		}
+		seen[key] = true
+		if err := follow(schema, path); err != nil {
+			return err
+		}
+		for _, sub := range s.subschemas(schema, path) {
+			if err := walk(sub.schema, sub.path); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(s.root, "")
+}
+
+// resolve finds the schema a local reference such as #/$defs/address points to
+func (s *Schema) resolve(ref string) (map[string]interface{}, error) {
+	if ref == "#" {
+		return s.root, nil
+	}
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("only local references are supported, got %q", ref)
+	}
+
+	var current interface{} = s.root
+	for _, part := range strings.Split(ref[2:], "/") {
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		fields, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("reference %q not found", ref)
+		}
+		if current, ok = fields[part]; !ok {
+			return nil, fmt.Errorf("reference %q not found", ref)
+		}
+	}
+
+	schema, ok := current.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("reference %q is not a schema", ref)
+	}
+	return schema, nil
+}
+
+func (s *Schema) validate(schema map[string]interface{}, value interface{}, path string, errs *Errors) {
+	add := func(format string, args ...interface{}) {
+		*errs = append(*errs, &Error{Path: path, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	if ref, ok := schema["$ref"].(string); ok {
+		if target, err := s.resolve(ref); err == nil {
+			s.validate(target, value, path, errs)
+		}
+	}
+
+	if raw, ok := schema["type"]; ok && !matchesType(raw, value) {
+		add("expected %s, got %s", describeType(raw), typeOf(value))
+		// Further keywords would only repeat the mismatch
+		return
+	}
+
+	if raw, ok := schema["const"]; ok && !equal(raw, value) {
+		add("must equal %s", format(raw))
+	}
+	if list, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, item := range list {
+			if equal(item, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			options := make([]string, len(list))
+			for i, item := range list {
+				options[i] = format(item)
+			}
+			add("must be one of %s", strings.Join(options, ", "))
+		}
+	}
+
+	switch val := value.(type) {
+	case float64:
+		if min, ok := schema["minimum"].(float64); ok && val < min {
+			add("must be at least %v", min)
+		}
+		if max, ok := schema["maximum"].(float64); ok && val > max {
+			add("must be at most %v", max)
+		}
+		if min, ok := schema["exclusiveMinimum"].(float64); ok && val <= min {
+			add("must be greater than %v", min)
+		}
+		if max, ok := schema["exclusiveMaximum"].(float64); ok && val >= max {
+			add("must be less than %v", max)
+		}
+	case string:
+		length := float64(utf8.RuneCountInString(val))
+		if min, ok := schema["minLength"].(float64); ok && length < min {
+			add("must be at least %v characters long", min)
+		}
+		if max, ok := schema["maxLength"].(float64); ok && length > max {
+			add("must be at most %v characters long", max)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			if re := s.patterns[pattern]; re != nil && !re.MatchString(val) {
+				add("must match pattern %q", pattern)
+			}
+		}
+	case []interface{}:
+		if min, ok := schema["minItems"].(float64); ok && float64(len(val)) < min {
+			add("must have at least %v items", min)
+		}
+		if max, ok := schema["maxItems"].(float64); ok && float64(len(val)) > max {
+			add("must have at most %v items", max)
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range val {
+				s.validate(items, item, fmt.Sprintf("%s/%d", path, i), errs)
+			}
+		}
+	case map[string]interface{}:
+		s.validateObject(schema, val, path, errs)
+	}
+
+	if list, ok := schema["allOf"].([]interface{}); ok {
+		for _, raw := range list {
+			if child, ok := raw.(map[string]interface{}); ok {
+				s.validate(child, value, path, errs)
+			}
+		}
+	}
+	if list, ok := schema["anyOf"].([]interface{}); ok && s.countMatches(list, value, path) == 0 {
+		add("must match at least one of the anyOf schemas")
+	}
+	if list, ok := schema["oneOf"].([]interface{}); ok {
+		if n := s.countMatches(list, value, path); n != 1 {
+			add("must match exactly one of the oneOf schemas, matched %d", n)
+		}
+	}
+	if not, ok := schema["not"].(map[string]interface{}); ok && s.matches(not, value, path) {
+		add("must not match the not schema")
+	}
+}
+
+func (s *Schema) validateObject(schema map[string]interface{}, val map[string]interface{}, path string, errs *Errors) {
+	add := func(format string, args ...interface{}) {
+		*errs = append(*errs, &Error{Path: path, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, raw := range required {
+			if name, _ := raw.(string); name != "" {
+				if _, ok := val[name]; !ok {
+					add("missing required property %q", name)
+				}
+			}
+		}
+	}
+	if min, ok := schema["minProperties"].(float64); ok && float64(len(val)) < min {
+		add("must have at least %v properties", min)
+	}
+	if max, ok := schema["maxProperties"].(float64); ok && float64(len(val)) > max {
+		add("must have at most %v properties", max)
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	names := make([]string, 0, len(val))
+	for name := range val {
+		names = append(names, name)
+	}
+	// Report problems in a stable order
+	sort.Strings(names)
+
+	for _, name := range names {
+		childPath := path + "/" + strings.ReplaceAll(strings.ReplaceAll(name, "~", "~0"), "/", "~1")
+		if child, ok := properties[name].(map[string]interface{}); ok {
+			s.validate(child, val[name], childPath, errs)
+			continue
+		}
+		if _, declared := properties[name]; declared {
+			continue
+		}
+		switch extra := schema["additionalProperties"].(type) {
+		case bool:
+			if !extra {
+				add("unexpected property %q", name)
+			}
+		case map[string]interface{}:
+			s.validate(extra, val[name], childPath, errs)
+		}
+	}
+}
+
+func (s *Schema) matches(schema map[string]interface{}, value interface{}, path string) bool {
+	var errs Errors
+	s.validate(schema, value, path, &errs)
+	return len(errs) == 0
+}
+
+func (s *Schema) countMatches(list []interface{}, value interface{}, path string) int {
+	n := 0
+	for _, raw := range list {
+		if child, ok := raw.(map[string]interface{}); ok && s.matches(child, value, path) {
+			n++
+		}
+	}
+	return n
+}
+
+func matchesType(raw interface{}, value interface{}) bool {
+	switch t := raw.(type) {
+	case string:
+		return isType(t, value)
+	case []interface{}:
+		for _, item := range t {
+			if name, _ := item.(string); isType(name, value) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func isType(name string, value interface{}) bool {
+	switch name {
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n) && !math.IsInf(n, 0)
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	default:
+		return typeOf(value) == name
+	}
+}
+
+// typeOf names the JSON type of a decoded value
+func typeOf(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func describeType(raw interface{}) string {
+	if list, ok := raw.([]interface{}); ok {
+		names := make([]string, len(list))
+		for i, item := range list {
+			names[i] = fmt.Sprint(item)
+		}
+		return strings.Join(names, " or ")
+	}
+	return fmt.Sprint(raw)
+}
+
+func equal(a, b interface{}) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+func format(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return fmt.Sprintf("%q", s)
+	}
+	return fmt.Sprint(value)
+}
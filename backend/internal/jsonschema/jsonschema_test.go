@@ -0,0 +1,119 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func decode(t *testing.T, raw string) map[string]interface{} {
+	t.Helper()
+	var schema map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &schema); err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+func TestCompileRejectsRefCycles(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+	}{
+		{"root refers to itself", `{"$ref": "#"}`},
+		{"definition refers to itself", `{"$defs": {"a": {"$ref": "#/$defs/a"}}, "$ref": "#/$defs/a"}`},
+		{"definitions refer to each other", `{"$defs": {"a": {"$ref": "#/$defs/b"}, "b": {"$ref": "#/$defs/a"}}, "$ref": "#/$defs/a"}`},
+		{"cycle through allOf", `{"$defs": {"a": {"allOf": [{"$ref": "#/$defs/a"}]}}, "$ref": "#/$defs/a"}`},
+		{"cycle through not", `{"type": "object", "not": {"$ref": "#"}}`},
+		{"cycle outside $defs", `{"x": {"$ref": "#/x"}, "$ref": "#/x"}`},
+		{"cycle in an unused definition", `{"$defs": {"a": {"anyOf": [{"$ref": "#/$defs/a"}]}}, "type": "string"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Compile(decode(t, tt.schema))
+			if err == nil || !strings.Contains(err.Error(), "$ref cycle") {
+				t.Errorf("Compile error = %v, want a $ref cycle", err)
+			}
+		})
+	}
+}
+
+func TestRecursiveSchema(t *testing.T) {
+	// References back to a schema through properties or items are fine:
+	// each step validates a smaller part of the value
+	schema, err := Compile(decode(t, `{
+		"$defs": {
+			"node": {
+				"type": "object",
+				"required": ["name"],
+				"properties": {
+					"name": {"type": "string"},
+					"children": {"type": "array", "items": {"$ref": "#/$defs/node"}}
+				}
+			}
+		},
+		"$ref": "#/$defs/node"
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := map[string]interface{}{
+		"name": "root",
+		"children": []interface{}{
+			map[string]interface{}{"name": "a", "children": []interface{}{map[string]interface{}{"name": "b"}}},
+		},
+	}
+	if err := schema.Validate(valid); err != nil {
+		t.Errorf("Validate(valid) = %v", err)
+	}
+
+	invalid := map[string]interface{}{
+		"name":     "root",
+		"children": []interface{}{map[string]interface{}{"children": []interface{}{}}},
+	}
+	err = schema.Validate(invalid)
+	if err == nil || err.Error() != `/children/0: missing required property "name"` {
+		t.Errorf("Validate(invalid) = %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	schema, err := Compile(decode(t, `{
+		"type": "object",
+		"required": ["name", "tags"],
+		"additionalProperties": false,
+		"properties": {
+			"name": {"type": "string", "minLength": 1},
+			"age": {"type": "integer", "minimum": 0},
+			"tags": {"type": "array", "items": {"enum": ["a", "b"]}, "maxItems": 2}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{`{"name": "x", "tags": ["a"]}`, ""},
+		{`{"name": "x", "age": 1.5, "tags": []}`, "/age: expected integer, got number"},
+		{`{"name": "", "tags": ["c"]}`, `/name: must be at least 1 characters long; /tags/0: must be one of "a", "b"`},
+		{`{"tags": [], "extra": true}`, `missing required property "name"; unexpected property "extra"`},
+		{`[]`, "expected object, got array"},
+	}
+	for _, tt := range tests {
+		var value interface{}
+		if err := json.Unmarshal([]byte(tt.value), &value); err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if err := schema.Validate(value); err != nil {
+			got = err.Error()
+		}
+		if got != tt.want {
+			t.Errorf("Validate(%s) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
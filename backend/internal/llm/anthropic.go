@@ -0,0 +1,364 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultAnthropicURL is the base URL of the Anthropic API
+	DefaultAnthropicURL = "https://api.anthropic.com"
+	// AnthropicVersion is the API version requests are made against
+	AnthropicVersion = "2023-06-01"
+	// DefaultAnthropicMaxTokens is used when a request sets no limit, which
+	// the messages API requires
+	DefaultAnthropicMaxTokens = 4096
+)
+
+// Anthropic talks to the Anthropic messages API, or any server speaking the
+// same protocol. The system prompt travels separately from the messages,
+// which are made of typed content blocks; tool calls and their results are
+// tool_use and tool_result blocks.
+type Anthropic struct {
+	name string
+	http *httpClient
+}
+
+// NewAnthropic creates a provider for the messages API at baseURL
+func NewAnthropic(name, baseURL, apiKey string, timeout time.Duration) *Anthropic {
+	if baseURL == "" {
+		baseURL = DefaultAnthropicURL
+	}
+	client := newHTTPClient(name, baseURL, timeout)
+	client.headers["x-api-key"] = apiKey
+	client.headers["anthropic-version"] = AnthropicVersion
+
+	return &Anthropic{
+		name: name,
+		http: client,
+	}
+}
+
+// Name returns the name the provider is configured under
+func (a *Anthropic) Name() string {
+	return a.name
+}
+
+// anthropicBlock is one content block of a message
+type anthropicBlock struct {
+	Type string `json:"type"`
+
+	Text string `json:"text,omitempty"` // text
+
+	ID    string          `json:"id,omitempty"`    // tool_use
+	Name  string          `json:"name,omitempty"`  // tool_use
+	Input json.RawMessage `json:"input,omitempty"` // tool_use
+
+	ToolUseID string `json:"tool_use_id,omitempty"` // tool_result
+	Content   string `json:"content,omitempty"`     // tool_result
+}
+
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+type anthropicTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	InputSchema map[string]interface{} `json:"input_schema"`
+}
+
+type anthropicRequest struct {
+	Model         string             `json:"model"`
+	System        string             `json:"system,omitempty"`
+	Messages      []anthropicMessage `json:"messages"`
+	Tools         []anthropicTool    `json:"tools,omitempty"`
+	MaxTokens     int                `json:"max_tokens"`
+	Temperature   *float64           `json:"temperature,omitempty"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+	Stream        bool               `json:"stream,omitempty"`
+}
+
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type anthropicResponse struct {
+	Model      string           `json:"model"`
+	Content    []anthropicBlock `json:"content"`
+	StopReason string           `json:"stop_reason"`
+	Usage      anthropicUsage   `json:"usage"`
+}
+
+// messagesRequest converts a chat request. System messages are joined into
+// the system prompt, tool results become tool_result blocks of a user
+// message, and consecutive messages of the same role are merged, since the
+// API expects user and assistant turns to alternate.
+func (a *Anthropic) messagesRequest(req *ChatRequest, stream bool) (*anthropicRequest, error) {
+	body := &anthropicRequest{
+		Model:         req.Model,
+		MaxTokens:     req.MaxTokens,
+		Temperature:   req.Temperature,
+		StopSequences: req.Stop,
+		Stream:        stream,
+	}
+	if body.MaxTokens <= 0 {
+		body.MaxTokens = DefaultAnthropicMaxTokens
+	}
+
+	var system []string
+	for _, m := range req.Messages {
+		role := m.Role
+		var blocks []anthropicBlock
+
+		switch m.Role {
+		case RoleSystem:
+			system = append(system, m.Content)
+			continue
+		case RoleTool:
+			role = RoleUser
+			blocks = append(blocks, anthropicBlock{Type: "tool_result", ToolUseID: m.ToolCallID, Content: m.Content})
+		case RoleUser, RoleAssistant:
+			if m.Content != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: m.Content})
+			}
+			for _, call := range m.ToolCalls {
+				args := call.Arguments
+				if args == nil {
+					args = map[string]interface{}{}
+				}
+				input, err := json.Marshal(args)
+				if err != nil {
+					return nil, err
+				}
+				blocks = append(blocks, anthropicBlock{Type: "tool_use", ID: call.ID, Name: call.Name, Input: input})
+			}
+		default:
+			return nil, fmt.Errorf("%s: unsupported message role %q", a.name, m.Role)
+		}
+
+		if n := len(body.Messages); n > 0 && body.Messages[n-1].Role == role {
+			body.Messages[n-1].Content = append(body.Messages[n-1].Content, blocks...)
+			continue
+		}
+		body.Messages = append(body.Messages, anthropicMessage{Role: role, Content: blocks})
+	}
+	body.System = strings.Join(system, "\n\n")
+
+	for _, tool := range req.Tools {
+		schema := tool.Parameters
+		if schema == nil {
+			schema = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+		}
+		body.Tools = append(body.Tools, anthropicTool{Name: tool.Name, Description: tool.Description, InputSchema: schema})
+	}
+
+	return body, nil
+}
+
+// reply converts the content blocks of a response into a message
+func (a *Anthropic) reply(blocks []anthropicBlock) (Message, error) {
+	message := Message{Role: RoleAssistant}
+	for _, block := range blocks {
+		switch block.Type {
+		case "text":
+			message.Content += block.Text
+		case "tool_use":
+			args := map[string]interface{}{}
+			if len(block.Input) > 0 {
+				if err := json.Unmarshal(block.Input, &args); err != nil {
+					return message, fmt.Errorf("%s: invalid arguments for tool %q: %w", a.name, block.Name, err)
+				}
+			}
+			message.ToolCalls = append(message.ToolCalls, ToolCall{ID: block.ID, Name: block.Name, Arguments: args})
+		}
+	}
+	return message, nil
+}
+
+// Chat sends a request to /v1/messages
+func (a *Anthropic) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	body, err := a.messagesRequest(req, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp anthropicResponse
+	if err := a.http.doJSON(ctx, http.MethodPost, "/v1/messages", body, &resp, anthropicError); err != nil {
+		return nil, err
+	}
+
+	message, err := a.reply(resp.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ChatResponse{
+		Model:        resp.Model,
+		Message:      message,
+		FinishReason: resp.StopReason,
+		Usage:        Usage{PromptTokens: resp.Usage.InputTokens, CompletionTokens: resp.Usage.OutputTokens},
+	}, nil
+}
+
+// anthropicEvent is one server-sent event of a streamed response
+type anthropicEvent struct {
+	Type         string             `json:"type"`
+	Index        int                `json:"index"`
+	Message      *anthropicResponse `json:"message"`       // message_start
+	ContentBlock *anthropicBlock    `json:"content_block"` // content_block_start
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`         // text_delta
+		PartialJSON string `json:"partial_json"` // input_json_delta
+		StopReason  string `json:"stop_reason"`  // message_delta
+	} `json:"delta"`
+	Usage *anthropicUsage `json:"usage"` // message_delta
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// ChatStream sends a streaming request to /v1/messages. Text deltas are
+// passed to onText as they arrive; tool call arguments arrive as pieces of
+// JSON and are decoded once their block is complete.
+func (a *Anthropic) ChatStream(ctx context.Context, req *ChatRequest, onText func(text string) error) (*ChatResponse, error) {
+	body, err := a.messagesRequest(req, true)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := a.http.do(ctx, http.MethodPost, "/v1/messages", body, anthropicError)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := &ChatResponse{Model: req.Model}
+	var blocks []anthropicBlock
+	var partial map[int]*bytes.Buffer
+
+	err = readLines(resp.Body, func(line []byte) error {
+		data, ok := bytes.CutPrefix(line, []byte("data:"))
+		if !ok {
+			// Event names repeat the type carried in the data
+			return nil
+		}
+
+		var event anthropicEvent
+		if err := json.Unmarshal(bytes.TrimSpace(data), &event); err != nil {
+			return fmt.Errorf("%s: invalid stream event: %w", a.name, err)
+		}
+
+		switch event.Type {
+		case "message_start":
+			if event.Message != nil {
+				result.Model = event.Message.Model
+				result.Usage.PromptTokens = event.Message.Usage.InputTokens
+			}
+		case "content_block_start":
+			for len(blocks) <= event.Index {
+				blocks = append(blocks, anthropicBlock{})
+			}
+			if event.ContentBlock != nil {
+				blocks[event.Index] = *event.ContentBlock
+				blocks[event.Index].Input = nil
+			}
+		case "content_block_delta":
+			if event.Index >= len(blocks) {
+				return fmt.Errorf("%s: delta for unknown content block %d", a.name, event.Index)
+			}
+			switch event.Delta.Type {
+			case "text_delta":
+				blocks[event.Index].Text += event.Delta.Text
+				if err := onText(event.Delta.Text); err != nil {
+					return err
+				}
+			case "input_json_delta":
+				if partial == nil {
+					partial = make(map[int]*bytes.Buffer)
+				}
+				if partial[event.Index] == nil {
+					partial[event.Index] = &bytes.Buffer{}
+				}
+				partial[event.Index].WriteString(event.Delta.PartialJSON)
+			}
+		case "content_block_stop":
+			if buf := partial[event.Index]; buf != nil && event.Index < len(blocks) {
+				blocks[event.Index].Input = buf.Bytes()
+			}
+		case "message_delta":
+			if event.Delta.StopReason != "" {
+				result.FinishReason = event.Delta.StopReason
+			}
+			if event.Usage != nil {
+				result.Usage.CompletionTokens = event.Usage.OutputTokens
+			}
+		case "error":
+			if event.Error != nil {
+				return fmt.Errorf("%s: %s: %s", a.name, event.Error.Type, event.Error.Message)
+			}
+			return fmt.Errorf("%s: stream failed", a.name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result.Message, err = a.reply(blocks)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Models lists the available models through /v1/models
+func (a *Anthropic) Models(ctx context.Context) ([]Model, error) {
+	var resp struct {
+		Data []struct {
+			ID          string    `json:"id"`
+			DisplayName string    `json:"display_name"`
+			CreatedAt   time.Time `json:"created_at"`
+		} `json:"data"`
+	}
+	if err := a.http.doJSON(ctx, http.MethodGet, "/v1/models?limit=1000", nil, &resp, anthropicError); err != nil {
+		return nil, err
+	}
+
+	models := make([]Model, 0, len(resp.Data))
+	for _, m := range resp.Data {
+		created := m.CreatedAt
+		models = append(models, Model{
+			Provider:    a.name,
+			Name:        m.ID,
+			DisplayName: m.DisplayName,
+			ModifiedAt:  &created,
+		})
+	}
+
+	return models, nil
+}
+
+// anthropicError extracts the message of a messages API error body
+func anthropicError(body []byte) string {
+	var resp struct {
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	json.Unmarshal(body, &resp)
+	if resp.Error.Message == "" {
+		return ""
+	}
+	return resp.Error.Type + ": " + resp.Error.Message
+}
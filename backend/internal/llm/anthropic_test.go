@@ -0,0 +1,273 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// anthropicServer replays the recorded response in testdata/anthropic/file
+// to every request and hands the decoded request body to check
+func anthropicServer(t *testing.T, status int, header http.Header, file string, check func(t *testing.T, body *anthropicRequest)) *Anthropic {
+	t.Helper()
+
+	recorded, err := os.ReadFile(filepath.Join("testdata", "anthropic", file))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/messages" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if got := r.Header.Get("x-api-key"); got != "test-key" {
+			t.Errorf("x-api-key = %q, want %q", got, "test-key")
+		}
+		if got := r.Header.Get("anthropic-version"); got != AnthropicVersion {
+			t.Errorf("anthropic-version = %q, want %q", got, AnthropicVersion)
+		}
+
+		raw, _ := io.ReadAll(r.Body)
+		var body anthropicRequest
+		if err := json.Unmarshal(raw, &body); err != nil {
+			t.Errorf("invalid request body: %v", err)
+		}
+		if check != nil {
+			check(t, &body)
+		}
+
+		for key, values := range header {
+			w.Header()[key] = values
+		}
+		if strings.HasSuffix(file, ".sse") {
+			w.Header().Set("Content-Type", "text/event-stream")
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		w.WriteHeader(status)
+		w.Write(recorded)
+	}))
+	t.Cleanup(server.Close)
+
+	return NewAnthropic("anthropic", server.URL, "test-key", 5*time.Second)
+}
+
+var weatherTool = Tool{
+	Name:        "get_weather",
+	Description: "Current weather of a city",
+	Parameters: map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"city": map[string]interface{}{"type": "string"}},
+		"required":   []interface{}{"city"},
+	},
+}
+
+func TestAnthropicChatText(t *testing.T) {
+	a := anthropicServer(t, http.StatusOK, nil, "text.json", func(t *testing.T, body *anthropicRequest) {
+		if body.System != "Be brief.\n\nBe kind." {
+			t.Errorf("system = %q", body.System)
+		}
+		if body.MaxTokens != DefaultAnthropicMaxTokens {
+			t.Errorf("max_tokens = %d, want %d", body.MaxTokens, DefaultAnthropicMaxTokens)
+		}
+		if body.Stream {
+			t.Error("non-streaming request has stream set")
+		}
+		if len(body.Messages) != 1 || body.Messages[0].Role != RoleUser || body.Messages[0].Content[0].Text != "Hello" {
+			t.Errorf("messages = %+v", body.Messages)
+		}
+	})
+
+	resp, err := a.Chat(context.Background(), &ChatRequest{
+		Model: "claude-sonnet-4-20250514",
+		Messages: []Message{
+			{Role: RoleSystem, Content: "Be brief."},
+			{Role: RoleSystem, Content: "Be kind."},
+			{Role: RoleUser, Content: "Hello"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Message.Role != RoleAssistant || resp.Message.Content != "Hello! How can I help you today?" {
+		t.Errorf("message = %+v", resp.Message)
+	}
+	if resp.Model != "claude-sonnet-4-20250514" || resp.FinishReason != "end_turn" {
+		t.Errorf("model = %q, finish reason = %q", resp.Model, resp.FinishReason)
+	}
+	if resp.Usage != (Usage{PromptTokens: 12, CompletionTokens: 10}) {
+		t.Errorf("usage = %+v", resp.Usage)
+	}
+}
+
+func TestAnthropicChatToolRoundTrip(t *testing.T) {
+	a := anthropicServer(t, http.StatusOK, nil, "tool_use.json", func(t *testing.T, body *anthropicRequest) {
+		if len(body.Tools) != 1 || body.Tools[0].Name != "get_weather" || body.Tools[0].InputSchema["type"] != "object" {
+			t.Errorf("tools = %+v", body.Tools)
+		}
+	})
+
+	req := &ChatRequest{
+		Model:    "claude-sonnet-4-20250514",
+		Messages: []Message{{Role: RoleUser, Content: "Weather in Paris?"}},
+		Tools:    []Tool{weatherTool},
+	}
+	resp, err := a.Chat(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.FinishReason != "tool_use" || resp.Message.Content != "I'll check the weather in Paris." {
+		t.Errorf("finish reason = %q, content = %q", resp.FinishReason, resp.Message.Content)
+	}
+	if len(resp.Message.ToolCalls) != 1 {
+		t.Fatalf("tool calls = %+v", resp.Message.ToolCalls)
+	}
+	call := resp.Message.ToolCalls[0]
+	if call.ID != "toolu_01A09q90qw90lq917835lq9" || call.Name != "get_weather" || call.Arguments["city"] != "Paris" || call.Arguments["unit"] != "celsius" {
+		t.Errorf("tool call = %+v", call)
+	}
+
+	// Send the call and its result back: the assistant's tool_use block and
+	// the user's tool_result block must carry the same ID
+	req.Messages = append(req.Messages, resp.Message, Message{Role: RoleTool, ToolCallID: call.ID, Content: `{"temperature":18,"sky":"sunny"}`})
+
+	a = anthropicServer(t, http.StatusOK, nil, "tool_result.json", func(t *testing.T, body *anthropicRequest) {
+		if len(body.Messages) != 3 {
+			t.Errorf("messages = %+v", body.Messages)
+			return
+		}
+
+		assistant := body.Messages[1]
+		if assistant.Role != RoleAssistant || len(assistant.Content) != 2 {
+			t.Errorf("assistant message = %+v", assistant)
+			return
+		}
+		if text := assistant.Content[0]; text.Type != "text" || text.Text != "I'll check the weather in Paris." {
+			t.Errorf("text block = %+v", text)
+		}
+		use := assistant.Content[1]
+		if use.Type != "tool_use" || use.ID != call.ID || use.Name != "get_weather" {
+			t.Errorf("tool_use block = %+v", use)
+		}
+		var input map[string]interface{}
+		if err := json.Unmarshal(use.Input, &input); err != nil || input["city"] != "Paris" {
+			t.Errorf("tool_use input = %s", use.Input)
+		}
+
+		result := body.Messages[2]
+		if result.Role != RoleUser || len(result.Content) != 1 {
+			t.Errorf("tool result message = %+v", result)
+			return
+		}
+		if block := result.Content[0]; block.Type != "tool_result" || block.ToolUseID != call.ID || block.Content != `{"temperature":18,"sky":"sunny"}` {
+			t.Errorf("tool_result block = %+v", block)
+		}
+	})
+
+	resp, err = a.Chat(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Message.Content != "It is 18°C and sunny in Paris." || len(resp.Message.ToolCalls) != 0 {
+		t.Errorf("message = %+v", resp.Message)
+	}
+}
+
+func TestAnthropicChatStream(t *testing.T) {
+	a := anthropicServer(t, http.StatusOK, nil, "stream.sse", func(t *testing.T, body *anthropicRequest) {
+		if !body.Stream {
+			t.Error("streaming request has stream unset")
+		}
+	})
+
+	var texts []string
+	resp, err := a.ChatStream(context.Background(), &ChatRequest{
+		Model:    "claude-sonnet-4-20250514",
+		Messages: []Message{{Role: RoleUser, Content: "Weather in Paris?"}},
+		Tools:    []Tool{weatherTool},
+	}, func(text string) error {
+		texts = append(texts, text)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(texts, "|") != "Let me| check." {
+		t.Errorf("streamed text = %q", texts)
+	}
+	if resp.Message.Content != "Let me check." {
+		t.Errorf("content = %q", resp.Message.Content)
+	}
+	if len(resp.Message.ToolCalls) != 1 {
+		t.Fatalf("tool calls = %+v", resp.Message.ToolCalls)
+	}
+	if call := resp.Message.ToolCalls[0]; call.ID != "toolu_01T1x1fJ34qAmk2tNTrN7Up6" || call.Name != "get_weather" || call.Arguments["city"] != "Paris" {
+		t.Errorf("tool call = %+v", call)
+	}
+	if resp.FinishReason != "tool_use" {
+		t.Errorf("finish reason = %q", resp.FinishReason)
+	}
+	if resp.Usage != (Usage{PromptTokens: 472, CompletionTokens: 89}) {
+		t.Errorf("usage = %+v", resp.Usage)
+	}
+}
+
+func TestAnthropicChatStreamError(t *testing.T) {
+	a := anthropicServer(t, http.StatusOK, nil, "stream_error.sse", nil)
+
+	var streamed string
+	_, err := a.ChatStream(context.Background(), &ChatRequest{
+		Model:    "claude-sonnet-4-20250514",
+		Messages: []Message{{Role: RoleUser, Content: "Tell me a story"}},
+	}, func(text string) error {
+		streamed += text
+		return nil
+	})
+	if err == nil {
+		t.Fatal("expected the error event to fail the stream")
+	}
+	if err.Error() != "anthropic: overloaded_error: Overloaded" {
+		t.Errorf("error = %q", err)
+	}
+	if streamed != "Once upon" {
+		t.Errorf("streamed text = %q", streamed)
+	}
+}
+
+func TestAnthropicRateLimited(t *testing.T) {
+	header := http.Header{"Retry-After": []string{"30"}}
+	a := anthropicServer(t, http.StatusTooManyRequests, header, "rate_limited.json", nil)
+
+	_, err := a.Chat(context.Background(), &ChatRequest{
+		Model:    "claude-sonnet-4-20250514",
+		Messages: []Message{{Role: RoleUser, Content: "Hello"}},
+	})
+
+	var status *StatusError
+	if !errors.As(err, &status) {
+		t.Fatalf("error = %v, want a *StatusError", err)
+	}
+	if status.Provider != "anthropic" || status.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("status error = %+v", status)
+	}
+	if !status.RateLimited() {
+		t.Error("429 is not reported as rate limited")
+	}
+	if status.RetryAfter != 30*time.Second {
+		t.Errorf("retry after = %s, want 30s", status.RetryAfter)
+	}
+	if status.Message != "rate_limit_error: Number of request tokens has exceeded your per-minute rate limit" {
+		t.Errorf("message = %q", status.Message)
+	}
+}
@@ -0,0 +1,105 @@
+package llm
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/xizko39/nodeloom/internal/config"
+)
+
+// Provider families accepted in the "type" field of a provider's config
+const (
+	TypeOllama    = "ollama"
+	TypeAnthropic = "anthropic" // Messages API
+	TypeMock      = "mock"      // Scripted replies, see Mock
+)
+
+// FromConfig builds a registry holding every provider in the config, with
+// their limits and failover applied
+func FromConfig(cfg config.LLMConfig) (*Registry, error) {
+	registry := NewRegistry()
+
+	limited := make(map[string]Provider, len(cfg.Providers))
+	mocks := make(map[string]*Mock)
+	for name, pc := range cfg.Providers {
+		p, err := newProvider(name, pc)
+		if err != nil {
+			return nil, fmt.Errorf("provider %q: %w", name, err)
+		}
+		if mock, ok := p.(*Mock); ok {
+			mocks[name] = mock
+		}
+		// Wrapped even without limits, so a 429 holds back every caller
+		limited[name] = NewLimited(p, Limits{
+			RequestsPerMinute: pc.RequestsPerMinute,
+			TokensPerMinute:   pc.TokensPerMinute,
+			MaxConcurrent:     pc.MaxConcurrent,
+		})
+	}
+
+	for name, mock := range mocks {
+		record := cfg.Providers[name].Record
+		if record == "" {
+			continue
+		}
+		upstream, ok := limited[record]
+		if !ok || record == name {
+			return nil, fmt.Errorf("provider %q: invalid provider to record %q", name, record)
+		}
+		mock.Record(upstream)
+	}
+
+	// Fallbacks go straight to the other provider, so failover never chains
+	for name, pc := range cfg.Providers {
+		var p Provider = limited[name]
+		if fb := pc.Fallback; fb != nil && fb.Provider != "" {
+			secondary, ok := limited[fb.Provider]
+			if !ok || fb.Provider == name {
+				return nil, fmt.Errorf("provider %q: invalid fallback provider %q", name, fb.Provider)
+			}
+			p = NewFailover(p, secondary, fb.Model)
+		}
+		registry.Register(p)
+	}
+
+	for _, pc := range cfg.Prices {
+		registry.prices = append(registry.prices, Price{
+			Provider:   pc.Provider,
+			Model:      pc.Model,
+			Prompt:     pc.Prompt,
+			Completion: pc.Completion,
+		})
+	}
+
+	if cfg.DefaultProvider != "" {
+		if err := registry.SetDefault(cfg.DefaultProvider); err != nil {
+			return nil, err
+		}
+	} else if names := registry.Names(); len(names) > 0 {
+		// Map order is random; pick a stable default
+		registry.SetDefault(names[0])
+	}
+
+	if cfg.OverrideProvider != "" {
+		if err := registry.SetOverride(cfg.OverrideProvider); err != nil {
+			return nil, err
+		}
+	}
+
+	return registry, nil
+}
+
+func newProvider(name string, pc config.ProviderConfig) (Provider, error) {
+	timeout := time.Duration(pc.Timeout) * time.Second
+
+	switch pc.Type {
+	case TypeOllama:
+		return NewOllama(name, pc.BaseURL, timeout), nil
+	case TypeAnthropic:
+		return NewAnthropic(name, pc.BaseURL, pc.APIKey, timeout), nil
+	case TypeMock:
+		return NewMock(name, pc.Fixture, time.Duration(pc.Latency)*time.Millisecond)
+	default:
+		return nil, fmt.Errorf("unknown provider type %q", pc.Type)
+	}
+}
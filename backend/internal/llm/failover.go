@@ -0,0 +1,107 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+// Failover sends requests to a secondary provider when the primary fails in
+// a way that another provider may not: rate limits, 5xx responses and
+// network errors. While a Limited primary waits out a 429, requests go
+// straight to the secondary. Model, when set, replaces the model of requests
+// sent to the secondary. A streamed reply only fails over if no text has
+// been passed on yet.
+type Failover struct {
+	primary   Provider
+	secondary Provider
+	model     string
+}
+
+// NewFailover wraps primary so that it falls back to secondary
+func NewFailover(primary, secondary Provider, model string) *Failover {
+	return &Failover{primary: primary, secondary: secondary, model: model}
+}
+
+// Name returns the name of the primary provider
+func (f *Failover) Name() string {
+	return f.primary.Name()
+}
+
+// Chat asks the primary provider, then the secondary if the primary fails
+func (f *Failover) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	if f.primaryPaused() {
+		return f.fallback(f.secondary.Chat(ctx, f.request(req)))
+	}
+	resp, err := f.primary.Chat(ctx, req)
+	if err == nil || !failsOver(ctx, err) {
+		return resp, err
+	}
+	return f.fallback(f.secondary.Chat(ctx, f.request(req)))
+}
+
+// ChatStream streams from the primary provider, then from the secondary if
+// the primary fails before producing any text
+func (f *Failover) ChatStream(ctx context.Context, req *ChatRequest, onText func(text string) error) (*ChatResponse, error) {
+	if f.primaryPaused() {
+		return f.fallback(f.secondary.ChatStream(ctx, f.request(req), onText))
+	}
+	started := false
+	resp, err := f.primary.ChatStream(ctx, req, func(text string) error {
+		started = true
+		return onText(text)
+	})
+	if err == nil || started || !failsOver(ctx, err) {
+		return resp, err
+	}
+	return f.fallback(f.secondary.ChatStream(ctx, f.request(req), onText))
+}
+
+// Models lists the primary provider's models
+func (f *Failover) Models(ctx context.Context) ([]Model, error) {
+	return f.primary.Models(ctx)
+}
+
+// Unwrap returns the primary provider
+func (f *Failover) Unwrap() Provider {
+	return f.primary
+}
+
+func (f *Failover) primaryPaused() bool {
+	limited, ok := f.primary.(*Limited)
+	return ok && limited.Paused()
+}
+
+func (f *Failover) request(req *ChatRequest) *ChatRequest {
+	if f.model == "" {
+		return req
+	}
+	copied := *req
+	copied.Model = f.model
+	return &copied
+}
+
+// fallback marks a reply as served by the secondary provider
+func (f *Failover) fallback(resp *ChatResponse, err error) (*ChatResponse, error) {
+	if resp != nil {
+		resp.Provider = f.secondary.Name()
+		if resp.Model == "" && f.model != "" {
+			resp.Model = f.model
+		}
+	}
+	return resp, err
+}
+
+// failsOver reports whether an error from the primary provider is worth
+// trying the secondary for
+func failsOver(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var status *StatusError
+	if errors.As(err, &status) {
+		return status.RateLimited() || status.Temporary()
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,146 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StatusError is returned when a provider answers with a non-2xx status
+type StatusError struct {
+	Provider   string
+	StatusCode int
+	Message    string
+	RetryAfter time.Duration // From the Retry-After header, if the provider sent one
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s returned status %d: %s", e.Provider, e.StatusCode, e.Message)
+}
+
+// RateLimited reports whether the provider asked us to slow down
+func (e *StatusError) RateLimited() bool {
+	return e.StatusCode == http.StatusTooManyRequests
+}
+
+// Temporary reports whether the request may succeed if tried again
+func (e *StatusError) Temporary() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusRequestTimeout
+}
+
+// httpClient sends JSON requests to a provider's API
+type httpClient struct {
+	provider string
+	baseURL  string
+	headers  map[string]string
+	client   *http.Client
+}
+
+func newHTTPClient(provider, baseURL string, timeout time.Duration) *httpClient {
+	return &httpClient{
+		provider: provider,
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		headers:  make(map[string]string),
+		client:   &http.Client{Timeout: timeout},
+	}
+}
+
+// do sends a request and returns the response for the caller to read and
+// close. Non-2xx responses are turned into a *StatusError, using extract to
+// pull the provider's message out of the error body.
+func (h *httpClient) do(ctx context.Context, method, path string, body interface{}, extract func([]byte) string) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, h.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for key, value := range h.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		message := extract(raw)
+		if message == "" {
+			message = strings.TrimSpace(string(raw))
+		}
+		return nil, &StatusError{
+			Provider:   h.provider,
+			StatusCode: resp.StatusCode,
+			Message:    message,
+			RetryAfter: retryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+
+	return resp, nil
+}
+
+// doJSON sends a request and decodes the JSON response into out
+func (h *httpClient) doJSON(ctx context.Context, method, path string, body, out interface{}, extract func([]byte) string) error {
+	resp, err := h.do(ctx, method, path, body, extract)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("%s: invalid response: %w", h.provider, err)
+	}
+	return nil
+}
+
+// readLines calls fn with every non-empty line of a streamed response
+func readLines(r io.Reader, fn func(line []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 4<<20)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date
+func retryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if secs, err := strconv.ParseFloat(header, 64); err == nil && secs > 0 {
+		return time.Duration(secs * float64(time.Second))
+	}
+	if at, err := http.ParseTime(header); err == nil {
+		if wait := time.Until(at); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
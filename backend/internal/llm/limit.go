@@ -0,0 +1,258 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// DefaultRateLimitPause is how long a provider is left alone after it
+// answers 429 without saying when to come back
+const DefaultRateLimitPause = time.Second
+
+// Limits bound how hard a provider is used. Zero fields mean no limit.
+type Limits struct {
+	RequestsPerMinute int
+	TokensPerMinute   int // Prompt and completion tokens together
+	MaxConcurrent     int // Requests in flight at once
+}
+
+// Limited enforces Limits on a provider for everyone using it. Requests and
+// tokens are drawn from token buckets refilled every minute. Tokens are
+// estimated before a request is sent and corrected once the reply reports
+// what was used. When the provider answers 429, every caller waits until the
+// time given by Retry-After has passed.
+type Limited struct {
+	inner  Provider
+	limits Limits
+	slots  chan struct{} // Nil when concurrency is not capped
+
+	mu       sync.Mutex
+	requests *bucket
+	tokens   *bucket
+	paused   time.Time // Set by a 429; no requests are sent before then
+}
+
+// NewLimited wraps a provider with limits
+func NewLimited(inner Provider, limits Limits) *Limited {
+	l := &Limited{inner: inner, limits: limits}
+	if limits.MaxConcurrent > 0 {
+		l.slots = make(chan struct{}, limits.MaxConcurrent)
+	}
+	if limits.RequestsPerMinute > 0 {
+		l.requests = newBucket(limits.RequestsPerMinute)
+	}
+	if limits.TokensPerMinute > 0 {
+		l.tokens = newBucket(limits.TokensPerMinute)
+	}
+	return l
+}
+
+// Name returns the name of the wrapped provider
+func (l *Limited) Name() string {
+	return l.inner.Name()
+}
+
+// Chat sends a request once the limits allow it
+func (l *Limited) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	estimate := l.estimate(req)
+	if err := l.acquire(ctx, estimate); err != nil {
+		return nil, err
+	}
+	defer l.release()
+
+	resp, err := l.inner.Chat(ctx, req)
+	l.settle(estimate, resp, err)
+	return resp, err
+}
+
+// ChatStream sends a streaming request once the limits allow it. The request
+// holds its concurrency slot until the stream ends.
+func (l *Limited) ChatStream(ctx context.Context, req *ChatRequest, onText func(text string) error) (*ChatResponse, error) {
+	estimate := l.estimate(req)
+	if err := l.acquire(ctx, estimate); err != nil {
+		return nil, err
+	}
+	defer l.release()
+
+	resp, err := l.inner.ChatStream(ctx, req, onText)
+	l.settle(estimate, resp, err)
+	return resp, err
+}
+
+// Models lists the wrapped provider's models. Listing is not limited.
+func (l *Limited) Models(ctx context.Context) ([]Model, error) {
+	return l.inner.Models(ctx)
+}
+
+// Unwrap returns the wrapped provider
+func (l *Limited) Unwrap() Provider {
+	return l.inner
+}
+
+// Paused reports whether the provider is waiting out a 429
+func (l *Limited) Paused() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return time.Now().Before(l.paused)
+}
+
+// estimate guesses the tokens a request will use
+func (l *Limited) estimate(req *ChatRequest) int {
+	completion := req.MaxTokens
+	if completion <= 0 {
+		completion = EstimatedCompletionTokens
+	}
+	return EstimateTokens(req) + completion
+}
+
+// acquire waits until a request of the given tokens may be sent and a
+// concurrency slot is free
+func (l *Limited) acquire(ctx context.Context, tokens int) error {
+	for {
+		wait := l.take(tokens)
+		if wait <= 0 {
+			break
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			l.refund(tokens)
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// take draws a request and its tokens from the buckets, or returns how long
+// to wait before trying again. Nothing is drawn unless both buckets hold
+// enough.
+func (l *Limited) take(tokens int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(l.paused) {
+		return l.paused.Sub(now)
+	}
+
+	var wait time.Duration
+	if l.requests != nil {
+		wait = l.requests.wait(1, now)
+	}
+	if l.tokens != nil {
+		// A request larger than the whole bucket waits for a full bucket
+		wait = max(wait, l.tokens.wait(math.Min(float64(tokens), l.tokens.capacity), now))
+	}
+	if wait > 0 {
+		return wait
+	}
+
+	if l.requests != nil {
+		l.requests.level--
+	}
+	if l.tokens != nil {
+		l.tokens.level -= float64(tokens)
+	}
+	return 0
+}
+
+func (l *Limited) release() {
+	if l.slots != nil {
+		<-l.slots
+	}
+}
+
+func (l *Limited) refund(tokens int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.requests != nil {
+		l.requests.level = math.Min(l.requests.level+1, l.requests.capacity)
+	}
+	if l.tokens != nil {
+		l.tokens.level = math.Min(l.tokens.level+float64(tokens), l.tokens.capacity)
+	}
+}
+
+// settle corrects the token bucket by what a request actually used and
+// pauses the provider when it asked us to slow down
+func (l *Limited) settle(estimate int, resp *ChatResponse, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.tokens != nil && resp != nil {
+		used := resp.Usage.PromptTokens + resp.Usage.CompletionTokens
+		l.tokens.level = math.Min(l.tokens.level+float64(estimate-used), l.tokens.capacity)
+	}
+
+	var status *StatusError
+	if errors.As(err, &status) && status.RateLimited() {
+		pause := status.RetryAfter
+		if pause <= 0 {
+			pause = DefaultRateLimitPause
+		}
+		if until := time.Now().Add(pause); until.After(l.paused) {
+			l.paused = until
+		}
+	}
+}
+
+// bucket is a token bucket holding up to a minute's allowance
+type bucket struct {
+	capacity float64
+	level    float64 // May go negative when a request used more than estimated
+	rate     float64 // Refill per second
+	last     time.Time
+}
+
+func newBucket(perMinute int) *bucket {
+	return &bucket{
+		capacity: float64(perMinute),
+		level:    float64(perMinute),
+		rate:     float64(perMinute) / 60,
+		last:     time.Now(),
+	}
+}
+
+// wait refills the bucket and returns how long until it holds n
+func (b *bucket) wait(n float64, now time.Time) time.Duration {
+	b.level = math.Min(b.level+now.Sub(b.last).Seconds()*b.rate, b.capacity)
+	b.last = now
+	if b.level >= n {
+		return 0
+	}
+	return time.Duration((n - b.level) / b.rate * float64(time.Second))
+}
+
+// limitedEmbedder computes embeddings within a provider's limits
+type limitedEmbedder struct {
+	limited *Limited
+	inner   Embedder
+}
+
+func (e *limitedEmbedder) Embed(ctx context.Context, model string, input []string) ([][]float64, error) {
+	size := 0
+	for _, text := range input {
+		size += len(text)
+	}
+	if err := e.limited.acquire(ctx, size/4+1); err != nil {
+		return nil, err
+	}
+	defer e.limited.release()
+
+	embeddings, err := e.inner.Embed(ctx, model, input)
+	e.limited.settle(0, nil, err)
+	return embeddings, err
+}
@@ -0,0 +1,55 @@
+package llm
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimitedTake(t *testing.T) {
+	tests := []struct {
+		name     string
+		limits   Limits
+		requests float64 // Left in the request bucket, when limited
+		tokens   float64 // Left in the token bucket, when limited
+		paused   time.Duration
+		take     int
+		wait     time.Duration // Roughly; zero means the request may go
+	}{
+		{"no limits", Limits{}, 0, 0, 0, 1000, 0},
+		{"both buckets hold enough", Limits{RequestsPerMinute: 60, TokensPerMinute: 600}, 1, 100, 0, 100, 0},
+		{"out of requests", Limits{RequestsPerMinute: 60, TokensPerMinute: 600}, 0, 600, 0, 100, time.Second},
+		{"out of tokens", Limits{RequestsPerMinute: 60, TokensPerMinute: 600}, 60, 50, 0, 100, 5 * time.Second},
+		{"larger than the token bucket", Limits{TokensPerMinute: 600}, 0, 300, 0, 1000, 30 * time.Second},
+		{"paused by a 429", Limits{RequestsPerMinute: 60}, 60, 0, 2 * time.Second, 1, 2 * time.Second},
+	}
+	for _, tt := range tests {
+		l := NewLimited(nil, tt.limits)
+		if l.requests != nil {
+			l.requests.level = tt.requests
+		}
+		if l.tokens != nil {
+			l.tokens.level = tt.tokens
+		}
+		if tt.paused > 0 {
+			l.paused = time.Now().Add(tt.paused)
+		}
+
+		wait := l.take(tt.take)
+		if tt.wait == 0 && wait != 0 || tt.wait != 0 && (wait <= tt.wait-100*time.Millisecond || wait > tt.wait) {
+			t.Errorf("%s: take(%d) = %s, want %s", tt.name, tt.take, wait, tt.wait)
+			continue
+		}
+
+		// Nothing is drawn unless the request may go
+		drawn := 0.0
+		if wait == 0 {
+			drawn = 1
+		}
+		if l.requests != nil && l.requests.level > tt.requests-drawn+0.1 {
+			t.Errorf("%s: %v requests left, want %v", tt.name, l.requests.level, tt.requests-drawn)
+		}
+		if l.tokens != nil && l.tokens.level > tt.tokens-drawn*float64(tt.take)+0.1 {
+			t.Errorf("%s: %v tokens left, want %v", tt.name, l.tokens.level, tt.tokens-drawn*float64(tt.take))
+		}
+	}
+}
@@ -0,0 +1,295 @@
+// Package llm talks to large language model providers. Every provider
+// implements Provider; optional capabilities such as embeddings are
+// separate interfaces a provider may also implement.
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Message roles
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleTool      = "tool" // Result of a tool call, answering ToolCallID
+)
+
+// Message is one turn of a chat. Assistant messages may ask for tools to be
+// called; the results come back as tool messages.
+type Message struct {
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+}
+
+// Tool is a function the model may call. Parameters is a JSON Schema
+// describing the arguments object.
+type Tool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Parameters  map[string]interface{} `json:"parameters"`
+}
+
+// ToolCall is a model's request to call a tool
+type ToolCall struct {
+	ID        string                 `json:"id"`
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments"`
+}
+
+// ChatRequest asks a model to continue a chat. Schema asks for a reply that
+// is a JSON value conforming to it; providers able to constrain their output
+// enforce it, others rely on the prompt saying so.
+type ChatRequest struct {
+	Model       string                 `json:"model"`
+	Messages    []Message              `json:"messages"`
+	Tools       []Tool                 `json:"tools,omitempty"`
+	Schema      map[string]interface{} `json:"schema,omitempty"`
+	Temperature *float64               `json:"temperature,omitempty"`
+	MaxTokens   int                    `json:"max_tokens,omitempty"`
+	Stop        []string               `json:"stop,omitempty"`
+}
+
+// Usage counts the tokens a request consumed
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+// ChatResponse is a model's reply. Provider is set when the reply came from
+// a provider other than the one asked, after failover.
+type ChatResponse struct {
+	Provider     string  `json:"provider,omitempty"`
+	Model        string  `json:"model"`
+	Message      Message `json:"message"`
+	FinishReason string  `json:"finish_reason,omitempty"`
+	Usage        Usage   `json:"usage"`
+}
+
+// EstimatedCompletionTokens is the reply length assumed for a request that
+// sets no max_tokens
+const EstimatedCompletionTokens = 1024
+
+// EstimateTokens guesses the prompt tokens of a request at four bytes a token
+func EstimateTokens(req *ChatRequest) int {
+	size := 0
+	for _, m := range req.Messages {
+		size += len(m.Content)
+		for _, call := range m.ToolCalls {
+			encoded, _ := json.Marshal(call.Arguments)
+			size += len(call.Name) + len(encoded)
+		}
+	}
+	for _, tool := range req.Tools {
+		encoded, _ := json.Marshal(tool.Parameters)
+		size += len(tool.Name) + len(tool.Description) + len(encoded)
+	}
+	return size/4 + 1
+}
+
+// Model describes a model a provider can serve
+type Model struct {
+	Provider      string     `json:"provider"`
+	Name          string     `json:"name"`
+	DisplayName   string     `json:"display_name,omitempty"`
+	Family        string     `json:"family,omitempty"`
+	ParameterSize string     `json:"parameter_size,omitempty"`
+	Quantization  string     `json:"quantization,omitempty"`
+	Size          int64      `json:"size,omitempty"` // Bytes on disk, for local models
+	ModifiedAt    *time.Time `json:"modified_at,omitempty"`
+}
+
+// Provider is a source of chat completions
+type Provider interface {
+	// Name is the name the provider is configured under
+	Name() string
+	// Chat returns the model's complete reply
+	Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error)
+	// ChatStream calls onText with each piece of the reply as it is
+	// generated and returns the complete reply. An error from onText
+	// aborts the request.
+	ChatStream(ctx context.Context, req *ChatRequest, onText func(text string) error) (*ChatResponse, error)
+	// Models lists the models the provider can serve
+	Models(ctx context.Context) ([]Model, error)
+}
+
+// Generator is implemented by providers with a raw completion endpoint
+type Generator interface {
+	Generate(ctx context.Context, req *GenerateRequest) (*GenerateResponse, error)
+}
+
+// GenerateRequest asks a model to complete a prompt without chat formatting
+type GenerateRequest struct {
+	Model       string   `json:"model"`
+	Prompt      string   `json:"prompt"`
+	System      string   `json:"system,omitempty"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	MaxTokens   int      `json:"max_tokens,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+}
+
+// GenerateResponse is the completion of a prompt
+type GenerateResponse struct {
+	Model string `json:"model"`
+	Text  string `json:"text"`
+	Usage Usage  `json:"usage"`
+}
+
+// Embedder is implemented by providers that compute embeddings
+type Embedder interface {
+	Embed(ctx context.Context, model string, input []string) ([][]float64, error)
+}
+
+// Unwrapper is implemented by providers that add behaviour, such as limits
+// or failover, to another provider
+type Unwrapper interface {
+	Unwrap() Provider
+}
+
+// AsEmbedder returns a provider's embeddings capability, looking through
+// wrappers. Embeddings requests still count against the limits of a
+// Limited provider.
+func AsEmbedder(p Provider) (Embedder, bool) {
+	if l, ok := p.(*Limited); ok {
+		inner, ok := AsEmbedder(l.inner)
+		if !ok {
+			return nil, false
+		}
+		return &limitedEmbedder{limited: l, inner: inner}, true
+	}
+	if e, ok := p.(Embedder); ok {
+		return e, true
+	}
+	if w, ok := p.(Unwrapper); ok {
+		return AsEmbedder(w.Unwrap())
+	}
+	return nil, false
+}
+
+// ErrUnknownProvider is returned when no provider is configured under a name
+var ErrUnknownProvider = fmt.Errorf("unknown provider")
+
+// Registry holds the configured providers by name, and the prices of their
+// models
+type Registry struct {
+	providers    map[string]Provider
+	defaultName  string
+	overrideName string
+	prices       PriceTable
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{providers: make(map[string]Provider)}
+}
+
+// Register adds a provider under its name. The first provider registered
+// is the default until SetDefault is called.
+func (r *Registry) Register(p Provider) {
+	r.providers[p.Name()] = p
+	if r.defaultName == "" {
+		r.defaultName = p.Name()
+	}
+}
+
+// SetDefault selects the provider used when a node does not name one
+func (r *Registry) SetDefault(name string) error {
+	if _, ok := r.providers[name]; !ok {
+		return fmt.Errorf("%w %q", ErrUnknownProvider, name)
+	}
+	r.defaultName = name
+	return nil
+}
+
+// SetOverride makes one provider serve every request, whatever provider a
+// node names, such as a mock provider for a demo. An empty name removes the
+// override.
+func (r *Registry) SetOverride(name string) error {
+	if _, ok := r.providers[name]; name != "" && !ok {
+		return fmt.Errorf("%w %q", ErrUnknownProvider, name)
+	}
+	r.overrideName = name
+	return nil
+}
+
+// Get returns the provider configured under name, or the default provider
+// when name is empty. Under an override, it returns the override provider.
+func (r *Registry) Get(name string) (Provider, error) {
+	if r.overrideName != "" {
+		name = r.overrideName
+	}
+	if name == "" {
+		name = r.defaultName
+	}
+	p, ok := r.providers[name]
+	if !ok {
+		if name == "" {
+			return nil, fmt.Errorf("no LLM providers are configured")
+		}
+		return nil, fmt.Errorf("%w %q", ErrUnknownProvider, name)
+	}
+	return p, nil
+}
+
+// SetPrices sets the price table used by Cost
+func (r *Registry) SetPrices(prices PriceTable) {
+	r.prices = prices
+}
+
+// Price returns the price of a provider's model, reporting false when the
+// price table has no entry for it
+func (r *Registry) Price(provider, model string) (Price, bool) {
+	return r.prices.Lookup(provider, model)
+}
+
+// Names returns the names of the registered providers in order
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Models lists the models of every provider, querying them concurrently.
+// Providers that cannot be reached are reported in the error map by name
+// and leave the rest of the listing intact.
+func (r *Registry) Models(ctx context.Context) ([]Model, map[string]error) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	models := []Model{}
+	failures := make(map[string]error)
+
+	for name, p := range r.providers {
+		wg.Add(1)
+		go func(name string, p Provider) {
+			defer wg.Done()
+			found, err := p.Models(ctx)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failures[name] = err
+				return
+			}
+			models = append(models, found...)
+		}(name, p)
+	}
+	wg.Wait()
+
+	sort.Slice(models, func(i, j int) bool {
+		if models[i].Provider != models[j].Provider {
+			return models[i].Provider < models[j].Provider
+		}
+		return models[i].Name < models[j].Name
+	})
+	return models, failures
+}
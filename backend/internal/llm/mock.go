@@ -0,0 +1,428 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MockEmbeddingSize is the length of the vectors the mock provider returns
+const MockEmbeddingSize = 64
+
+// MockResponse is a scripted reply. It answers requests whose last user
+// message contains Match and matches Regex; both are optional, so a
+// response with neither answers anything. Times limits how often it is
+// used, which lets a script fail once and then succeed.
+type MockResponse struct {
+	Match     string     `json:"match,omitempty"`
+	Regex     string     `json:"regex,omitempty"`
+	Model     string     `json:"model,omitempty"` // Only answer requests for this model
+	Times     int        `json:"times,omitempty"` // Zero means unlimited
+	Reply     string     `json:"reply,omitempty"`
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	Chunks    []string   `json:"chunks,omitempty"` // How the reply is streamed; defaults to word by word
+	Usage     *Usage     `json:"usage,omitempty"`  // Defaults to an estimate
+	Error     *MockError `json:"error,omitempty"`  // Fail instead of replying
+	LatencyMS int        `json:"latency_ms,omitempty"`
+	ChunkMS   int        `json:"chunk_ms,omitempty"` // Delay between streamed chunks
+
+	pattern *regexp.Regexp
+	used    int
+}
+
+// MockError is a scripted failure. A zero status fails without a response,
+// like a dropped connection.
+type MockError struct {
+	Status     int     `json:"status,omitempty"`
+	Message    string  `json:"message"`
+	RetryAfter float64 `json:"retry_after,omitempty"` // Seconds
+}
+
+// Recording is a real provider's reply to a request
+type Recording struct {
+	Key      string        `json:"key"`
+	Request  *ChatRequest  `json:"request"`
+	Response *ChatResponse `json:"response"`
+}
+
+// Fixture is the file a mock provider reads its script from and records to
+type Fixture struct {
+	Responses  []*MockResponse `json:"responses,omitempty"`
+	Recordings []*Recording    `json:"recordings,omitempty"`
+}
+
+// Mock is a deterministic provider for tests and demos. Requests are
+// answered from recordings of real traffic when one matches the request
+// exactly, and otherwise from the first scripted response that matches.
+// With an upstream provider set, every request is sent upstream instead and
+// the reply is recorded to the fixture file for later replay.
+type Mock struct {
+	name     string
+	path     string
+	latency  time.Duration
+	upstream Provider
+
+	mu         sync.Mutex
+	fixture    *Fixture
+	recordings map[string]*Recording
+}
+
+// NewMock creates a mock provider scripted by the fixture file at path,
+// which may be YAML or JSON. A missing file is an empty script, so a new
+// fixture can be recorded.
+func NewMock(name, path string, latency time.Duration) (*Mock, error) {
+	fixture := &Fixture{}
+	if path != "" {
+		loaded, err := LoadFixture(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if err == nil {
+			fixture = loaded
+		}
+	}
+	return NewMockFromFixture(name, fixture, path, latency)
+}
+
+// NewMockFromFixture creates a mock provider from a fixture already in
+// memory. Recordings are saved to path, if one is given.
+func NewMockFromFixture(name string, fixture *Fixture, path string, latency time.Duration) (*Mock, error) {
+	m := &Mock{
+		name:       name,
+		path:       path,
+		latency:    latency,
+		fixture:    fixture,
+		recordings: make(map[string]*Recording),
+	}
+	for i, resp := range fixture.Responses {
+		if resp.Regex == "" {
+			continue
+		}
+		pattern, err := regexp.Compile(resp.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("%s: response %d: invalid regex: %w", name, i, err)
+		}
+		resp.pattern = pattern
+	}
+	for _, rec := range fixture.Recordings {
+		m.recordings[rec.Key] = rec
+	}
+	return m, nil
+}
+
+// LoadFixture reads a fixture file. JSON is read as YAML, of which it is a
+// subset.
+func LoadFixture(path string) (*Fixture, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decode generically first so the JSON field names apply to YAML too
+	var generic interface{}
+	if err := yaml.Unmarshal(raw, &generic); err != nil {
+		return nil, fmt.Errorf("invalid fixture %s: %w", path, err)
+	}
+	encoded, err := json.Marshal(generic)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fixture %s: %w", path, err)
+	}
+	fixture := &Fixture{}
+	if err := json.Unmarshal(encoded, fixture); err != nil {
+		return nil, fmt.Errorf("invalid fixture %s: %w", path, err)
+	}
+	return fixture, nil
+}
+
+// Record sends every request to upstream and saves the replies
+func (m *Mock) Record(upstream Provider) {
+	m.upstream = upstream
+}
+
+// Name returns the name the provider is configured under
+func (m *Mock) Name() string {
+	return m.name
+}
+
+// Chat answers a request from the fixture, or records upstream's answer
+func (m *Mock) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	return m.ChatStream(ctx, req, nil)
+}
+
+// ChatStream answers a request from the fixture, passing the reply to
+// onText in chunks, or records upstream's answer
+func (m *Mock) ChatStream(ctx context.Context, req *ChatRequest, onText func(text string) error) (*ChatResponse, error) {
+	key, err := RequestKey(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.upstream != nil {
+		return m.record(ctx, key, req, onText)
+	}
+
+	m.mu.Lock()
+	rec := m.recordings[key]
+	var script *MockResponse
+	if rec == nil {
+		script = m.match(req)
+	}
+	m.mu.Unlock()
+
+	switch {
+	case rec != nil:
+		script = &MockResponse{Reply: rec.Response.Message.Content, ToolCalls: rec.Response.Message.ToolCalls, Usage: &rec.Response.Usage}
+	case script == nil:
+		return nil, fmt.Errorf("%s: no scripted response matches %q", m.name, lastUserMessage(req))
+	}
+
+	if err := sleep(ctx, m.latency+time.Duration(script.LatencyMS)*time.Millisecond); err != nil {
+		return nil, err
+	}
+	if script.Error != nil {
+		return nil, m.scriptedError(script.Error)
+	}
+
+	if onText != nil {
+		for _, chunk := range script.chunks() {
+			if err := onText(chunk); err != nil {
+				return nil, err
+			}
+			if err := sleep(ctx, time.Duration(script.ChunkMS)*time.Millisecond); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	resp := &ChatResponse{
+		Model:        req.Model,
+		Message:      Message{Role: RoleAssistant, Content: script.Reply, ToolCalls: script.ToolCalls},
+		FinishReason: "stop",
+	}
+	if rec != nil {
+		resp.Model = rec.Response.Model
+		resp.FinishReason = rec.Response.FinishReason
+	}
+	if script.Usage != nil {
+		resp.Usage = *script.Usage
+	} else {
+		resp.Usage = Usage{PromptTokens: EstimateTokens(req), CompletionTokens: len(script.Reply)/4 + 1}
+	}
+	return resp, nil
+}
+
+// match returns the first scripted response that answers the request
+func (m *Mock) match(req *ChatRequest) *MockResponse {
+	text := lastUserMessage(req)
+	for _, resp := range m.fixture.Responses {
+		if resp.Times > 0 && resp.used >= resp.Times {
+			continue
+		}
+		if resp.Model != "" && resp.Model != req.Model {
+			continue
+		}
+		if !strings.Contains(text, resp.Match) {
+			continue
+		}
+		if resp.pattern != nil && !resp.pattern.MatchString(text) {
+			continue
+		}
+		resp.used++
+		return resp
+	}
+	return nil
+}
+
+// chunks splits the reply the way it is streamed
+func (r *MockResponse) chunks() []string {
+	if len(r.Chunks) > 0 {
+		return r.Chunks
+	}
+	var chunks []string
+	rest := r.Reply
+	for rest != "" {
+		// Each chunk is a word with the whitespace before it
+		i := strings.IndexFunc(strings.TrimLeft(rest, " \n\t"), func(c rune) bool { return c == ' ' || c == '\n' || c == '\t' })
+		if i < 0 {
+			chunks = append(chunks, rest)
+			break
+		}
+		i += len(rest) - len(strings.TrimLeft(rest, " \n\t"))
+		chunks = append(chunks, rest[:i])
+		rest = rest[i:]
+	}
+	return chunks
+}
+
+func (m *Mock) scriptedError(e *MockError) error {
+	if e.Status == 0 {
+		return fmt.Errorf("%s: %s", m.name, e.Message)
+	}
+	return &StatusError{
+		Provider:   m.name,
+		StatusCode: e.Status,
+		Message:    e.Message,
+		RetryAfter: time.Duration(e.RetryAfter * float64(time.Second)),
+	}
+}
+
+// record sends a request upstream and saves the reply to the fixture file
+func (m *Mock) record(ctx context.Context, key string, req *ChatRequest, onText func(text string) error) (*ChatResponse, error) {
+	var resp *ChatResponse
+	var err error
+	if onText == nil {
+		resp, err = m.upstream.Chat(ctx, req)
+	} else {
+		resp, err = m.upstream.ChatStream(ctx, req, onText)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rec := &Recording{Key: key, Request: req, Response: resp}
+	if _, seen := m.recordings[key]; !seen {
+		m.fixture.Recordings = append(m.fixture.Recordings, rec)
+	} else {
+		for i, existing := range m.fixture.Recordings {
+			if existing.Key == key {
+				m.fixture.Recordings[i] = rec
+			}
+		}
+	}
+	m.recordings[key] = rec
+
+	if m.path != "" {
+		if err := saveFixture(m.path, m.fixture); err != nil {
+			return nil, fmt.Errorf("%s: failed to save recording: %w", m.name, err)
+		}
+	}
+	return resp, nil
+}
+
+// saveFixture writes a fixture as JSON, or as YAML if the file name says so
+func saveFixture(path string, fixture *Fixture) error {
+	encoded, err := json.MarshalIndent(fixture, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".yaml" || ext == ".yml" {
+		var generic interface{}
+		if err := json.Unmarshal(encoded, &generic); err != nil {
+			return err
+		}
+		if encoded, err = yaml.Marshal(generic); err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, encoded, 0o644)
+}
+
+// Models lists the models named in the fixture, or a single "mock" model
+// when it names none
+func (m *Mock) Models(ctx context.Context) ([]Model, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := map[string]bool{}
+	for _, resp := range m.fixture.Responses {
+		if resp.Model != "" {
+			names[resp.Model] = true
+		}
+	}
+	for _, rec := range m.fixture.Recordings {
+		names[rec.Request.Model] = true
+	}
+	if len(names) == 0 {
+		names["mock"] = true
+	}
+
+	models := make([]Model, 0, len(names))
+	for name := range names {
+		models = append(models, Model{Provider: m.name, Name: name})
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].Name < models[j].Name })
+	return models, nil
+}
+
+// Embed returns deterministic embeddings: each word of a text adds to a
+// dimension picked by its hash, so texts sharing words are similar
+func (m *Mock) Embed(ctx context.Context, model string, input []string) ([][]float64, error) {
+	embeddings := make([][]float64, len(input))
+	for i, text := range input {
+		vector := make([]float64, MockEmbeddingSize)
+		for _, word := range strings.Fields(strings.ToLower(text)) {
+			h := fnv.New32a()
+			h.Write([]byte(strings.Trim(word, ".,;:!?\"'()")))
+			vector[h.Sum32()%MockEmbeddingSize]++
+		}
+		var norm float64
+		for _, v := range vector {
+			norm += v * v
+		}
+		if norm > 0 {
+			norm = math.Sqrt(norm)
+			for j := range vector {
+				vector[j] /= norm
+			}
+		}
+		embeddings[i] = vector
+	}
+	return embeddings, nil
+}
+
+// RequestKey identifies a request for replay: two requests have the same key
+// when everything sent to the model is the same
+func RequestKey(req *ChatRequest) (string, error) {
+	encoded, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func lastUserMessage(req *ChatRequest) string {
+	for i := len(req.Messages) - 1; i >= 0; i-- {
+		if req.Messages[i].Role == RoleUser {
+			return req.Messages[i].Content
+		}
+	}
+	return ""
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
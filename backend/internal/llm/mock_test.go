@@ -0,0 +1,106 @@
+package llm
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMockRecordReplay(t *testing.T) {
+	for _, name := range []string{"fixture.json", "fixture.yaml"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			req := &ChatRequest{
+				Model:    "claude-sonnet-4-20250514",
+				Messages: []Message{{Role: RoleUser, Content: "Weather in Paris?"}},
+				Tools:    []Tool{weatherTool},
+			}
+
+			recorder, err := NewMock("mock", path, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			recorder.Record(anthropicServer(t, http.StatusOK, nil, "tool_use.json", nil))
+			recorded, err := recorder.Chat(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fixture, err := LoadFixture(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(fixture.Recordings) != 1 {
+				t.Fatalf("recordings = %d, want 1", len(fixture.Recordings))
+			}
+			if key, _ := RequestKey(req); fixture.Recordings[0].Key != key {
+				t.Errorf("recording key = %q, want %q", fixture.Recordings[0].Key, key)
+			}
+
+			replayer, err := NewMockFromFixture("mock", fixture, "", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var streamed strings.Builder
+			replayed, err := replayer.ChatStream(context.Background(), req, func(text string) error {
+				streamed.WriteString(text)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(replayed, recorded) {
+				t.Errorf("replayed %+v, recorded %+v", replayed, recorded)
+			}
+			if streamed.String() != recorded.Message.Content {
+				t.Errorf("streamed %q, want %q", streamed.String(), recorded.Message.Content)
+			}
+
+			// Anything else sent to the model was not recorded
+			other := *req
+			other.Model = "claude-opus-4-20250514"
+			if _, err := replayer.Chat(context.Background(), &other); err == nil {
+				t.Error("an unrecorded request was answered")
+			}
+		})
+	}
+}
+
+func TestMockScript(t *testing.T) {
+	m, err := NewMockFromFixture("mock", &Fixture{Responses: []*MockResponse{
+		{Match: "Weather", Times: 1, Error: &MockError{Status: http.StatusTooManyRequests, Message: "slow down", RetryAfter: 2}},
+		{Regex: `(?i)weather in \w+`, Reply: "Sunny", Usage: &Usage{PromptTokens: 3, CompletionTokens: 1}},
+		{Model: "other", Reply: "Other model"},
+	}}, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &ChatRequest{Model: "mock", Messages: []Message{{Role: RoleUser, Content: "Weather in Paris?"}}}
+
+	_, err = m.Chat(context.Background(), req)
+	status, ok := err.(*StatusError)
+	if !ok || !status.RateLimited() || status.RetryAfter.Seconds() != 2 {
+		t.Fatalf("first call error = %v, want a rate limit", err)
+	}
+
+	resp, err := m.Chat(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Message.Content != "Sunny" || resp.Usage != (Usage{PromptTokens: 3, CompletionTokens: 1}) {
+		t.Errorf("second call = %+v", resp)
+	}
+
+	req.Messages[0].Content = "Hello"
+	if _, err := m.Chat(context.Background(), req); err == nil {
+		t.Error("a request no response matches was answered")
+	}
+	req.Model = "other"
+	if resp, err := m.Chat(context.Background(), req); err != nil || resp.Message.Content != "Other model" {
+		t.Errorf("model response = %+v, %v", resp, err)
+	}
+}
@@ -0,0 +1,290 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// DefaultOllamaURL is where a local Ollama server listens by default
+const DefaultOllamaURL = "http://localhost:11434"
+
+// Ollama talks to an Ollama server through its native API
+type Ollama struct {
+	name string
+	http *httpClient
+}
+
+// NewOllama creates a provider for the Ollama server at baseURL
+func NewOllama(name, baseURL string, timeout time.Duration) *Ollama {
+	if baseURL == "" {
+		baseURL = DefaultOllamaURL
+	}
+	return &Ollama{
+		name: name,
+		http: newHTTPClient(name, baseURL, timeout),
+	}
+}
+
+// Name returns the name the provider is configured under
+func (o *Ollama) Name() string {
+	return o.name
+}
+
+type ollamaOptions struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	NumPredict  int      `json:"num_predict,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+}
+
+type ollamaFunction struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Parameters  map[string]interface{} `json:"parameters,omitempty"`
+	Arguments   map[string]interface{} `json:"arguments,omitempty"`
+}
+
+type ollamaToolCall struct {
+	Function ollamaFunction `json:"function"`
+}
+
+type ollamaTool struct {
+	Type     string         `json:"type"`
+	Function ollamaFunction `json:"function"`
+}
+
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+}
+
+type ollamaChatRequest struct {
+	Model    string                 `json:"model"`
+	Messages []ollamaMessage        `json:"messages"`
+	Tools    []ollamaTool           `json:"tools,omitempty"`
+	Format   map[string]interface{} `json:"format,omitempty"` // JSON Schema the reply must follow
+	Stream   bool                   `json:"stream"`
+	Options  ollamaOptions          `json:"options"`
+}
+
+// ollamaChatResponse is a complete reply, or one piece of a streamed reply
+type ollamaChatResponse struct {
+	Model           string        `json:"model"`
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+	Error           string        `json:"error"`
+}
+
+func (o *Ollama) chatRequest(req *ChatRequest, stream bool) *ollamaChatRequest {
+	body := &ollamaChatRequest{
+		Model:  req.Model,
+		Stream: stream,
+		Format: req.Schema,
+		Options: ollamaOptions{
+			Temperature: req.Temperature,
+			NumPredict:  req.MaxTokens,
+			Stop:        req.Stop,
+		},
+	}
+
+	for _, m := range req.Messages {
+		message := ollamaMessage{Role: m.Role, Content: m.Content}
+		for _, call := range m.ToolCalls {
+			message.ToolCalls = append(message.ToolCalls, ollamaToolCall{
+				Function: ollamaFunction{Name: call.Name, Arguments: call.Arguments},
+			})
+		}
+		body.Messages = append(body.Messages, message)
+	}
+	for _, tool := range req.Tools {
+		body.Tools = append(body.Tools, ollamaTool{
+			Type:     "function",
+			Function: ollamaFunction{Name: tool.Name, Description: tool.Description, Parameters: tool.Parameters},
+		})
+	}
+
+	return body
+}
+
+// toolCalls converts the tool calls of a reply. Ollama does not number
+// calls, so IDs are assigned in order.
+func (o *Ollama) toolCalls(calls []ollamaToolCall, first int) []ToolCall {
+	var converted []ToolCall
+	for i, call := range calls {
+		converted = append(converted, ToolCall{
+			ID:        fmt.Sprintf("call_%d", first+i),
+			Name:      call.Function.Name,
+			Arguments: call.Function.Arguments,
+		})
+	}
+	return converted
+}
+
+// Chat sends a chat request to /api/chat
+func (o *Ollama) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	var resp ollamaChatResponse
+	if err := o.http.doJSON(ctx, http.MethodPost, "/api/chat", o.chatRequest(req, false), &resp, ollamaError); err != nil {
+		return nil, err
+	}
+
+	return &ChatResponse{
+		Model: resp.Model,
+		Message: Message{
+			Role:      RoleAssistant,
+			Content:   resp.Message.Content,
+			ToolCalls: o.toolCalls(resp.Message.ToolCalls, 0),
+		},
+		FinishReason: resp.DoneReason,
+		Usage:        Usage{PromptTokens: resp.PromptEvalCount, CompletionTokens: resp.EvalCount},
+	}, nil
+}
+
+// ChatStream sends a streaming chat request to /api/chat. Ollama streams
+// one JSON object per line; the last one carries the token counts.
+func (o *Ollama) ChatStream(ctx context.Context, req *ChatRequest, onText func(text string) error) (*ChatResponse, error) {
+	resp, err := o.http.do(ctx, http.MethodPost, "/api/chat", o.chatRequest(req, true), ollamaError)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := &ChatResponse{Model: req.Model, Message: Message{Role: RoleAssistant}}
+	err = readLines(resp.Body, func(line []byte) error {
+		var piece ollamaChatResponse
+		if err := json.Unmarshal(line, &piece); err != nil {
+			return fmt.Errorf("%s: invalid stream event: %w", o.name, err)
+		}
+		if piece.Error != "" {
+			return fmt.Errorf("%s: %s", o.name, piece.Error)
+		}
+
+		if len(piece.Message.ToolCalls) > 0 {
+			calls := o.toolCalls(piece.Message.ToolCalls, len(result.Message.ToolCalls))
+			result.Message.ToolCalls = append(result.Message.ToolCalls, calls...)
+		}
+		if piece.Message.Content != "" {
+			result.Message.Content += piece.Message.Content
+			if err := onText(piece.Message.Content); err != nil {
+				return err
+			}
+		}
+		if piece.Done {
+			result.Model = piece.Model
+			result.FinishReason = piece.DoneReason
+			result.Usage = Usage{PromptTokens: piece.PromptEvalCount, CompletionTokens: piece.EvalCount}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+type ollamaGenerateRequest struct {
+	Model   string        `json:"model"`
+	Prompt  string        `json:"prompt"`
+	System  string        `json:"system,omitempty"`
+	Stream  bool          `json:"stream"`
+	Options ollamaOptions `json:"options"`
+}
+
+type ollamaGenerateResponse struct {
+	Model           string `json:"model"`
+	Response        string `json:"response"`
+	PromptEvalCount int    `json:"prompt_eval_count"`
+	EvalCount       int    `json:"eval_count"`
+}
+
+// Generate completes a raw prompt through /api/generate
+func (o *Ollama) Generate(ctx context.Context, req *GenerateRequest) (*GenerateResponse, error) {
+	body := &ollamaGenerateRequest{
+		Model:  req.Model,
+		Prompt: req.Prompt,
+		System: req.System,
+		Options: ollamaOptions{
+			Temperature: req.Temperature,
+			NumPredict:  req.MaxTokens,
+			Stop:        req.Stop,
+		},
+	}
+
+	var resp ollamaGenerateResponse
+	if err := o.http.doJSON(ctx, http.MethodPost, "/api/generate", body, &resp, ollamaError); err != nil {
+		return nil, err
+	}
+
+	return &GenerateResponse{
+		Model: resp.Model,
+		Text:  resp.Response,
+		Usage: Usage{PromptTokens: resp.PromptEvalCount, CompletionTokens: resp.EvalCount},
+	}, nil
+}
+
+// Embed computes embeddings through /api/embed
+func (o *Ollama) Embed(ctx context.Context, model string, input []string) ([][]float64, error) {
+	body := map[string]interface{}{"model": model, "input": input}
+
+	var resp struct {
+		Embeddings [][]float64 `json:"embeddings"`
+	}
+	if err := o.http.doJSON(ctx, http.MethodPost, "/api/embed", body, &resp, ollamaError); err != nil {
+		return nil, err
+	}
+	if len(resp.Embeddings) != len(input) {
+		return nil, fmt.Errorf("%s: expected %d embeddings, got %d", o.name, len(input), len(resp.Embeddings))
+	}
+
+	return resp.Embeddings, nil
+}
+
+// Models lists the models pulled on the server through /api/tags
+func (o *Ollama) Models(ctx context.Context) ([]Model, error) {
+	var resp struct {
+		Models []struct {
+			Name       string    `json:"name"`
+			Size       int64     `json:"size"`
+			ModifiedAt time.Time `json:"modified_at"`
+			Details    struct {
+				Family            string `json:"family"`
+				ParameterSize     string `json:"parameter_size"`
+				QuantizationLevel string `json:"quantization_level"`
+			} `json:"details"`
+		} `json:"models"`
+	}
+	if err := o.http.doJSON(ctx, http.MethodGet, "/api/tags", nil, &resp, ollamaError); err != nil {
+		return nil, err
+	}
+
+	models := make([]Model, 0, len(resp.Models))
+	for _, m := range resp.Models {
+		modified := m.ModifiedAt
+		models = append(models, Model{
+			Provider:      o.name,
+			Name:          m.Name,
+			Family:        m.Details.Family,
+			ParameterSize: m.Details.ParameterSize,
+			Quantization:  m.Details.QuantizationLevel,
+			Size:          m.Size,
+			ModifiedAt:    &modified,
+		})
+	}
+
+	return models, nil
+}
+
+// ollamaError extracts the message of an Ollama error body
+func ollamaError(body []byte) string {
+	var resp struct {
+		Error string `json:"error"`
+	}
+	json.Unmarshal(body, &resp)
+	return resp.Error
+}
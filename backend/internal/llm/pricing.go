@@ -0,0 +1,54 @@
+package llm
+
+import "strings"
+
+// Price is what a model charges, in US dollars per million tokens. Model may
+// end in "*" to match every model with that prefix; an empty Provider
+// matches every provider.
+type Price struct {
+	Provider   string  `json:"provider,omitempty"`
+	Model      string  `json:"model"`
+	Prompt     float64 `json:"prompt"`
+	Completion float64 `json:"completion"`
+}
+
+// Cost returns the dollar cost of the tokens in usage
+func (p Price) Cost(usage Usage) float64 {
+	return (float64(usage.PromptTokens)*p.Prompt + float64(usage.CompletionTokens)*p.Completion) / 1e6
+}
+
+// PriceTable looks up the price of a model
+type PriceTable []Price
+
+// Lookup returns the most specific price for a model: an exact model name
+// beats a prefix, a longer prefix beats a shorter one, and naming the
+// provider beats leaving it empty
+func (t PriceTable) Lookup(provider, model string) (Price, bool) {
+	best, bestScore := Price{}, -1
+	for _, price := range t {
+		if price.Provider != "" && price.Provider != provider {
+			continue
+		}
+
+		var score int
+		if prefix, ok := strings.CutSuffix(price.Model, "*"); ok {
+			if !strings.HasPrefix(model, prefix) {
+				continue
+			}
+			score = 2 * len(prefix)
+		} else if price.Model == model {
+			score = 2*len(model) + 1
+		} else {
+			continue
+		}
+		score *= 2
+		if price.Provider != "" {
+			score++
+		}
+
+		if score > bestScore {
+			best, bestScore = price, score
+		}
+	}
+	return best, bestScore >= 0
+}
@@ -0,0 +1,197 @@
+package workspace
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// CloneOptions controls the ownership and naming of a cloned workspace
+type CloneOptions struct {
+	Name    string
+	OwnerID *uuid.UUID
+	OrgID   *uuid.UUID
+}
+
+// Clone deep-copies a workspace, giving the copy and every node and edge a
+// fresh ID. Edge sources and targets are remapped onto the new node IDs and
+// the copy records the original as its parent.
+func Clone(src *Workspace, opts CloneOptions) *Workspace {
+	parentID := src.ID
+	dst := &Workspace{
+		ID:       uuid.New(),
+		Name:     src.Name,
+		OwnerID:  src.OwnerID,
+		OrgID:    src.OrgID,
+		ParentID: &parentID,
+		Nodes:    make([]Node, 0, len(src.Nodes)),
+		Edges:    make([]Edge, 0, len(src.Edges)),
+	}
+	if len(src.Partials) > 0 {
+		dst.Partials = make(Partials, len(src.Partials))
+		for name, content := range src.Partials {
+			dst.Partials[name] = content
+		}
+	}
+	if opts.Name != "" {
+		dst.Name = opts.Name
+	}
+	if opts.OwnerID != nil {
+		dst.OwnerID = opts.OwnerID
+	}
+	if opts.OrgID != nil {
+		dst.OrgID = opts.OrgID
+	}
+
+	nodeIDs := make(map[uuid.UUID]uuid.UUID, len(src.Nodes))
+	for _, n := range src.Nodes {
+		newID := uuid.New()
+		nodeIDs[n.ID] = newID
+		dst.Nodes = append(dst.Nodes, Node{
+			ID:          newID,
+			WorkspaceID: dst.ID,
+			Type:        n.Type,
+			Label:       n.Label,
+			Data:        copyData(n.Data),
+			Position:    n.Position,
+		})
+	}
+
+	for _, e := range src.Edges {
+		source, okSource := nodeIDs[e.Source]
+		target, okTarget := nodeIDs[e.Target]
+		if !okSource || !okTarget {
+			// Dangling edges point at nodes that no longer exist; drop them
+			continue
+		}
+		dst.Edges = append(dst.Edges, Edge{
+			ID:           uuid.New(),
+			WorkspaceID:  dst.ID,
+			Source:       source,
+			Target:       target,
+			SourceHandle: e.SourceHandle,
+			TargetHandle: e.TargetHandle,
+		})
+	}
+
+	return dst
+}
+
+// copyData deep-copies a node's data map so the clone shares no state with the original
+func copyData(data map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		out[k] = copyValue(v)
+	}
+	return out
+}
+
+func copyValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		return copyData(val)
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = copyValue(item)
+		}
+		return out
+	default:
+		return val
+	}
+}
+
+// CloneWorkspace copies an existing workspace, including its nodes and edges, into a new workspace
+func (s *SupabaseService) CloneWorkspace(id uuid.UUID, opts CloneOptions) (*Workspace, error) {
+	src, err := s.GetWorkspace(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.SaveWorkspace(Clone(src, opts))
+}
+
+// SaveWorkspace inserts a fully built workspace together with its nodes and
+// edges. If the nodes or edges cannot be inserted, the workspace is removed again.
+func (s *SupabaseService) SaveWorkspace(ws *Workspace) (*Workspace, error) {
+	row := *ws
+	row.Nodes = []Node{}
+	row.Edges = []Edge{}
+
+	body, status, err := s.client.Request("POST", "workspaces", row)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusCreated {
+		log.Printf("Supabase returned status %d: %s", status, string(body))
+		return nil, fmt.Errorf("failed to create workspace: %s", string(body))
+	}
+
+	var insertedWorkspaces []Workspace
+	err = json.Unmarshal(body, &insertedWorkspaces)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(insertedWorkspaces) == 0 {
+		return nil, fmt.Errorf("no workspace was inserted")
+	}
+
+	saved := &insertedWorkspaces[0]
+	saved.Nodes = []Node{}
+	saved.Edges = []Edge{}
+
+	if err := s.insertGraph(ws, saved); err != nil {
+		// Don't leave a half-copied workspace behind; deleting the row
+		// cascades to the nodes already inserted
+		if cleanupErr := s.DeleteWorkspace(saved.ID); cleanupErr != nil {
+			log.Printf("Failed to remove partially saved workspace %s: %v", saved.ID, cleanupErr)
+		}
+		return nil, err
+	}
+
+	return saved, nil
+}
+
+// insertGraph inserts the nodes and edges of ws, recording the stored rows on saved
+func (s *SupabaseService) insertGraph(ws, saved *Workspace) error {
+	if len(ws.Nodes) > 0 {
+		body, status, err := s.client.Request("POST", "nodes", ws.Nodes)
+		if err != nil {
+			return err
+		}
+
+		if status != http.StatusCreated {
+			log.Printf("Supabase returned status %d: %s", status, string(body))
+			return fmt.Errorf("failed to insert nodes: %s", string(body))
+		}
+
+		err = json.Unmarshal(body, &saved.Nodes)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(ws.Edges) > 0 {
+		body, status, err := s.client.Request("POST", "edges", ws.Edges)
+		if err != nil {
+			return err
+		}
+
+		if status != http.StatusCreated {
+			log.Printf("Supabase returned status %d: %s", status, string(body))
+			return fmt.Errorf("failed to insert edges: %s", string(body))
+		}
+
+		err = json.Unmarshal(body, &saved.Edges)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
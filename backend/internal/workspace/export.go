@@ -0,0 +1,423 @@
+package workspace
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+)
+
+// ExportKind identifies a NodeLoom workspace export document
+const ExportKind = "nodeloom.workspace"
+
+// ExportSchemaVersion is the version of the export document written by this backend.
+// Documents with a newer version are rejected on import.
+const ExportSchemaVersion = 1
+
+// Supported export formats
+const (
+	ExportFormatJSON = "json"
+	ExportFormatYAML = "yaml"
+)
+
+var (
+	ErrUnsupportedFormat = fmt.Errorf("unsupported export format")
+	ErrInvalidDocument   = fmt.Errorf("invalid export document")
+)
+
+// ExportDocument is the portable, versioned representation of a workspace
+type ExportDocument struct {
+	Kind       string            `json:"kind" yaml:"kind"`
+	Version    int               `json:"version" yaml:"version"`
+	ExportedAt time.Time         `json:"exported_at" yaml:"exported_at"`
+	Workspace  ExportedWorkspace `json:"workspace" yaml:"workspace"`
+}
+
+type ExportedWorkspace struct {
+	ID       uuid.UUID      `json:"id" yaml:"id"`
+	Name     string         `json:"name" yaml:"name"`
+	Template *TemplateInfo  `json:"template,omitempty" yaml:"template,omitempty"`
+	Partials Partials       `json:"partials,omitempty" yaml:"partials,omitempty"`
+	Nodes    []ExportedNode `json:"nodes" yaml:"nodes"`
+	Edges    []ExportedEdge `json:"edges" yaml:"edges"`
+}
+
+type ExportedNode struct {
+	ID       uuid.UUID              `json:"id" yaml:"id"`
+	Type     NodeType               `json:"type" yaml:"type"`
+	Label    string                 `json:"label" yaml:"label"`
+	Data     map[string]interface{} `json:"data" yaml:"data"`
+	Position Position               `json:"position" yaml:"position"`
+}
+
+type ExportedEdge struct {
+	ID           uuid.UUID `json:"id" yaml:"id"`
+	Source       uuid.UUID `json:"source" yaml:"source"`
+	Target       uuid.UUID `json:"target" yaml:"target"`
+	SourceHandle string    `json:"source_handle,omitempty" yaml:"source_handle,omitempty"`
+	TargetHandle string    `json:"target_handle,omitempty" yaml:"target_handle,omitempty"`
+}
+
+// ImportResult describes the outcome of importing an export document
+type ImportResult struct {
+	Workspace      *Workspace      `json:"workspace"`
+	RegeneratedIDs []RegeneratedID `json:"regenerated_ids"`
+	Warnings       []string        `json:"warnings"`
+}
+
+// Reasons an imported ID was regenerated
+const (
+	IDMissing   = "missing"   // The document gave none
+	IDDuplicate = "duplicate" // Used by an earlier node or edge of the document
+	IDTaken     = "taken"     // Already present in the database
+)
+
+// RegeneratedID records an ID of the document that was replaced on import
+type RegeneratedID struct {
+	Kind   string    `json:"kind"`   // "workspace", "node" or "edge"
+	OldID  uuid.UUID `json:"old_id"` // Nil when the ID was missing
+	NewID  uuid.UUID `json:"new_id"`
+	Reason string    `json:"reason"`
+}
+
+// NewExportDocument builds a portable export document from a workspace
+func NewExportDocument(ws *Workspace) *ExportDocument {
+	doc := &ExportDocument{
+		Kind:       ExportKind,
+		Version:    ExportSchemaVersion,
+		ExportedAt: time.Now().UTC(),
+		Workspace: ExportedWorkspace{
+			ID:       ws.ID,
+			Name:     ws.Name,
+			Template: ws.Template,
+			Partials: ws.Partials,
+			Nodes:    make([]ExportedNode, 0, len(ws.Nodes)),
+			Edges:    make([]ExportedEdge, 0, len(ws.Edges)),
+		},
+	}
+
+	for _, n := range ws.Nodes {
+		doc.Workspace.Nodes = append(doc.Workspace.Nodes, ExportedNode{
+			ID:       n.ID,
+			Type:     n.Type,
+			Label:    n.Label,
+			Data:     n.Data,
+			Position: n.Position,
+		})
+	}
+
+	for _, e := range ws.Edges {
+		doc.Workspace.Edges = append(doc.Workspace.Edges, ExportedEdge{
+			ID:           e.ID,
+			Source:       e.Source,
+			Target:       e.Target,
+			SourceHandle: e.SourceHandle,
+			TargetHandle: e.TargetHandle,
+		})
+	}
+
+	return doc
+}
+
+// EncodeExportDocument serialises an export document in the given format
+func EncodeExportDocument(doc *ExportDocument, format string) ([]byte, error) {
+	switch format {
+	case ExportFormatJSON, "":
+		return json.MarshalIndent(doc, "", "  ")
+	case ExportFormatYAML:
+		return yaml.Marshal(doc)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+}
+
+// DecodeExportDocument parses an export document in the given format
+func DecodeExportDocument(data []byte, format string) (*ExportDocument, error) {
+	var doc ExportDocument
+	var err error
+
+	switch format {
+	case ExportFormatJSON, "":
+		err = json.Unmarshal(data, &doc)
+	case ExportFormatYAML:
+		if err = yaml.Unmarshal(data, &doc); err == nil {
+			err = normalizeYAML(&doc)
+		}
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDocument, err)
+	}
+
+	return &doc, nil
+}
+
+// normalizeYAML gives a YAML-decoded document the types a JSON one has. YAML
+// decodes whole numbers in node data and parameter defaults as int, while the
+// engine reads numbers as float64, as encoding/json produces them.
+func normalizeYAML(doc *ExportDocument) error {
+	encoded, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	normalized := ExportDocument{}
+	if err := json.Unmarshal(encoded, &normalized); err != nil {
+		return err
+	}
+	*doc = normalized
+	return nil
+}
+
+// Validate checks that the document is a workspace export this backend can read
+func (d *ExportDocument) Validate() error {
+	if d.Kind != ExportKind {
+		return fmt.Errorf("%w: expected kind %q, got %q", ErrInvalidDocument, ExportKind, d.Kind)
+	}
+
+	if d.Version < 1 || d.Version > ExportSchemaVersion {
+		return fmt.Errorf("%w: unsupported schema version %d (supported: 1-%d)", ErrInvalidDocument, d.Version, ExportSchemaVersion)
+	}
+
+	if strings.TrimSpace(d.Workspace.Name) == "" {
+		return fmt.Errorf("%w: workspace name is required", ErrInvalidDocument)
+	}
+
+	return nil
+}
+
+// toWorkspace converts the document into a workspace, collecting warnings
+// about anything that could not be imported as-is and the IDs it had to
+// regenerate. Edges keep pointing at the first node using a duplicate ID;
+// edges without a source or target go to the first node without an ID.
+func (d *ExportDocument) toWorkspace() (*Workspace, []RegeneratedID, []string) {
+	ws := &Workspace{
+		ID:         d.Workspace.ID,
+		Name:       d.Workspace.Name,
+		IsTemplate: d.Workspace.Template != nil,
+		Template:   d.Workspace.Template,
+		Partials:   d.Workspace.Partials,
+		Nodes:      make([]Node, 0, len(d.Workspace.Nodes)),
+		Edges:      make([]Edge, 0, len(d.Workspace.Edges)),
+	}
+	var regenerated []RegeneratedID
+	if ws.ID == uuid.Nil {
+		ws.ID = uuid.New()
+		regenerated = append(regenerated, RegeneratedID{Kind: "workspace", NewID: ws.ID, Reason: IDMissing})
+	}
+
+	warnings := []string{}
+
+	nodeIDs := make(map[uuid.UUID]bool, len(d.Workspace.Nodes))
+	missingNode := uuid.Nil
+	for _, n := range d.Workspace.Nodes {
+		if !n.Type.IsKnown() {
+			warnings = append(warnings, fmt.Sprintf("node %s has unknown type %q", n.ID, n.Type))
+		}
+
+		id := n.ID
+		if reason := regenerateReason(id, nodeIDs); reason != "" {
+			id = uuid.New()
+			regenerated = append(regenerated, RegeneratedID{Kind: "node", OldID: n.ID, NewID: id, Reason: reason})
+			warnings = append(warnings, fmt.Sprintf("node %q had a %s ID and was assigned %s", n.Label, reason, id))
+			if reason == IDMissing && missingNode == uuid.Nil {
+				missingNode = id
+			}
+		}
+		nodeIDs[id] = true
+
+		data := n.Data
+		if data == nil {
+			data = make(map[string]interface{})
+		}
+
+		ws.Nodes = append(ws.Nodes, Node{
+			ID:       id,
+			Type:     n.Type,
+			Label:    n.Label,
+			Data:     data,
+			Position: n.Position,
+		})
+	}
+
+	edgeIDs := make(map[uuid.UUID]bool, len(d.Workspace.Edges))
+	for _, e := range d.Workspace.Edges {
+		source, target := e.Source, e.Target
+		if source == uuid.Nil {
+			source = missingNode
+		}
+		if target == uuid.Nil {
+			target = missingNode
+		}
+		if !nodeIDs[source] || !nodeIDs[target] {
+			warnings = append(warnings, fmt.Sprintf("edge %s references a missing node and was dropped", e.ID))
+			continue
+		}
+
+		id := e.ID
+		if reason := regenerateReason(id, edgeIDs); reason != "" {
+			id = uuid.New()
+			regenerated = append(regenerated, RegeneratedID{Kind: "edge", OldID: e.ID, NewID: id, Reason: reason})
+			warnings = append(warnings, fmt.Sprintf("edge %s had a %s ID and was assigned %s", e.ID, reason, id))
+		}
+		edgeIDs[id] = true
+
+		ws.Edges = append(ws.Edges, Edge{
+			ID:           id,
+			Source:       source,
+			Target:       target,
+			SourceHandle: e.SourceHandle,
+			TargetHandle: e.TargetHandle,
+		})
+	}
+
+	return ws, regenerated, warnings
+}
+
+// regenerateReason tells why an ID of the document cannot be kept, or
+// returns "" if it can
+func regenerateReason(id uuid.UUID, used map[uuid.UUID]bool) string {
+	switch {
+	case id == uuid.Nil:
+		return IDMissing
+	case used[id]:
+		return IDDuplicate
+	}
+	return ""
+}
+
+// ImportWorkspace validates an export document and stores it as a new
+// workspace. IDs that are missing, duplicated or already in the database are
+// regenerated and listed in the result.
+func (s *SupabaseService) ImportWorkspace(doc *ExportDocument) (*ImportResult, error) {
+	if err := doc.Validate(); err != nil {
+		return nil, err
+	}
+
+	ws, regenerated, warnings := doc.toWorkspace()
+
+	regenerated, err := s.regenerateCollidingIDs(ws, regenerated)
+	if err != nil {
+		return nil, err
+	}
+
+	saved, err := s.SaveWorkspace(ws)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ImportResult{
+		Workspace:      saved,
+		RegeneratedIDs: regenerated,
+		Warnings:       warnings,
+	}, nil
+}
+
+// regenerateCollidingIDs assigns fresh IDs to the workspace, nodes and edges
+// whose IDs are already taken, appending each change to regenerated. Edges
+// are moved onto the new IDs of their nodes.
+func (s *SupabaseService) regenerateCollidingIDs(ws *Workspace, regenerated []RegeneratedID) ([]RegeneratedID, error) {
+	taken, err := s.existingIDs("workspaces", []uuid.UUID{ws.ID})
+	if err != nil {
+		return nil, err
+	}
+	if taken[ws.ID] {
+		newID := uuid.New()
+		regenerated = append(regenerated, RegeneratedID{Kind: "workspace", OldID: ws.ID, NewID: newID, Reason: IDTaken})
+		ws.ID = newID
+	}
+
+	nodeIDs := make([]uuid.UUID, len(ws.Nodes))
+	for i, n := range ws.Nodes {
+		nodeIDs[i] = n.ID
+	}
+	taken, err = s.existingIDs("nodes", nodeIDs)
+	if err != nil {
+		return nil, err
+	}
+	nodeRemap := make(map[uuid.UUID]uuid.UUID)
+	for i := range ws.Nodes {
+		ws.Nodes[i].WorkspaceID = ws.ID
+		if taken[ws.Nodes[i].ID] {
+			newID := uuid.New()
+			nodeRemap[ws.Nodes[i].ID] = newID
+			regenerated = append(regenerated, RegeneratedID{Kind: "node", OldID: ws.Nodes[i].ID, NewID: newID, Reason: IDTaken})
+			ws.Nodes[i].ID = newID
+		}
+	}
+
+	edgeIDs := make([]uuid.UUID, len(ws.Edges))
+	for i, e := range ws.Edges {
+		edgeIDs[i] = e.ID
+	}
+	taken, err = s.existingIDs("edges", edgeIDs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range ws.Edges {
+		e := &ws.Edges[i]
+		e.WorkspaceID = ws.ID
+		if newID, ok := nodeRemap[e.Source]; ok {
+			e.Source = newID
+		}
+		if newID, ok := nodeRemap[e.Target]; ok {
+			e.Target = newID
+		}
+		if taken[e.ID] {
+			newID := uuid.New()
+			regenerated = append(regenerated, RegeneratedID{Kind: "edge", OldID: e.ID, NewID: newID, Reason: IDTaken})
+			e.ID = newID
+		}
+	}
+
+	return regenerated, nil
+}
+
+// existingIDs returns which of the given IDs are already present in a table
+func (s *SupabaseService) existingIDs(table string, ids []uuid.UUID) (map[uuid.UUID]bool, error) {
+	taken := make(map[uuid.UUID]bool)
+	if len(ids) == 0 {
+		return taken, nil
+	}
+
+	list := make([]string, len(ids))
+	for i, id := range ids {
+		list[i] = id.String()
+	}
+
+	endpoint := fmt.Sprintf("%s?select=id&id=in.(%s)", table, strings.Join(list, ","))
+	body, status, err := s.client.Request("GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK {
+		log.Printf("Supabase returned status %d: %s", status, string(body))
+		return nil, fmt.Errorf("failed to look up %s: %s", table, string(body))
+	}
+
+	var rows []struct {
+		ID uuid.UUID `json:"id"`
+	}
+	if err := json.Unmarshal(body, &rows); err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		taken[row.ID] = true
+	}
+
+	return taken, nil
+}
+
+// IsImportError reports whether err was caused by an invalid or unsupported document
+func IsImportError(err error) bool {
+	return errors.Is(err, ErrInvalidDocument) || errors.Is(err, ErrUnsupportedFormat)
+}
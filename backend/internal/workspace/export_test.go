@@ -0,0 +1,100 @@
+package workspace
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/xizko39/nodeloom/internal/database"
+)
+
+func TestImportRegeneratesDocumentIDs(t *testing.T) {
+	a, b, ab := uuid.New(), uuid.New(), uuid.New()
+	doc := &ExportDocument{Workspace: ExportedWorkspace{
+		Name: "flow",
+		Nodes: []ExportedNode{
+			{ID: a, Label: "a"},
+			{ID: a, Label: "copy of a"},
+			{Label: "no id"},
+			{ID: b, Label: "b"},
+		},
+		Edges: []ExportedEdge{
+			{ID: ab, Source: a, Target: b},
+			{ID: ab, Source: b, Target: uuid.Nil},
+			{Source: a, Target: uuid.New()},
+		},
+	}}
+
+	ws, regenerated, _ := doc.toWorkspace()
+
+	reasons := make(map[string]int)
+	for _, r := range regenerated {
+		reasons[r.Kind+" "+r.Reason]++
+	}
+	want := map[string]int{"workspace missing": 1, "node duplicate": 1, "node missing": 1, "edge duplicate": 1}
+	if len(reasons) != len(want) {
+		t.Errorf("regenerated = %+v", regenerated)
+	}
+	for key, n := range want {
+		if reasons[key] != n {
+			t.Errorf("regenerated %s: %d, want %d", key, reasons[key], n)
+		}
+	}
+
+	// The edge to the node without an ID follows it to its new ID; the edge
+	// to an unknown node is dropped
+	if len(ws.Edges) != 2 {
+		t.Fatalf("edges = %+v", ws.Edges)
+	}
+	if ws.Edges[0].ID != ab || ws.Edges[0].Source != a || ws.Edges[0].Target != b {
+		t.Errorf("first edge = %+v", ws.Edges[0])
+	}
+	if ws.Edges[1].ID == ab || ws.Edges[1].Target != ws.Nodes[2].ID {
+		t.Errorf("second edge = %+v, want it to reach %s", ws.Edges[1], ws.Nodes[2].ID)
+	}
+}
+
+func TestImportRegeneratesTakenIDs(t *testing.T) {
+	ws := &Workspace{
+		ID:    uuid.New(),
+		Nodes: []Node{{ID: uuid.New()}, {ID: uuid.New()}},
+	}
+	ws.Edges = []Edge{{ID: uuid.New(), Source: ws.Nodes[0].ID, Target: ws.Nodes[1].ID}}
+	taken := map[uuid.UUID]bool{ws.Nodes[1].ID: true, ws.Edges[0].ID: true}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ids := strings.TrimSuffix(strings.TrimPrefix(r.URL.Query().Get("id"), "in.("), ")")
+		rows := []map[string]string{}
+		for _, id := range strings.Split(ids, ",") {
+			if taken[uuid.MustParse(id)] {
+				rows = append(rows, map[string]string{"id": id})
+			}
+		}
+		json.NewEncoder(w).Encode(rows)
+	}))
+	defer server.Close()
+	s := NewSupabaseService(database.NewSupabaseClient(server.URL, "test-key"))
+
+	oldNode, oldEdge := ws.Nodes[1].ID, ws.Edges[0].ID
+	regenerated, err := s.regenerateCollidingIDs(ws, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(regenerated) != 2 {
+		t.Fatalf("regenerated = %+v", regenerated)
+	}
+	node, edge := regenerated[0], regenerated[1]
+	if node.Kind != "node" || node.OldID != oldNode || node.NewID != ws.Nodes[1].ID || node.Reason != IDTaken {
+		t.Errorf("node = %+v", node)
+	}
+	if edge.Kind != "edge" || edge.OldID != oldEdge || edge.NewID != ws.Edges[0].ID || edge.Reason != IDTaken {
+		t.Errorf("edge = %+v", edge)
+	}
+	if ws.Edges[0].Target != ws.Nodes[1].ID {
+		t.Errorf("edge target = %s, want the node's new ID %s", ws.Edges[0].Target, ws.Nodes[1].ID)
+	}
+}
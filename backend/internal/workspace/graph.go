@@ -0,0 +1,150 @@
+package workspace
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Graph rendering formats accepted by the export endpoint
+const (
+	ExportFormatDOT     = "dot"
+	ExportFormatMermaid = "mermaid"
+)
+
+// nodeStyle controls how a node type is drawn in DOT and Mermaid output
+type nodeStyle struct {
+	dotShape     string
+	mermaidOpen  string
+	mermaidClose string
+	fill         string
+	stroke       string
+}
+
+var defaultNodeStyle = nodeStyle{dotShape: "box", mermaidOpen: "[", mermaidClose: "]", fill: "#eeeeee", stroke: "#666666"}
+
+var nodeStyles = map[NodeType]nodeStyle{
+	InputNode:    {dotShape: "invhouse", mermaidOpen: "([", mermaidClose: "])", fill: "#d4edda", stroke: "#28a745"},
+	OutputNode:   {dotShape: "house", mermaidOpen: "[/", mermaidClose: "\\]", fill: "#f8d7da", stroke: "#dc3545"},
+	ProcessNode:  {dotShape: "box", mermaidOpen: "(", mermaidClose: ")", fill: "#dbe9f6", stroke: "#1f78b4"},
+	BranchNode:   {dotShape: "diamond", mermaidOpen: "{", mermaidClose: "}", fill: "#fff3cd", stroke: "#ffc107"},
+	MergeNode:    {dotShape: "invtriangle", mermaidOpen: "{{", mermaidClose: "}}", fill: "#e2e3e5", stroke: "#6c757d"},
+	MapNode:      {dotShape: "box3d", mermaidOpen: "[/", mermaidClose: "/]", fill: "#e8dff5", stroke: "#6f42c1"},
+	SubflowNode:  {dotShape: "component", mermaidOpen: "[[", mermaidClose: "]]", fill: "#d1ecf1", stroke: "#17a2b8"},
+	LoopNode:     {dotShape: "doubleoctagon", mermaidOpen: "((", mermaidClose: "))", fill: "#fde2cf", stroke: "#fd7e14"},
+	PromptNode:   {dotShape: "note", mermaidOpen: ">", mermaidClose: "]", fill: "#fcf8e3", stroke: "#8a6d3b"},
+	LLMNode:      {dotShape: "ellipse", mermaidOpen: "[(", mermaidClose: ")]", fill: "#e0f7fa", stroke: "#00838f"},
+	AgentNode:    {dotShape: "hexagon", mermaidOpen: "[\\", mermaidClose: "\\]", fill: "#e0f2f1", stroke: "#00695c"},
+	ExtractNode:  {dotShape: "tab", mermaidOpen: "(((", mermaidClose: ")))", fill: "#fff8e1", stroke: "#ff8f00"},
+	ApprovalNode: {dotShape: "octagon", mermaidOpen: "[\\", mermaidClose: "/]", fill: "#f5e6ff", stroke: "#9b59b6"},
+	MemoryNode:   {dotShape: "cylinder", mermaidOpen: "[", mermaidClose: "]", fill: "#ede7f6", stroke: "#5e35b1"},
+}
+
+func styleFor(t NodeType) nodeStyle {
+	if style, ok := nodeStyles[t]; ok {
+		return style
+	}
+	return defaultNodeStyle
+}
+
+// ToDOT renders the workspace graph in Graphviz DOT syntax
+func ToDOT(ws *Workspace) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "digraph %s {\n", dotQuote(ws.Name))
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [style=filled, fontname=\"Helvetica\"];\n")
+
+	for _, n := range ws.Nodes {
+		style := styleFor(n.Type)
+		fmt.Fprintf(&b, "  %s [label=%s, shape=%s, fillcolor=%s, color=%s, tooltip=%s];\n",
+			dotQuote(n.ID.String()), dotQuote(n.Label), style.dotShape,
+			dotQuote(style.fill), dotQuote(style.stroke), dotQuote(string(n.Type)))
+	}
+
+	for _, e := range ws.Edges {
+		if e.SourceHandle != "" {
+			fmt.Fprintf(&b, "  %s -> %s [label=%s];\n", dotQuote(e.Source.String()), dotQuote(e.Target.String()), dotQuote(e.SourceHandle))
+			continue
+		}
+		fmt.Fprintf(&b, "  %s -> %s;\n", dotQuote(e.Source.String()), dotQuote(e.Target.String()))
+	}
+
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// ToMermaid renders the workspace graph as a Mermaid flowchart
+func ToMermaid(ws *Workspace) string {
+	var b strings.Builder
+
+	b.WriteString("flowchart LR\n")
+
+	// Mermaid IDs must be simple identifiers, so nodes are numbered in order
+	ids := make(map[string]string, len(ws.Nodes))
+	classes := make(map[NodeType][]string)
+	for i, n := range ws.Nodes {
+		id := fmt.Sprintf("n%d", i+1)
+		ids[n.ID.String()] = id
+
+		style := styleFor(n.Type)
+		fmt.Fprintf(&b, "  %s%s\"%s\"%s\n", id, style.mermaidOpen, mermaidEscape(n.Label), style.mermaidClose)
+		classes[n.Type] = append(classes[n.Type], id)
+	}
+
+	for _, e := range ws.Edges {
+		source, okSource := ids[e.Source.String()]
+		target, okTarget := ids[e.Target.String()]
+		if !okSource || !okTarget {
+			continue
+		}
+		if e.SourceHandle != "" {
+			fmt.Fprintf(&b, "  %s -->|\"%s\"| %s\n", source, mermaidEscape(e.SourceHandle), target)
+			continue
+		}
+		fmt.Fprintf(&b, "  %s --> %s\n", source, target)
+	}
+
+	// Emit class definitions in a stable order
+	types := make([]string, 0, len(classes))
+	for t := range classes {
+		types = append(types, string(t))
+	}
+	sort.Strings(types)
+
+	for _, t := range types {
+		style := styleFor(NodeType(t))
+		class := mermaidClassName(NodeType(t))
+		fmt.Fprintf(&b, "  classDef %s fill:%s,stroke:%s\n", class, style.fill, style.stroke)
+		fmt.Fprintf(&b, "  class %s %s\n", strings.Join(classes[NodeType(t)], ","), class)
+	}
+
+	return b.String()
+}
+
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, "\\", "\\\\")
+	s = strings.ReplaceAll(s, "\"", "\\\"")
+	s = strings.ReplaceAll(s, "\n", "\\n")
+	return "\"" + s + "\""
+}
+
+func mermaidEscape(s string) string {
+	s = strings.ReplaceAll(s, "\"", "#quot;")
+	s = strings.ReplaceAll(s, "\n", "<br/>")
+	return s
+}
+
+func mermaidClassName(t NodeType) string {
+	name := strings.ToLower(string(t))
+	name = strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+	if name == "" {
+		return "node"
+	}
+	return name + "Node"
+}
@@ -0,0 +1,322 @@
+package workspace
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/google/uuid"
+)
+
+// LayoutDirection selects the axis along which layers are placed
+type LayoutDirection string
+
+const (
+	LayoutLeftToRight LayoutDirection = "LR"
+	LayoutTopToBottom LayoutDirection = "TB"
+)
+
+const (
+	defaultLayerSpacing = 250.0
+	defaultNodeSpacing  = 120.0
+	layoutSweeps        = 8
+)
+
+// LayoutOptions configures the automatic layout
+type LayoutOptions struct {
+	Direction    LayoutDirection `json:"direction"`
+	LayerSpacing float64         `json:"layer_spacing"` // Distance between consecutive layers
+	NodeSpacing  float64         `json:"node_spacing"`  // Distance between nodes in the same layer
+}
+
+func (o LayoutOptions) withDefaults() LayoutOptions {
+	if o.Direction != LayoutTopToBottom {
+		o.Direction = LayoutLeftToRight
+	}
+	if o.LayerSpacing <= 0 {
+		o.LayerSpacing = defaultLayerSpacing
+	}
+	if o.NodeSpacing <= 0 {
+		o.NodeSpacing = defaultNodeSpacing
+	}
+	return o
+}
+
+// Layout computes node positions with a layered (Sugiyama-style) algorithm:
+// cycles are broken by reversing back edges, nodes are assigned to layers by
+// longest path, long edges are split with virtual nodes, crossings are
+// reduced with barycenter sweeps and finally each layer is centred on the
+// cross axis. The workspace itself is not modified.
+func Layout(ws *Workspace, opts LayoutOptions) map[uuid.UUID]Position {
+	opts = opts.withDefaults()
+
+	count := len(ws.Nodes)
+	positions := make(map[uuid.UUID]Position, count)
+	if count == 0 {
+		return positions
+	}
+
+	index := make(map[uuid.UUID]int, count)
+	for i, n := range ws.Nodes {
+		index[n.ID] = i
+	}
+
+	// Collect unique edges between known nodes, ignoring self loops
+	succ := make([][]int, count)
+	seen := make(map[[2]int]bool)
+	for _, e := range ws.Edges {
+		u, okSource := index[e.Source]
+		v, okTarget := index[e.Target]
+		if !okSource || !okTarget || u == v || seen[[2]int{u, v}] {
+			continue
+		}
+		seen[[2]int{u, v}] = true
+		succ[u] = append(succ[u], v)
+	}
+
+	edges := acyclicEdges(succ)
+	layer := assignLayers(count, edges)
+
+	// Split edges spanning several layers with virtual nodes so every edge
+	// connects adjacent layers
+	layerOf := append([]int(nil), layer...)
+	preds := make([][]int, count)
+	succs := make([][]int, count)
+	for _, e := range edges {
+		u, v := e[0], e[1]
+		for layerOf[u]+1 < layer[v] {
+			dummy := len(layerOf)
+			layerOf = append(layerOf, layerOf[u]+1)
+			preds = append(preds, nil)
+			succs = append(succs, nil)
+			succs[u] = append(succs[u], dummy)
+			preds[dummy] = append(preds[dummy], u)
+			u = dummy
+		}
+		succs[u] = append(succs[u], v)
+		preds[v] = append(preds[v], u)
+	}
+
+	depth := 0
+	for _, l := range layerOf {
+		if l+1 > depth {
+			depth = l + 1
+		}
+	}
+	layers := make([][]int, depth)
+	for v, l := range layerOf {
+		layers[l] = append(layers[l], v)
+	}
+
+	orderLayers(layers, preds, succs)
+
+	for l, members := range layers {
+		offset := float64(len(members)-1) / 2
+		for i, v := range members {
+			if v >= count {
+				continue
+			}
+			main := float64(l) * opts.LayerSpacing
+			cross := (float64(i) - offset) * opts.NodeSpacing
+			if opts.Direction == LayoutTopToBottom {
+				positions[ws.Nodes[v].ID] = Position{X: cross, Y: main}
+			} else {
+				positions[ws.Nodes[v].ID] = Position{X: main, Y: cross}
+			}
+		}
+	}
+
+	return positions
+}
+
+// acyclicEdges returns the edge list with back edges found by a depth-first
+// search reversed, which makes the graph acyclic
+func acyclicEdges(succ [][]int) [][2]int {
+	const (
+		unvisited = iota
+		active
+		done
+	)
+
+	state := make([]int, len(succ))
+	var edges [][2]int
+
+	var visit func(u int)
+	visit = func(u int) {
+		state[u] = active
+		for _, v := range succ[u] {
+			switch state[v] {
+			case active:
+				edges = append(edges, [2]int{v, u})
+			case unvisited:
+				edges = append(edges, [2]int{u, v})
+				visit(v)
+			default:
+				edges = append(edges, [2]int{u, v})
+			}
+		}
+		state[u] = done
+	}
+
+	for u := range succ {
+		if state[u] == unvisited {
+			visit(u)
+		}
+	}
+
+	return edges
+}
+
+// assignLayers places every node one layer after its deepest predecessor
+func assignLayers(count int, edges [][2]int) []int {
+	layer := make([]int, count)
+	indegree := make([]int, count)
+	out := make([][]int, count)
+	for _, e := range edges {
+		out[e[0]] = append(out[e[0]], e[1])
+		indegree[e[1]]++
+	}
+
+	queue := make([]int, 0, count)
+	for v := 0; v < count; v++ {
+		if indegree[v] == 0 {
+			queue = append(queue, v)
+		}
+	}
+
+	for len(queue) > 0 {
+		u := queue[0]
+		queue = queue[1:]
+		for _, v := range out[u] {
+			if layer[u]+1 > layer[v] {
+				layer[v] = layer[u] + 1
+			}
+			indegree[v]--
+			if indegree[v] == 0 {
+				queue = append(queue, v)
+			}
+		}
+	}
+
+	return layer
+}
+
+// orderLayers reorders nodes within each layer using alternating barycenter
+// sweeps, keeping the ordering with the fewest edge crossings
+func orderLayers(layers [][]int, preds, succs [][]int) {
+	best := copyLayers(layers)
+	bestCrossings := countCrossings(layers, succs)
+
+	for sweep := 0; sweep < layoutSweeps && bestCrossings > 0; sweep++ {
+		if sweep%2 == 0 {
+			for l := 1; l < len(layers); l++ {
+				sortByBarycenter(layers[l], layers[l-1], preds)
+			}
+		} else {
+			for l := len(layers) - 2; l >= 0; l-- {
+				sortByBarycenter(layers[l], layers[l+1], succs)
+			}
+		}
+
+		if crossings := countCrossings(layers, succs); crossings < bestCrossings {
+			best = copyLayers(layers)
+			bestCrossings = crossings
+		}
+	}
+
+	copy(layers, best)
+}
+
+// sortByBarycenter orders a layer by the mean position of each node's
+// neighbours in the adjacent fixed layer. Nodes without neighbours keep
+// their current position.
+func sortByBarycenter(layer, fixed []int, neighbours [][]int) {
+	pos := make(map[int]int, len(fixed))
+	for i, v := range fixed {
+		pos[v] = i
+	}
+
+	keys := make(map[int]float64, len(layer))
+	for i, v := range layer {
+		if len(neighbours[v]) == 0 {
+			keys[v] = float64(i)
+			continue
+		}
+		sum := 0.0
+		for _, w := range neighbours[v] {
+			sum += float64(pos[w])
+		}
+		keys[v] = sum / float64(len(neighbours[v]))
+	}
+
+	sort.SliceStable(layer, func(i, j int) bool {
+		return keys[layer[i]] < keys[layer[j]]
+	})
+}
+
+// countCrossings counts edge crossings between every pair of adjacent layers
+func countCrossings(layers [][]int, succs [][]int) int {
+	crossings := 0
+	for l := 0; l+1 < len(layers); l++ {
+		pos := make(map[int]int, len(layers[l+1]))
+		for i, v := range layers[l+1] {
+			pos[v] = i
+		}
+
+		var segments [][2]int
+		for i, u := range layers[l] {
+			for _, v := range succs[u] {
+				segments = append(segments, [2]int{i, pos[v]})
+			}
+		}
+
+		for a := 0; a < len(segments); a++ {
+			for b := a + 1; b < len(segments); b++ {
+				if (segments[a][0]-segments[b][0])*(segments[a][1]-segments[b][1]) < 0 {
+					crossings++
+				}
+			}
+		}
+	}
+	return crossings
+}
+
+func copyLayers(layers [][]int) [][]int {
+	out := make([][]int, len(layers))
+	for i, l := range layers {
+		out[i] = append([]int(nil), l...)
+	}
+	return out
+}
+
+// LayoutWorkspace computes an automatic layout for a workspace. Unless dryRun
+// is set, the new positions are saved to Supabase.
+func (s *SupabaseService) LayoutWorkspace(id uuid.UUID, opts LayoutOptions, dryRun bool) (map[uuid.UUID]Position, error) {
+	ws, err := s.GetWorkspace(id)
+	if err != nil {
+		return nil, err
+	}
+
+	positions := Layout(ws, opts)
+	if dryRun {
+		return positions, nil
+	}
+
+	for nodeID, position := range positions {
+		endpoint := fmt.Sprintf("nodes?id=eq.%s&workspace_id=eq.%s", nodeID.String(), id.String())
+		update := map[string]Position{"position": position}
+
+		body, status, err := s.client.Request("PATCH", endpoint, update)
+		if err != nil {
+			return nil, err
+		}
+
+		if status != http.StatusOK && status != http.StatusNoContent {
+			log.Printf("Supabase returned status %d: %s", status, string(body))
+			return nil, fmt.Errorf("failed to update node position: %s", string(body))
+		}
+	}
+
+	return positions, nil
+}
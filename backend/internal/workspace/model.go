@@ -7,17 +7,52 @@ import (
 type NodeType string
 
 const (
-	InputNode   NodeType = "INPUT"
-	OutputNode  NodeType = "OUTPUT"
-	ProcessNode NodeType = "PROCESS"
+	InputNode    NodeType = "INPUT"
+	OutputNode   NodeType = "OUTPUT"
+	ProcessNode  NodeType = "PROCESS"
+	BranchNode   NodeType = "BRANCH"   // Routes its input to the output ports whose condition holds
+	MergeNode    NodeType = "MERGE"    // Joins branches back together
+	MapNode      NodeType = "MAP"      // Runs an embedded sub-graph once per list element
+	SubflowNode  NodeType = "SUBFLOW"  // Runs another workspace as a single node
+	LoopNode     NodeType = "LOOP"     // Re-runs an embedded sub-graph while a condition holds
+	PromptNode   NodeType = "PROMPT"   // Renders a chat message list from its inputs
+	ApprovalNode NodeType = "APPROVAL" // Waits for a person to approve, edit or reject its input
+	LLMNode      NodeType = "LLM"      // Sends a chat to a language model
+	AgentNode    NodeType = "AGENT"    // Lets a language model call tools until it answers
+	ExtractNode  NodeType = "EXTRACT"  // Asks a language model for JSON matching a schema
+	MemoryNode   NodeType = "MEMORY"   // Loads and appends the chat history of a session
 )
 
+// knownNodeTypes lists every node type the backend understands
+var knownNodeTypes = map[NodeType]bool{
+	InputNode:    true,
+	OutputNode:   true,
+	ProcessNode:  true,
+	BranchNode:   true,
+	MergeNode:    true,
+	MapNode:      true,
+	SubflowNode:  true,
+	LoopNode:     true,
+	PromptNode:   true,
+	ApprovalNode: true,
+	LLMNode:      true,
+	AgentNode:    true,
+	ExtractNode:  true,
+	MemoryNode:   true,
+}
+
+// IsKnown reports whether the node type is understood by this backend
+func (t NodeType) IsKnown() bool {
+	return knownNodeTypes[t]
+}
+
 type Node struct {
-	ID       uuid.UUID              `json:"id"`
-	Type     NodeType               `json:"type"`
-	Label    string                 `json:"label"`
-	Data     map[string]interface{} `json:"data"`
-	Position Position               `json:"position"`
+	ID          uuid.UUID              `json:"id"`
+	WorkspaceID uuid.UUID              `json:"workspace_id"`
+	Type        NodeType               `json:"type"`
+	Label       string                 `json:"label"`
+	Data        map[string]interface{} `json:"data"`
+	Position    Position               `json:"position"`
 }
 
 type Position struct {
@@ -26,14 +61,55 @@ type Position struct {
 }
 
 type Workspace struct {
-	ID    uuid.UUID `json:"id"`
-	Name  string    `json:"name"`
-	Nodes []Node    `json:"nodes"`
-	Edges []Edge    `json:"edges"`
+	ID         uuid.UUID     `json:"id"`
+	Name       string        `json:"name"`
+	OwnerID    *uuid.UUID    `json:"owner_id,omitempty"`
+	OrgID      *uuid.UUID    `json:"org_id,omitempty"`
+	ParentID   *uuid.UUID    `json:"parent_id,omitempty"` // Workspace this one was cloned from
+	IsTemplate bool          `json:"is_template"`
+	Template   *TemplateInfo `json:"template,omitempty"`
+	Partials   Partials      `json:"partials,omitempty"`
+	Budget     float64       `json:"budget,omitempty"` // US dollars all runs together may spend on LLM calls; zero means no limit
+	Nodes      []Node        `json:"nodes"`
+	Edges      []Edge        `json:"edges"`
+}
+
+// Partials are named template snippets shared by the nodes of a workspace
+// and included with {{> name }}
+type Partials map[string]string
+
+// TemplateInfo describes a workspace published to the template gallery
+type TemplateInfo struct {
+	Title       string              `json:"title"`
+	Description string              `json:"description"`
+	Tags        []string            `json:"tags"`
+	Preview     string              `json:"preview,omitempty"` // URL of a preview image
+	Parameters  []TemplateParameter `json:"parameters"`
+}
+
+// TemplateParameter is a value requested from the user when a template is
+// instantiated and substituted into node data wherever {{ params.<name> }} appears
+type TemplateParameter struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Default     interface{} `json:"default,omitempty"`
+	Required    bool        `json:"required,omitempty"`
 }
 
 type Edge struct {
-	ID     uuid.UUID `json:"id"`
-	Source uuid.UUID `json:"source"`
-	Target uuid.UUID `json:"target"`
+	ID           uuid.UUID `json:"id"`
+	WorkspaceID  uuid.UUID `json:"workspace_id"`
+	Source       uuid.UUID `json:"source"`
+	Target       uuid.UUID `json:"target"`
+	SourceHandle string    `json:"source_handle,omitempty"` // Output port on the source node
+	TargetHandle string    `json:"target_handle,omitempty"` // Input port on the target node
+}
+
+// PortName returns the name under which an INPUT or OUTPUT node exposes its
+// value to callers of the flow: the "name" data field if set, else the label
+func (n *Node) PortName() string {
+	if name, ok := n.Data["name"].(string); ok && name != "" {
+		return name
+	}
+	return n.Label
 }
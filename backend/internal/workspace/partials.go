@@ -0,0 +1,42 @@
+package workspace
+
+import (
+	"github.com/google/uuid"
+)
+
+// SetPartial creates or replaces a named partial of a workspace
+func (s *SupabaseService) SetPartial(id uuid.UUID, name, content string) (*Workspace, error) {
+	ws, err := s.GetWorkspace(id)
+	if err != nil {
+		return nil, err
+	}
+
+	partials := make(Partials, len(ws.Partials)+1)
+	for k, v := range ws.Partials {
+		partials[k] = v
+	}
+	partials[name] = content
+
+	return s.patchWorkspace(id, map[string]interface{}{"partials": partials})
+}
+
+// DeletePartial removes a named partial from a workspace
+func (s *SupabaseService) DeletePartial(id uuid.UUID, name string) (*Workspace, error) {
+	ws, err := s.GetWorkspace(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := ws.Partials[name]; !ok {
+		return nil, ErrPartialNotFound
+	}
+
+	partials := make(Partials, len(ws.Partials))
+	for k, v := range ws.Partials {
+		if k != name {
+			partials[k] = v
+		}
+	}
+
+	return s.patchWorkspace(id, map[string]interface{}{"partials": partials})
+}
@@ -0,0 +1,130 @@
+package workspace
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrRevisionNotFound is returned when a workspace has no published revision with the requested number
+var ErrRevisionNotFound = fmt.Errorf("revision not found")
+
+// Revision is a published, immutable snapshot of a workspace's graph.
+// Subflow nodes may pin a revision so later edits to the workspace do not
+// change the flows using it. Revisions are numbered from 1 per workspace.
+type Revision struct {
+	WorkspaceID uuid.UUID  `json:"workspace_id"`
+	Revision    int        `json:"revision"`
+	Snapshot    *Workspace `json:"snapshot,omitempty"`
+	PublishedBy string     `json:"published_by,omitempty"`
+	PublishedAt time.Time  `json:"published_at"`
+}
+
+// maxPublishAttempts bounds how often a publish is retried when concurrent
+// publishes take the revision number it picked
+const maxPublishAttempts = 5
+
+// PublishRevision snapshots the current graph of a workspace as its next
+// revision. The "workspace_revisions" table has a unique constraint on
+// (workspace_id, revision), so of two concurrent publishes picking the same
+// number one is refused with 409 and tries again with the next number.
+func (s *SupabaseService) PublishRevision(id uuid.UUID, publishedBy string) (*Revision, error) {
+	ws, err := s.GetWorkspace(id)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 1; ; attempt++ {
+		latest, err := s.ListRevisions(id)
+		if err != nil {
+			return nil, err
+		}
+		number := 1
+		if len(latest) > 0 {
+			number = latest[0].Revision + 1
+		}
+
+		revision := &Revision{
+			WorkspaceID: id,
+			Revision:    number,
+			Snapshot:    ws,
+			PublishedBy: publishedBy,
+			PublishedAt: time.Now().UTC(),
+		}
+
+		body, status, err := s.client.Request("POST", "workspace_revisions", revision)
+		if err != nil {
+			return nil, err
+		}
+
+		if status == http.StatusConflict && attempt < maxPublishAttempts {
+			continue
+		}
+		if status != http.StatusCreated {
+			log.Printf("Supabase returned status %d: %s", status, string(body))
+			return nil, fmt.Errorf("failed to publish revision: %s", string(body))
+		}
+
+		return revision, nil
+	}
+}
+
+// ListRevisions retrieves the revisions of a workspace, newest first, without their snapshots
+func (s *SupabaseService) ListRevisions(id uuid.UUID) ([]Revision, error) {
+	query := url.Values{}
+	query.Set("select", "workspace_id,revision,published_by,published_at")
+	query.Set("workspace_id", "eq."+id.String())
+	query.Set("order", "revision.desc")
+
+	body, status, err := s.client.Request("GET", "workspace_revisions?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK {
+		log.Printf("Supabase returned status %d: %s", status, string(body))
+		return nil, fmt.Errorf("failed to fetch revisions: %s", string(body))
+	}
+
+	var revisions []Revision
+	err = json.Unmarshal(body, &revisions)
+	if err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// GetWorkspaceRevision retrieves the graph of a workspace as it was published in a revision
+func (s *SupabaseService) GetWorkspaceRevision(id uuid.UUID, revision int) (*Workspace, error) {
+	query := url.Values{}
+	query.Set("workspace_id", "eq."+id.String())
+	query.Set("revision", fmt.Sprintf("eq.%d", revision))
+
+	body, status, err := s.client.Request("GET", "workspace_revisions?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK {
+		log.Printf("Supabase returned status %d: %s", status, string(body))
+		return nil, fmt.Errorf("failed to get revision: %s", string(body))
+	}
+
+	var revisions []Revision
+	err = json.Unmarshal(body, &revisions)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(revisions) == 0 || revisions[0].Snapshot == nil {
+		return nil, ErrRevisionNotFound
+	}
+
+	return revisions[0].Snapshot, nil
+}
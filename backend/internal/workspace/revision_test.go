@@ -0,0 +1,93 @@
+package workspace
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/xizko39/nodeloom/internal/database"
+)
+
+// revisionServer is a fake PostgREST holding one workspace, whose
+// workspace_revisions table refuses duplicate (workspace_id, revision) pairs
+type revisionServer struct {
+	mu        sync.Mutex
+	workspace *Workspace
+	revisions []Revision
+}
+
+func (s *revisionServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	table := strings.TrimPrefix(r.URL.Path, "/rest/v1/")
+	switch {
+	case table == "workspaces":
+		json.NewEncoder(w).Encode([]*Workspace{s.workspace})
+	case table == "nodes" || table == "edges":
+		w.Write([]byte("[]"))
+	case table == "workspace_revisions" && r.Method == http.MethodGet:
+		sorted := append([]Revision(nil), s.revisions...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i].Revision > sorted[j].Revision })
+		json.NewEncoder(w).Encode(sorted)
+	case table == "workspace_revisions" && r.Method == http.MethodPost:
+		var revision Revision
+		json.NewDecoder(r.Body).Decode(&revision)
+		for _, existing := range s.revisions {
+			if existing.Revision == revision.Revision {
+				w.WriteHeader(http.StatusConflict)
+				w.Write([]byte(`{"code":"23505","message":"duplicate key value violates unique constraint"}`))
+				return
+			}
+		}
+		s.revisions = append(s.revisions, revision)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode([]Revision{revision})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestConcurrentPublishes(t *testing.T) {
+	id := uuid.New()
+	fake := &revisionServer{workspace: &Workspace{ID: id, Name: "flow"}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	s := NewSupabaseService(database.NewSupabaseClient(server.URL, "test-key"))
+
+	const publishes = maxPublishAttempts
+	numbers := make(chan int, publishes)
+	var wg sync.WaitGroup
+	for i := 0; i < publishes; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			revision, err := s.PublishRevision(id, "ada")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			numbers <- revision.Revision
+		}()
+	}
+	wg.Wait()
+	close(numbers)
+
+	seen := make(map[int]bool)
+	for n := range numbers {
+		if seen[n] {
+			t.Errorf("revision %d published twice", n)
+		}
+		seen[n] = true
+	}
+	for n := 1; n <= publishes; n++ {
+		if !seen[n] {
+			t.Errorf("revision %d missing; got %v", n, seen)
+		}
+	}
+}
@@ -15,6 +15,7 @@ var (
 	ErrWorkspaceNotFound = fmt.Errorf("workspace not found")
 	ErrNodeNotFound      = fmt.Errorf("node not found")
 	ErrEdgeNotFound      = fmt.Errorf("edge not found")
+	ErrPartialNotFound   = fmt.Errorf("partial not found")
 )
 
 // SupabaseService handles workspace operations using Supabase
@@ -176,6 +177,12 @@ func (s *SupabaseService) UpdateWorkspace(id uuid.UUID, name string) (*Workspace
 	return &updatedWorkspaces[0], nil
 }
 
+// SetBudget sets what the runs of a workspace may spend on LLM calls in
+// total. Zero removes the limit.
+func (s *SupabaseService) SetBudget(id uuid.UUID, budget float64) (*Workspace, error) {
+	return s.patchWorkspace(id, map[string]interface{}{"budget": budget})
+}
+
 // DeleteWorkspace deletes a workspace from Supabase
 func (s *SupabaseService) DeleteWorkspace(id uuid.UUID) error {
 	body, status, err := s.client.Request("DELETE", fmt.Sprintf("workspaces?id=eq.%s", id.String()), nil)
@@ -192,13 +199,18 @@ func (s *SupabaseService) DeleteWorkspace(id uuid.UUID) error {
 }
 
 // AddNode adds a new node to a workspace in Supabase
-func (s *SupabaseService) AddNode(workspaceID uuid.UUID, nodeType NodeType, label string, position Position) (*Node, error) {
+func (s *SupabaseService) AddNode(workspaceID uuid.UUID, nodeType NodeType, label string, position Position, data map[string]interface{}) (*Node, error) {
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+
 	node := Node{
-		ID:       uuid.New(),
-		Type:     nodeType,
-		Label:    label,
-		Data:     make(map[string]interface{}),
-		Position: position,
+		ID:          uuid.New(),
+		WorkspaceID: workspaceID,
+		Type:        nodeType,
+		Label:       label,
+		Data:        data,
+		Position:    position,
 	}
 
 	body, status, err := s.client.Request("POST", "nodes", node)
@@ -224,6 +236,39 @@ func (s *SupabaseService) AddNode(workspaceID uuid.UUID, nodeType NodeType, labe
 	return &insertedNodes[0], nil
 }
 
+// NodeUpdate holds the node fields to change; nil fields are left as they are
+type NodeUpdate struct {
+	Label    *string                `json:"label,omitempty"`
+	Data     map[string]interface{} `json:"data,omitempty"`
+	Position *Position              `json:"position,omitempty"`
+}
+
+// UpdateNode updates a node's label, data or position in Supabase
+func (s *SupabaseService) UpdateNode(workspaceID, nodeID uuid.UUID, update NodeUpdate) (*Node, error) {
+	endpoint := fmt.Sprintf("nodes?id=eq.%s&workspace_id=eq.%s", nodeID.String(), workspaceID.String())
+	body, status, err := s.client.Request("PATCH", endpoint, update)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK {
+		log.Printf("Supabase returned status %d: %s", status, string(body))
+		return nil, fmt.Errorf("failed to update node: %s", string(body))
+	}
+
+	var updatedNodes []Node
+	err = json.Unmarshal(body, &updatedNodes)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(updatedNodes) == 0 {
+		return nil, ErrNodeNotFound
+	}
+
+	return &updatedNodes[0], nil
+}
+
 // RemoveNode removes a node from a workspace in Supabase
 func (s *SupabaseService) RemoveNode(workspaceID, nodeID uuid.UUID) error {
 	endpoint := fmt.Sprintf("nodes?id=eq.%s&workspace_id=eq.%s", nodeID.String(), workspaceID.String())
@@ -241,11 +286,14 @@ func (s *SupabaseService) RemoveNode(workspaceID, nodeID uuid.UUID) error {
 }
 
 // AddEdge adds a new edge to a workspace in Supabase
-func (s *SupabaseService) AddEdge(workspaceID, sourceID, targetID uuid.UUID) (*Edge, error) {
+func (s *SupabaseService) AddEdge(workspaceID, sourceID, targetID uuid.UUID, sourceHandle, targetHandle string) (*Edge, error) {
 	edge := Edge{
-		ID:     uuid.New(),
-		Source: sourceID,
-		Target: targetID,
+		ID:           uuid.New(),
+		WorkspaceID:  workspaceID,
+		Source:       sourceID,
+		Target:       targetID,
+		SourceHandle: sourceHandle,
+		TargetHandle: targetHandle,
 	}
 
 	body, status, err := s.client.Request("POST", "edges", edge)
@@ -0,0 +1,182 @@
+package workspace
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// ErrNotATemplate is returned when instantiating a workspace that is not flagged as a template
+var ErrNotATemplate = fmt.Errorf("workspace is not a template")
+
+// MissingParametersError lists the template parameters that must be supplied
+// before a template can be instantiated
+type MissingParametersError struct {
+	Parameters []TemplateParameter
+}
+
+func (e *MissingParametersError) Error() string {
+	names := make([]string, len(e.Parameters))
+	for i, p := range e.Parameters {
+		names[i] = p.Name
+	}
+	return fmt.Sprintf("missing template parameters: %s", strings.Join(names, ", "))
+}
+
+var paramPattern = regexp.MustCompile(`\{\{\s*params\.([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// ApplyTemplateParameters substitutes the declared template parameters into
+// the data of every node. Values fall back to the parameter default; required
+// parameters without a value yield a *MissingParametersError, and optional
+// ones are replaced by an empty string.
+func ApplyTemplateParameters(ws *Workspace, params []TemplateParameter, values map[string]interface{}) error {
+	resolved := make(map[string]interface{}, len(params))
+	var missing []TemplateParameter
+	for _, p := range params {
+		if v, ok := values[p.Name]; ok {
+			resolved[p.Name] = v
+		} else if p.Default != nil {
+			resolved[p.Name] = p.Default
+		} else if p.Required {
+			missing = append(missing, p)
+		} else {
+			// Left in place, the placeholder would fail the node at run time
+			resolved[p.Name] = ""
+		}
+	}
+
+	if len(missing) > 0 {
+		return &MissingParametersError{Parameters: missing}
+	}
+
+	for i := range ws.Nodes {
+		for k, v := range ws.Nodes[i].Data {
+			ws.Nodes[i].Data[k] = substituteParams(v, resolved)
+		}
+	}
+
+	return nil
+}
+
+func substituteParams(v interface{}, values map[string]interface{}) interface{} {
+	switch val := v.(type) {
+	case string:
+		// A value that is exactly one placeholder keeps the parameter's type
+		if m := paramPattern.FindStringSubmatch(val); m != nil && m[0] == strings.TrimSpace(val) {
+			if resolved, ok := values[m[1]]; ok {
+				return resolved
+			}
+			return val
+		}
+		return paramPattern.ReplaceAllStringFunc(val, func(match string) string {
+			name := paramPattern.FindStringSubmatch(match)[1]
+			if resolved, ok := values[name]; ok {
+				return fmt.Sprint(resolved)
+			}
+			return match
+		})
+	case map[string]interface{}:
+		for k, item := range val {
+			val[k] = substituteParams(item, values)
+		}
+		return val
+	case []interface{}:
+		for i, item := range val {
+			val[i] = substituteParams(item, values)
+		}
+		return val
+	default:
+		return val
+	}
+}
+
+// ListTemplates retrieves all workspaces flagged as templates from Supabase
+func (s *SupabaseService) ListTemplates() ([]Workspace, error) {
+	body, status, err := s.client.Request("GET", "workspaces?is_template=eq.true", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK {
+		log.Printf("Supabase returned status %d: %s", status, string(body))
+		return nil, fmt.Errorf("failed to fetch templates: %s", string(body))
+	}
+
+	var templates []Workspace
+	err = json.Unmarshal(body, &templates)
+	if err != nil {
+		return nil, err
+	}
+
+	return templates, nil
+}
+
+// PublishTemplate flags a workspace as a template with the given gallery information
+func (s *SupabaseService) PublishTemplate(id uuid.UUID, info TemplateInfo) (*Workspace, error) {
+	update := map[string]interface{}{
+		"is_template": true,
+		"template":    info,
+	}
+	return s.patchWorkspace(id, update)
+}
+
+// UnpublishTemplate removes a workspace from the template gallery
+func (s *SupabaseService) UnpublishTemplate(id uuid.UUID) (*Workspace, error) {
+	update := map[string]interface{}{
+		"is_template": false,
+		"template":    nil,
+	}
+	return s.patchWorkspace(id, update)
+}
+
+func (s *SupabaseService) patchWorkspace(id uuid.UUID, update map[string]interface{}) (*Workspace, error) {
+	body, status, err := s.client.Request("PATCH", fmt.Sprintf("workspaces?id=eq.%s", id.String()), update)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK {
+		log.Printf("Supabase returned status %d: %s", status, string(body))
+		return nil, fmt.Errorf("failed to update workspace: %s", string(body))
+	}
+
+	var updatedWorkspaces []Workspace
+	err = json.Unmarshal(body, &updatedWorkspaces)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(updatedWorkspaces) == 0 {
+		return nil, ErrWorkspaceNotFound
+	}
+
+	return &updatedWorkspaces[0], nil
+}
+
+// InstantiateTemplate clones a template into a new workspace, substituting the supplied parameter values
+func (s *SupabaseService) InstantiateTemplate(id uuid.UUID, values map[string]interface{}, opts CloneOptions) (*Workspace, error) {
+	tmpl, err := s.GetWorkspace(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !tmpl.IsTemplate || tmpl.Template == nil {
+		return nil, ErrNotATemplate
+	}
+
+	if opts.Name == "" {
+		opts.Name = tmpl.Template.Title
+	}
+
+	ws := Clone(tmpl, opts)
+	if err := ApplyTemplateParameters(ws, tmpl.Template.Parameters, values); err != nil {
+		return nil, err
+	}
+
+	return s.SaveWorkspace(ws)
+}
@@ -0,0 +1,358 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/xizko39/nodeloom/internal/expr"
+	"github.com/xizko39/nodeloom/internal/jsonschema"
+)
+
+// Problem is a single finding reported by workspace validation. Line and
+// Column locate template and expression errors within the field's text.
+type Problem struct {
+	NodeID  *uuid.UUID `json:"node_id,omitempty"`
+	EdgeID  *uuid.UUID `json:"edge_id,omitempty"`
+	Field   string     `json:"field,omitempty"`
+	Message string     `json:"message"`
+	Line    int        `json:"line,omitempty"`
+	Column  int        `json:"column,omitempty"`
+}
+
+// Validate checks a workspace's nodes and edges, including the settings
+// each node needs before it can run
+func Validate(ws *Workspace) []Problem {
+	problems := []Problem{}
+
+	names := make([]string, 0, len(ws.Partials))
+	for name := range ws.Partials {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		field := "partials." + name
+		checkTemplate(ws.Partials[name], ws.Partials, func(err error) {
+			problems = append(problems, newProblem(nil, field, err))
+		})
+	}
+
+	nodeIDs := make(map[uuid.UUID]bool, len(ws.Nodes))
+	for i := range ws.Nodes {
+		nodeIDs[ws.Nodes[i].ID] = true
+		problems = append(problems, validateNode(&ws.Nodes[i], ws.Partials, true)...)
+	}
+
+	for _, e := range ws.Edges {
+		edgeID := e.ID
+		if !nodeIDs[e.Source] {
+			problems = append(problems, Problem{EdgeID: &edgeID, Field: "source", Message: "edge source does not exist"})
+		}
+		if !nodeIDs[e.Target] {
+			problems = append(problems, Problem{EdgeID: &edgeID, Field: "target", Message: "edge target does not exist"})
+		}
+	}
+
+	return problems
+}
+
+func newProblem(nodeID *uuid.UUID, field string, err error) Problem {
+	p := Problem{NodeID: nodeID, Field: field, Message: err.Error()}
+	var exprErr *expr.Error
+	if errors.As(err, &exprErr) {
+		p.Message = exprErr.Msg
+		p.Line = exprErr.Line
+		p.Column = exprErr.Column
+	}
+	return p
+}
+
+// ValidateNode checks a node's type and compiles every template and
+// expression in its data, so mistakes are caught when the node is saved
+// rather than when it runs. Partials are the workspace's shared snippets.
+// Settings a node needs before it can run, such as an LLM node's model, are
+// only checked by Validate, since the editor saves nodes before they are
+// filled in.
+func ValidateNode(node *Node, partials Partials) []Problem {
+	return validateNode(node, partials, false)
+}
+
+// validateNode checks a node as ValidateNode does and, with complete set,
+// the settings its type requires
+func validateNode(node *Node, partials Partials, complete bool) []Problem {
+	nodeID := node.ID
+	problems := []Problem{}
+	add := func(field string, err error) {
+		problems = append(problems, newProblem(&nodeID, field, err))
+	}
+
+	if !node.Type.IsKnown() {
+		add("type", fmt.Errorf("unknown node type %q", node.Type))
+	}
+
+	validateData(node.Data, "data", partials, add)
+
+	if complete {
+		validateSettings(node, add)
+	}
+
+	for field, source := range expressionFields(node) {
+		if _, err := expr.Compile(source); err != nil {
+			add(field, err)
+		}
+	}
+
+	// Nodes of embedded graphs (map and loop bodies) are validated too
+	if graph, ok := node.Data["graph"].(map[string]interface{}); ok {
+		nodes, _ := graph["nodes"].([]interface{})
+		for i, raw := range nodes {
+			fields, ok := raw.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			inner := Node{Type: NodeType(fmt.Sprint(fields["type"]))}
+			inner.Data, _ = fields["data"].(map[string]interface{})
+			for _, p := range validateNode(&inner, partials, complete) {
+				p.NodeID = &nodeID
+				p.Field = fmt.Sprintf("data.graph.nodes[%d].%s", i, p.Field)
+				problems = append(problems, p)
+			}
+		}
+	}
+
+	// Report problems in a stable order
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].Field < problems[j].Field
+	})
+
+	return problems
+}
+
+// validateSettings checks the settings a node's type needs to run
+func validateSettings(node *Node, add func(field string, err error)) {
+	switch node.Type {
+	case PromptNode:
+		validatePrompt(node.Data, add)
+	case ApprovalNode:
+		validateApproval(node.Data, add)
+	case LLMNode:
+		if model, _ := node.Data["model"].(string); model == "" {
+			add("data.model", fmt.Errorf("LLM node requires a model"))
+		}
+	case AgentNode:
+		validateAgent(node.Data, add)
+	case ExtractNode:
+		validateExtract(node.Data, add)
+	case MemoryNode:
+		validateMemory(node.Data, add)
+	}
+}
+
+// validateData compiles every template string in node data. Embedded graphs
+// are skipped; their nodes are validated on their own.
+func validateData(value interface{}, path string, partials Partials, add func(field string, err error)) {
+	switch val := value.(type) {
+	case string:
+		checkTemplate(val, partials, func(err error) { add(path, err) })
+	case map[string]interface{}:
+		for k, item := range val {
+			if path == "data" && k == "graph" {
+				continue
+			}
+			validateData(item, path+"."+k, partials, add)
+		}
+	case []interface{}:
+		for i, item := range val {
+			validateData(item, fmt.Sprintf("%s[%d]", path, i), partials, add)
+		}
+	}
+}
+
+// checkTemplate expands partials in a template string and compiles it
+func checkTemplate(src string, partials Partials, report func(err error)) {
+	if !expr.IsTemplate(src) {
+		return
+	}
+
+	expanded, err := expr.ExpandPartials(src, partials)
+	if err != nil {
+		report(err)
+		return
+	}
+
+	if _, err := expr.CompileTemplate(expanded); err != nil {
+		var exprErr *expr.Error
+		if expanded != src && errors.As(err, &exprErr) {
+			// Positions within the expanded text would not match the field
+			report(fmt.Errorf("%s (after expanding partials)", exprErr.Msg))
+			return
+		}
+		report(err)
+	}
+}
+
+// promptRoles are the chat roles a prompt message may take
+var promptRoles = map[string]bool{
+	"system":    true,
+	"user":      true,
+	"assistant": true,
+}
+
+// validatePrompt checks the shape of a prompt node's message list
+func validatePrompt(data map[string]interface{}, add func(field string, err error)) {
+	messages, ok := data["messages"].([]interface{})
+	if !ok || len(messages) == 0 {
+		add("data.messages", fmt.Errorf("prompt needs at least one message"))
+		return
+	}
+
+	for i, raw := range messages {
+		field := fmt.Sprintf("data.messages[%d]", i)
+		message, ok := raw.(map[string]interface{})
+		if !ok {
+			add(field, fmt.Errorf("message must be an object with a role and content"))
+			continue
+		}
+		if role, _ := message["role"].(string); !promptRoles[role] {
+			add(field+".role", fmt.Errorf("role must be system, user or assistant"))
+		}
+		if _, ok := message["content"].(string); !ok {
+			add(field+".content", fmt.Errorf("content must be a string"))
+		}
+	}
+}
+
+// agentToolTypes lists the tool types an agent node can offer
+var agentToolTypes = map[string]bool{
+	"http_fetch": true,
+	"calculator": true,
+	"retriever":  true,
+	"workspace":  true,
+}
+
+// validateAgent checks the model, tools and step limit of an agent node
+func validateAgent(data map[string]interface{}, add func(field string, err error)) {
+	if model, _ := data["model"].(string); model == "" {
+		add("data.model", fmt.Errorf("agent node requires a model"))
+	}
+
+	tools, ok := data["tools"].([]interface{})
+	if !ok || len(tools) == 0 {
+		add("data.tools", fmt.Errorf("agent node requires at least one tool"))
+	}
+	for i, raw := range tools {
+		field := fmt.Sprintf("data.tools[%d]", i)
+		tool, ok := raw.(map[string]interface{})
+		if !ok {
+			add(field, fmt.Errorf("tool must be an object"))
+			continue
+		}
+		kind, _ := tool["type"].(string)
+		if !agentToolTypes[kind] {
+			add(field+".type", fmt.Errorf("unknown tool type %q", kind))
+		}
+		if kind == "workspace" {
+			if id, _ := tool["workspace_id"].(string); uuid.Validate(id) != nil {
+				add(field+".workspace_id", fmt.Errorf("workspace tool requires a valid workspace_id"))
+			}
+		}
+	}
+
+	if raw, ok := data["max_steps"]; ok {
+		if steps, ok := raw.(float64); !ok || steps < 1 {
+			add("data.max_steps", fmt.Errorf("max_steps must be at least 1"))
+		}
+	}
+}
+
+// validateExtract checks the model, schema and repair limit of an extract node
+func validateExtract(data map[string]interface{}, add func(field string, err error)) {
+	if model, _ := data["model"].(string); model == "" {
+		add("data.model", fmt.Errorf("extract node requires a model"))
+	}
+
+	schema, ok := data["schema"].(map[string]interface{})
+	if !ok {
+		add("data.schema", fmt.Errorf("extract node requires a JSON Schema object"))
+	} else if _, err := jsonschema.Compile(schema); err != nil {
+		add("data.schema", err)
+	}
+
+	if raw, ok := data["max_repairs"]; ok {
+		if repairs, ok := raw.(float64); !ok || repairs < 0 {
+			add("data.max_repairs", fmt.Errorf("max_repairs must be a non-negative number"))
+		}
+	}
+}
+
+// validateMemory checks the strategy and limits of a memory node
+func validateMemory(data map[string]interface{}, add func(field string, err error)) {
+	strategy, _ := data["strategy"].(string)
+	switch strategy {
+	case "", "window", "tokens":
+	case "summary":
+		if model, _ := data["model"].(string); model == "" {
+			add("data.model", fmt.Errorf("summary memory requires a model"))
+		}
+	default:
+		add("data.strategy", fmt.Errorf("strategy must be window, tokens or summary"))
+	}
+
+	for _, field := range []string{"window", "max_tokens"} {
+		if raw, ok := data[field]; ok {
+			if n, ok := raw.(float64); !ok || n < 1 {
+				add("data."+field, fmt.Errorf("%s must be at least 1", field))
+			}
+		}
+	}
+}
+
+// validateApproval checks the assignees and expiry settings of an approval node
+func validateApproval(data map[string]interface{}, add func(field string, err error)) {
+	if raw, ok := data["assignees"]; ok {
+		assignees, ok := raw.([]interface{})
+		if !ok {
+			add("data.assignees", fmt.Errorf("assignees must be a list of usernames"))
+		}
+		for i, assignee := range assignees {
+			if _, ok := assignee.(string); !ok {
+				add(fmt.Sprintf("data.assignees[%d]", i), fmt.Errorf("assignee must be a username"))
+			}
+		}
+	}
+	if raw, ok := data["expires_in"]; ok {
+		if seconds, ok := raw.(float64); !ok || seconds < 0 {
+			add("data.expires_in", fmt.Errorf("expires_in must be a non-negative number of seconds"))
+		}
+	}
+	if raw, ok := data["on_expiry"]; ok {
+		if action, _ := raw.(string); action != "approved" && action != "rejected" {
+			add("data.on_expiry", fmt.Errorf("on_expiry must be approved or rejected"))
+		}
+	}
+}
+
+// expressionFields returns the data fields of a node that hold bare
+// expressions rather than templates, keyed by field path
+func expressionFields(node *Node) map[string]string {
+	fields := make(map[string]string)
+
+	switch node.Type {
+	case BranchNode:
+		routes, _ := node.Data["routes"].([]interface{})
+		for i, raw := range routes {
+			if route, ok := raw.(map[string]interface{}); ok {
+				if when, ok := route["when"].(string); ok {
+					fields[fmt.Sprintf("data.routes[%d].when", i)] = when
+				}
+			}
+		}
+	case LoopNode:
+		if while, ok := node.Data["while"].(string); ok && while != "" {
+			fields["data.while"] = while
+		}
+	}
+
+	return fields
+}
@@ -0,0 +1,35 @@
+package workspace
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestValidateNodeLeavesSettingsToValidate(t *testing.T) {
+	// Nodes as the editor creates them, before they are filled in
+	for _, nodeType := range []NodeType{PromptNode, LLMNode, AgentNode, ExtractNode} {
+		node := Node{ID: uuid.New(), Type: nodeType, Label: "new"}
+		if problems := ValidateNode(&node, nil); len(problems) > 0 {
+			t.Errorf("ValidateNode(%s) = %+v, want no problems", nodeType, problems)
+		}
+
+		ws := &Workspace{ID: uuid.New(), Nodes: []Node{node}}
+		if problems := Validate(ws); len(problems) == 0 {
+			t.Errorf("Validate(%s) found no missing settings", nodeType)
+		}
+	}
+}
+
+func TestValidateNodeChecksTemplates(t *testing.T) {
+	node := Node{ID: uuid.New(), Type: LLMNode, Data: map[string]interface{}{"prompt": "Hello {{ name "}}
+	problems := ValidateNode(&node, nil)
+	if len(problems) != 1 || problems[0].Field != "data.prompt" {
+		t.Errorf("ValidateNode = %+v, want a problem with data.prompt", problems)
+	}
+
+	node = Node{ID: uuid.New(), Type: "WIDGET"}
+	if problems := ValidateNode(&node, nil); len(problems) != 1 || problems[0].Field != "type" {
+		t.Errorf("ValidateNode = %+v, want an unknown type", problems)
+	}
+}